@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/carvhal/gby/internal/disasm"
+	"github.com/carvhal/gby/internal/symbols"
+)
+
+// runDisasm implements gby disasm [-bank n] <rom>, it writes the disassembly of a ROM bank on stdout,
+// labelled with the symbol file next to the ROM if there is one
+func runDisasm(args []string) int {
+	flags := flag.NewFlagSet("disasm", flag.ExitOnError)
+	bank := flags.Int("bank", 0, "ROM bank to disassemble")
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		fmt.Println("usage: gby disasm [-bank n] <rom>")
+		return 1
+	}
+
+	rom, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		fmt.Printf("disasm: %v\n", err)
+		return 1
+	}
+
+	table, err := symbols.LoadForROM(flags.Arg(0))
+	if err != nil {
+		fmt.Printf("disasm: %v\n", err)
+		return 1
+	}
+
+	if err := disasm.WriteBank(os.Stdout, rom, *bank, table); err != nil {
+		fmt.Printf("disasm: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
@@ -1,35 +1,437 @@
 package main
 
 import (
+	"bufio"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/carvhal/gby/internal/cartridge"
 	"github.com/carvhal/gby/internal/cpu"
+	"github.com/carvhal/gby/internal/debugger"
+	"github.com/carvhal/gby/internal/expr"
+	"github.com/carvhal/gby/internal/gdb"
+	"github.com/carvhal/gby/internal/machine"
 	"github.com/carvhal/gby/internal/memory"
+	"github.com/carvhal/gby/internal/movie"
+	"github.com/carvhal/gby/internal/ppu"
+	"github.com/carvhal/gby/internal/rewind"
+	"github.com/carvhal/gby/internal/savestate"
+	"github.com/carvhal/gby/internal/sgb"
+	"github.com/carvhal/gby/internal/symbols"
 )
 
+// crashReportLength is the number of instructions shown before a fatal error
+const crashReportLength = 32
+
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("usage: gby <rom>")
+	if len(os.Args) > 1 && os.Args[1] == "disasm" {
+		os.Exit(runDisasm(os.Args[2:]))
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "test" {
+		os.Exit(runTest(os.Args[2:]))
+	}
+
+	debug := flag.Bool("debug", false, "start in the interactive debugger instead of running the ROM")
+	gdbPort := flag.Int("gdb", 0, "wait for a GDB remote debugger on this localhost port instead of running the ROM")
+	sgbMode := flag.Bool("sgb", false, "run SGB enhanced cartridges in Super Game Boy mode")
+	cameraImages := flag.String("camera", "", "comma separated PNG files fed to the Pocket Camera sensor, one per capture")
+	mapper := flag.String("mapper", "", "force the cartridge mapper instead of detecting it (rom, mbc1, mbc1m, mmm01, sachen, wisdomtree, ...)")
+	mapperDatabase := flag.String("mapperdb", "", "checksum database file mapping ROM CRC32s to mappers, one \"<crc32> <mapper>\" per line")
+	tracePath := flag.String("trace", "", "log the instructions executed to this file, in the Gameboy Doctor format")
+	historySize := flag.Int("history", cpu.DEFAULT_HISTORY_SIZE, "number of instructions remembered for the crash report and the debugger")
+	traceRanges := flag.String("trace-pc", "", "only trace the instructions at these comma separated addresses and ranges (0150,4000-7FFF)")
+	traceCondition := flag.String("trace-if", "", "only trace the instructions before which this condition holds, as in \"A > 0x10 && [HL] == 0xFF\"")
+	loadState := flag.String("load-state", "", "restore the machine from this save state before running")
+	saveState := flag.String("save-state", "", "save the state of the machine to this file on exit")
+	rewindBudget := flag.Int("rewind", 0, "keep this many MiB of per frame snapshots to rewind in the debugger or with the rewind command, 0 disables rewinding (headless runs and movies never rewind)")
+	recordPath := flag.String("record", "", "record the joypad input of every frame to this movie file")
+	playPath := flag.String("play", "", "play back the input of this movie file")
+	verify := flag.Bool("verify", false, "with -play, exit with an error when a frame differs from the movie checkpoints")
+	headless := flag.Bool("headless", false, "run frame by frame without display, to take screenshots")
+	frames := flag.Int("frames", 0, "with -headless, number of frames to run before exiting, 0 runs until Ctrl-C")
+	screenshot := flag.String("screenshot", "", "with -headless, write the last frame to this PNG file on exit")
+	screenshotEvery := flag.Int("screenshot-every", 0, "with -headless and -screenshot, also write every n-th frame, numbered (out-000060.png)")
+	palette := flag.String("palette", ppu.DEFAULT_DMG_PALETTE, "colors of DMG games: grey, green or pocket")
+	lockup := flag.Bool("lockup", false, "lock the CPU up on undefined opcodes as the hardware does instead of exiting")
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		fmt.Println("usage: gby [-debug] [-gdb port] [-sgb] [-camera images] [-mapper name] [-mapperdb file] [-trace file] [-trace-pc ranges] [-trace-if condition] [-history n] [-lockup] [-load-state file] [-save-state file] [-rewind MiB] [-record movie] [-play movie [-verify]] [-palette name]\n           [-headless [-frames n] [-screenshot file.png] [-screenshot-every n]] <rom>")
+		fmt.Println("       gby disasm [-bank n] <rom>")
+		fmt.Println("       gby test [-blargg] [-frames n] [-palette name] [-references dir] [-update] <dir>...")
 		os.Exit(1)
 	}
 
-	rom, err := os.ReadFile(os.Args[1])
+	rom, err := os.ReadFile(flag.Arg(0))
 
 	if err != nil {
 		panic(err)
 	}
 
+	if *mapperDatabase != "" {
+		database, err := os.Open(*mapperDatabase)
+		if err != nil {
+			panic(err)
+		}
+
+		err = cartridge.LoadChecksumDatabase(database)
+		database.Close()
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	var tracer *cpu.Tracer
+	if *tracePath != "" {
+		var ranges []cpu.AddressRange
+		if *traceRanges != "" {
+			if ranges, err = cpu.ParseRanges(*traceRanges); err != nil {
+				panic(err)
+			}
+		}
+
+		traceFile, err := os.Create(*tracePath)
+		if err != nil {
+			panic(err)
+		}
+
+		tracer = cpu.NewTracer(traceFile, ranges...)
+
+		if *traceCondition != "" {
+			condition, err := expr.Parse(*traceCondition)
+			if err != nil {
+				fmt.Printf("invalid trace condition: %v\n", err)
+				os.Exit(1)
+			}
+			tracer.SetCondition(condition)
+		}
+	}
+
+	dmgPalette, ok := ppu.DMGPalettes[*palette]
+	if !ok {
+		fmt.Printf("unknown palette %q\n", *palette)
+		os.Exit(1)
+	}
+
+	illegalOpcodes := cpu.ILLEGAL_OPCODE_ERROR
+	if *lockup {
+		illegalOpcodes = cpu.ILLEGAL_OPCODE_LOCKUP
+	}
+
 	bus := memory.NewController(rom)
 	cpu := cpu.NewCPU(bus)
+	bus.PPU().SetDMGPalette(dmgPalette)
 
-	for {
-		_, err := cpu.Tick()
+	if *mapper != "" {
+		kind, err := cartridge.ParseKind(*mapper)
 		if err != nil {
-			cpu.PrintStack()
-			fmt.Printf("\nFATAL ERROR: %v at PC: 0x%X\nprinted call stack and exited... \n\n\n", err, cpu.PC)
+			panic(err)
+		}
+
+		bus.SetMapper(cartridge.NewKind(rom, kind))
+	}
+
+	if *sgbMode && sgb.Supported(rom) {
+		bus.EnableSGB()
+	}
+
+	// there is no boot ROM, the cartridge starts from its entry point unless a save state restores the machine
+	if *loadState == "" {
+		machine.SkipBoot(cpu, bus)
+	}
+
+	if camera, ok := bus.Mapper().(*cartridge.Camera); ok && *cameraImages != "" {
+		sensor, err := cartridge.LoadImageSequence(strings.Split(*cameraImages, ",")...)
+		if err != nil {
+			panic(err)
+		}
+
+		camera.SetSensor(sensor)
+	}
+
+	table, err := symbols.LoadForROM(flag.Arg(0))
+	if err != nil {
+		fmt.Printf("could not load symbols: %v\n", err)
+	}
+	cpu.SetSymbols(table)
+
+	if err := cpu.SetTracer(tracer); err != nil {
+		fmt.Printf("invalid trace condition: %v\n", err)
+		os.Exit(1)
+	}
+	cpu.SetHistorySize(*historySize)
+	cpu.SetIllegalOpcodePolicy(illegalOpcodes)
+
+	// movies start from a cartridge without battery save and leave the battery save alone
+	savePath := ""
+	if *recordPath == "" && *playPath == "" {
+		savePath = strings.TrimSuffix(flag.Arg(0), filepath.Ext(flag.Arg(0))) + ".sav"
+		loadBattery(bus.Mapper(), savePath)
+	}
+
+	var session *movie.Session
+	switch {
+	case *playPath != "":
+		m, err := movie.Load(*playPath)
+		if err != nil {
+			panic(err)
+		}
+
+		if session, err = movie.Play(cpu, bus, m, *verify); err != nil {
+			panic(err)
+		}
+	case *recordPath != "":
+		session = movie.Record(cpu, bus, time.Now().UTC().Truncate(time.Second))
+	}
+
+	if *loadState != "" {
+		if err := savestate.LoadFile(*loadState, cpu, bus); err != nil {
+			fmt.Printf("could not load save state %s: %v\n", *loadState, err)
 			os.Exit(1)
 		}
 	}
 
+	var rewinder *rewind.Rewinder
+	// the debugger and the run loop take snapshots, headless runs, movies and GDB sessions cannot rewind
+	if *rewindBudget > 0 && *gdbPort == 0 && !*headless && session == nil {
+		rewinder = rewind.New(cpu, bus, *rewindBudget<<20)
+	}
+
+	// states saved and loaded while running, by the debugger or commands typed on the standard input
+	statePath := strings.TrimSuffix(flag.Arg(0), filepath.Ext(flag.Arg(0))) + ".state"
+
+	// shutdown keeps the battery save, the save state, the movie recorded and the end of the trace
+	shutdown := func(code int) {
+		if savePath != "" {
+			saveBattery(bus.Mapper(), savePath)
+		}
+		if *recordPath != "" {
+			if err := session.Movie().Save(*recordPath); err != nil {
+				fmt.Printf("could not write movie %s: %v\n", *recordPath, err)
+			}
+		}
+		if *saveState != "" {
+			if err := savestate.SaveFile(*saveState, cpu, bus); err != nil {
+				fmt.Printf("could not write save state %s: %v\n", *saveState, err)
+			}
+		}
+		if tracer != nil {
+			tracer.Flush()
+		}
+		os.Exit(code)
+	}
+
+	// crash reports a fatal CPU error with the last instructions executed
+	crash := func(err error) {
+		fmt.Printf("last instructions executed:\n")
+		cpu.PrintHistory(os.Stdout, crashReportLength)
+		fmt.Printf("\nbacktrace:\n")
+		cpu.PrintBacktrace(os.Stdout)
+		fmt.Printf("\nFATAL ERROR: %v at PC: %s\nprinted the last instructions and exited... \n\n\n", err, cpu.FormatAddress(cpu.PC))
+		shutdown(1)
+	}
+
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt)
+
+	if *gdbPort != 0 {
+		address := fmt.Sprintf("localhost:%d", *gdbPort)
+		fmt.Printf("waiting for a GDB connection on %s\n", address)
+
+		go func() {
+			<-interrupted
+			shutdown(0)
+		}()
+
+		if err := gdb.NewServer(cpu, bus).ListenAndServe(address); err != nil {
+			fmt.Printf("gdb server: %v\n", err)
+		}
+
+		shutdown(0)
+	}
+
+	if *debug {
+		// Ctrl-C stops the running command and returns to the prompt
+		d := debugger.New(cpu, bus)
+		d.SetRewinder(rewinder)
+		d.SetStatePath(statePath)
+		go func() {
+			for range interrupted {
+				d.Interrupt()
+			}
+		}()
+
+		if err := d.REPL(os.Stdin, os.Stdout); err != nil {
+			fmt.Printf("debugger: %v\n", err)
+		}
+
+		shutdown(0)
+	}
+
+	if session != nil || *headless {
+		runFrame := func() error {
+			_, err := machine.RunFrame(cpu, bus)
+			return err
+		}
+		if session != nil {
+			runFrame = session.RunFrame
+		}
+
+	frames:
+		for frame := 1; *frames == 0 || frame <= *frames; frame++ {
+			select {
+			case <-interrupted:
+				break frames
+			default:
+			}
+
+			var diverged *movie.DivergenceError
+			switch err := runFrame(); {
+			case err == nil:
+			case errors.Is(err, movie.ErrEnd):
+				fmt.Printf("played back the %d frames of the movie\n", frame-1)
+				break frames
+			case errors.As(err, &diverged):
+				fmt.Println(err)
+				shutdown(1)
+			default:
+				crash(err)
+			}
+
+			if *screenshot != "" && *screenshotEvery > 0 && frame%*screenshotEvery == 0 {
+				if err := writeScreenshot(bus, numberedPath(*screenshot, frame)); err != nil {
+					fmt.Printf("could not write screenshot: %v\n", err)
+				}
+			}
+		}
+
+		if *screenshot != "" {
+			if err := writeScreenshot(bus, *screenshot); err != nil {
+				fmt.Printf("could not write screenshot: %v\n", err)
+				shutdown(1)
+			}
+		}
+
+		shutdown(0)
+	}
+
+	fmt.Printf("type %s while running, states are saved in %s\n", commandNames(rewinder), statePath)
+	typed := readCommands()
+
+	for {
+		select {
+		case <-interrupted:
+			shutdown(0)
+		case command := <-typed:
+			runCommand(command, statePath, cpu, bus, rewinder)
+		default:
+		}
+
+		// RunFrame counts the DMA stalls reported by the bus in the frame
+		if _, err := machine.RunFrame(cpu, bus); err != nil {
+			crash(err)
+		}
+
+		if rewinder != nil {
+			rewinder.Capture()
+		}
+	}
+
+}
+
+// readCommands sends the lines typed on the standard input
+func readCommands() <-chan string {
+	commands := make(chan string)
+
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			commands <- strings.TrimSpace(scanner.Text())
+		}
+	}()
+
+	return commands
+}
+
+// runCommand runs a command typed while running: "save" or "load" the state of the machine in path,
+// or "rewind [frames]" when rewinder is not nil
+func runCommand(command string, path string, c *cpu.CPU, bus *memory.Controller, rewinder *rewind.Rewinder) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return
+	}
+
+	switch {
+	case fields[0] == "save":
+		if err := savestate.SaveFile(path, c, bus); err != nil {
+			fmt.Printf("could not write save state %s: %v\n", path, err)
+			return
+		}
+		fmt.Printf("saved the state to %s\n", path)
+	case fields[0] == "load":
+		if err := savestate.LoadFile(path, c, bus); err != nil {
+			fmt.Printf("could not load save state %s: %v\n", path, err)
+			return
+		}
+		fmt.Printf("loaded the state from %s\n", path)
+	case fields[0] == "rewind" && rewinder != nil:
+		count := 1
+		if len(fields) > 1 {
+			var err error
+			if count, err = strconv.Atoi(fields[1]); err != nil || count < 0 {
+				fmt.Printf("invalid frame count %q\n", fields[1])
+				return
+			}
+		}
+
+		frame, err := rewinder.Rewind(count)
+		if err != nil {
+			fmt.Printf("could not rewind: %v\n", err)
+			return
+		}
+		fmt.Printf("rewound to frame %d\n", frame)
+	default:
+		fmt.Printf("unknown command %q, type %s\n", command, commandNames(rewinder))
+	}
+}
+
+// commandNames lists the commands runCommand accepts
+func commandNames(rewinder *rewind.Rewinder) string {
+	if rewinder != nil {
+		return "save, load or rewind [frames]"
+	}
+
+	return "save or load"
+}
+
+// loadBattery restores the battery backed data of the cartridge from path, if the file exists
+func loadBattery(mapper cartridge.Mapper, path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	if err := mapper.LoadBattery(data); err != nil {
+		fmt.Printf("could not load battery save %s: %v\n", path, err)
+	}
+}
+
+// saveBattery writes the battery backed data of the cartridge to path, cartridges without a battery save nothing
+func saveBattery(mapper cartridge.Mapper, path string) {
+	data := mapper.SaveBattery()
+	if len(data) == 0 {
+		return
+	}
+
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		fmt.Printf("could not write battery save %s: %v\n", path, err)
+	}
 }
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/carvhal/gby/internal/machine"
+	"github.com/carvhal/gby/internal/memory"
+)
+
+// writeScreenshot writes the last frame displayed to path as PNG
+func writeScreenshot(bus *memory.Controller, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := png.Encode(file, machine.Screen(bus)); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// numberedPath inserts the frame number before the extension of path, out.png becomes out-000060.png
+func numberedPath(path string, frame int) string {
+	extension := filepath.Ext(path)
+	return fmt.Sprintf("%s-%06d%s", strings.TrimSuffix(path, extension), frame, extension)
+}
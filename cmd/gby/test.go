@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/carvhal/gby/internal/blargg"
+	"github.com/carvhal/gby/internal/ppu"
+	"github.com/carvhal/gby/internal/romtest"
+)
+
+// runTest implements gby test [-blargg] [-frames n] [-palette name] [-references dir] [-update] <dir>...,
+// it runs the test ROMs of the directories and compares their screen with the reference PNGs,
+// or reads the result Blargg's ROMs report, it exits with an error when a test fails
+func runTest(args []string) int {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	frames := flags.Int("frames", 0, fmt.Sprintf("frames a ROM runs at most, unless it executes LD B, B or an infinite JR loop (default %d, %d with -blargg)", romtest.DEFAULT_FRAMES, blargg.DEFAULT_FRAMES))
+	blarggMode := flags.Bool("blargg", false, "run Blargg's test ROMs, reading the result they send through serial or write in cartridge RAM")
+	palette := flags.String("palette", ppu.DEFAULT_DMG_PALETTE, "colors of DMG games: grey, green or pocket")
+	references := flags.String("references", "", "directory of the reference PNGs, named after the ROMs, the directory of the ROMs by default")
+	update := flags.Bool("update", false, "write the screen of the ROMs without a passing reference as their reference")
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		fmt.Println("usage: gby test [-blargg] [-frames n] [-palette name] [-references dir] [-update] <dir>...")
+		return 1
+	}
+
+	if *blarggMode {
+		return runBlargg(flags.Args(), *frames)
+	}
+
+	options := romtest.Options{Frames: *frames, Palette: *palette, References: *references}
+
+	var results []romtest.Result
+	for _, dir := range flags.Args() {
+		dirResults, err := romtest.RunDirectory(dir, options)
+		if err != nil {
+			fmt.Printf("test: %v\n", err)
+			return 1
+		}
+		results = append(results, dirResults...)
+	}
+
+	if *update {
+		for i, result := range results {
+			// only missing and differing references are replaced, not ROMs failing to run
+			if result.Diff == 0 && !errors.Is(result.Err, os.ErrNotExist) || result.Screen == nil {
+				continue
+			}
+
+			if err := romtest.WritePNG(result.Reference, result.Screen); err != nil {
+				fmt.Printf("test: %v\n", err)
+				return 1
+			}
+			fmt.Printf("updated %s\n", result.Reference)
+
+			results[i].Err, results[i].Diff = nil, 0
+		}
+	}
+
+	romtest.WriteMatrix(os.Stdout, results)
+
+	for _, result := range results {
+		if !result.Passed() {
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// runBlargg runs Blargg's test ROMs of the directories and prints the failing sub-tests
+func runBlargg(dirs []string, frames int) int {
+	var results []blargg.Result
+	for _, dir := range dirs {
+		dirResults, err := blargg.RunDirectory(dir, frames)
+		if err != nil {
+			fmt.Printf("test: %v\n", err)
+			return 1
+		}
+		results = append(results, dirResults...)
+	}
+
+	blargg.WriteMatrix(os.Stdout, results)
+
+	for _, result := range results {
+		if !result.Passed() {
+			return 1
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,253 @@
+package blargg
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/carvhal/gby/internal/cpu"
+	"github.com/carvhal/gby/internal/machine"
+	"github.com/carvhal/gby/internal/memory"
+	"github.com/carvhal/gby/internal/romtest"
+)
+
+/*
+* Blargg's test ROMs report their result two ways
+*
+* serial: the text printed on screen is also sent through the link port, one character per transfer
+*
+* cartridge RAM:
+*
+* address | description
+*
+* 0xA000  | status, 0x80 while running, then the result code (0: passed)
+* 0xA001  | signature DE B0 61, telling the status and the text are valid
+* 0xA004  | text printed on screen, NUL terminated
+*
+ */
+
+const (
+	statusAddress uint16 = 0xA000
+	textAddress   uint16 = 0xA004
+
+	STATUS_RUNNING byte = 0x80
+)
+
+const (
+	// DEFAULT_FRAMES is the number of frames a ROM runs at most, cpu_instrs takes about a minute
+	DEFAULT_FRAMES = 60 * 120
+
+	// frames run once the result is known, for the ROM to finish sending the line through serial
+	resultFrames = 10
+)
+
+var signature = []byte{0xDE, 0xB0, 0x61}
+
+var (
+	subTestPattern = regexp.MustCompile(`\b(\d{2}):(\w+)`) // "01:ok  02:05" of the multi test ROMs
+	failedPattern  = regexp.MustCompile(`Failed #(\d+)`)   // the single test ROMs report the failing test
+)
+
+// Result is the outcome of a test ROM
+type Result struct {
+	ROM    string
+	Frames int    // frames run
+	Output string // text sent through serial, or written in cartridge RAM without serial output
+	Status byte   // result code written at 0xA000, STATUS_RUNNING without one
+	Failed []int  // numbers of the failing sub-tests
+	Done   bool   // the ROM printed Passed or Failed, or wrote its result code
+	Err    error  // the ROM failed to run
+}
+
+// Passed reports whether the ROM ran to the end and reported passing
+func (r Result) Passed() bool {
+	if r.Err != nil || !r.Done || len(r.Failed) > 0 || strings.Contains(r.Output, "Failed") {
+		return false
+	}
+
+	return r.Status == 0 || strings.Contains(r.Output, "Passed")
+}
+
+// Summary returns pass, or why the ROM failed
+func (r Result) Summary() string {
+	switch {
+	case r.Err != nil:
+		return fmt.Sprintf("error: %v", r.Err)
+	case !r.Done:
+		return "timeout"
+	case len(r.Failed) > 0:
+		return "FAIL " + formatTests(r.Failed)
+	case !r.Passed():
+		return fmt.Sprintf("FAIL (code %d)", r.Status)
+	}
+
+	return "pass"
+}
+
+func formatTests(tests []int) string {
+	numbers := make([]string, len(tests))
+	for i, test := range tests {
+		numbers[i] = fmt.Sprintf("#%d", test)
+	}
+
+	return strings.Join(numbers, " ")
+}
+
+// Run runs a ROM from its entry point until it reports its result, or for frames at most (DEFAULT_FRAMES when 0)
+func Run(rom []byte, frames int) Result {
+	if frames == 0 {
+		frames = DEFAULT_FRAMES
+	}
+
+	bus := memory.NewController(rom)
+	c := cpu.NewCPU(bus)
+	machine.SkipBoot(c, bus)
+
+	var serial []byte
+	bus.OnSerial(func(value byte) { serial = append(serial, value) })
+
+	done := func() bool {
+		return bytes.Contains(serial, []byte("Passed")) || bytes.Contains(serial, []byte("Failed")) ||
+			memoryStatus(bus) != STATUS_RUNNING
+	}
+
+	var result Result
+	for result.Frames < frames && !result.Done {
+		_, stopped, err := machine.RunFrameUntil(c, bus, done)
+		if err != nil {
+			result.Err = fmt.Errorf("%w at PC %s", err, c.FormatAddress(c.PC))
+			break
+		}
+
+		result.Done = stopped
+		if !stopped {
+			result.Frames++
+		}
+	}
+
+	for i := 0; result.Done && result.Err == nil && i < resultFrames; i++ {
+		if _, err := machine.RunFrame(c, bus); err != nil {
+			result.Err = fmt.Errorf("%w at PC %s", err, c.FormatAddress(c.PC))
+		}
+	}
+
+	result.Output = string(serial)
+	result.Status = memoryStatus(bus)
+	if len(serial) == 0 {
+		result.Output = memoryText(bus)
+	}
+	result.Failed = FailedTests(result.Output)
+
+	return result
+}
+
+// memoryStatus returns the result code written at 0xA000, STATUS_RUNNING until the signature is written
+func memoryStatus(bus *memory.Controller) byte {
+	header, err := bus.Peek(statusAddress, 1+len(signature))
+	if err != nil || !bytes.Equal(header[1:], signature) {
+		return STATUS_RUNNING
+	}
+
+	return header[0]
+}
+
+// memoryText returns the NUL terminated text written from 0xA004, empty without the signature
+func memoryText(bus *memory.Controller) string {
+	if memoryStatus(bus) == STATUS_RUNNING {
+		return ""
+	}
+
+	text, err := bus.Peek(textAddress, 0xC000-int(textAddress))
+	if err != nil {
+		return ""
+	}
+
+	if end := bytes.IndexByte(text, 0); end >= 0 {
+		text = text[:end]
+	}
+
+	return string(text)
+}
+
+// FailedTests returns the numbers of the sub-tests reported failing in the output of a ROM,
+// from the "03:01" lines of the multi test ROMs and the "Failed #3" of the single ones
+func FailedTests(output string) []int {
+	var failed []int
+	add := func(number string) {
+		test, _ := strconv.Atoi(number)
+		for _, f := range failed {
+			if f == test {
+				return
+			}
+		}
+		failed = append(failed, test)
+	}
+
+	for _, match := range subTestPattern.FindAllStringSubmatch(output, -1) {
+		if match[2] != "ok" {
+			add(match[1])
+		}
+	}
+
+	for _, match := range failedPattern.FindAllStringSubmatch(output, -1) {
+		add(match[1])
+	}
+
+	sort.Ints(failed)
+
+	return failed
+}
+
+// RunFile runs the ROM at path
+func RunFile(path string, frames int) Result {
+	rom, err := os.ReadFile(path)
+	if err != nil {
+		return Result{ROM: path, Err: err}
+	}
+
+	result := Run(rom, frames)
+	result.ROM = path
+
+	return result
+}
+
+// RunDirectory runs the ROMs of dir, sorted by name
+func RunDirectory(dir string, frames int) ([]Result, error) {
+	roms, err := romtest.ROMs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, len(roms))
+	for i, rom := range roms {
+		results[i] = RunFile(rom, frames)
+	}
+
+	return results, nil
+}
+
+// WriteMatrix writes a table of the results, one ROM per line, followed by the number of ROMs passing
+func WriteMatrix(w io.Writer, results []Result) error {
+	out := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(out, "ROM\tframes\tresult")
+
+	passed := 0
+	for _, result := range results {
+		if result.Passed() {
+			passed++
+		}
+
+		fmt.Fprintf(out, "%s\t%d\t%s\n", filepath.Base(result.ROM), result.Frames, result.Summary())
+	}
+
+	fmt.Fprintf(out, "\n%d/%d passed\n", passed, len(results))
+
+	return out.Flush()
+}
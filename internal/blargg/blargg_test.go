@@ -0,0 +1,97 @@
+package blargg
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/carvhal/gby/internal/testutils"
+)
+
+// newROM returns a ROM calling program after the header, ending in a JR NZ loop with B = 0xFF
+func newROM(program []byte) []byte {
+	rom := make([]byte, 0x8000)
+	copy(rom[0x0100:], []byte{0xCD, 0x50, 0x01}) // CALL $0150
+	rom[0x0147], rom[0x0149] = 0x03, 0x02        // MBC1 with 8KB of battery RAM
+
+	program = append(program, 0x06, 0x00, 0x05, 0x20, 0xFE) // LD B $00, DEC B, JR NZ $-2
+	copy(rom[0x0150:], program)
+
+	return rom
+}
+
+// serialROM returns a ROM sending text through serial
+func serialROM(text string) []byte {
+	var program []byte
+	for _, char := range []byte(text) {
+		program = append(program,
+			0x3E, char, // LD A char
+			0xE0, 0x01, // LDH [SB], A
+			0x3E, 0x81, // LD A $81
+			0xE0, 0x02, // LDH [SC], A
+			0x06, 0x00, // LD B $00
+			0x05,       // DEC B
+			0x20, 0xFD, // JR NZ $-3, 256 loops until the byte is shifted out
+		)
+	}
+
+	return newROM(program)
+}
+
+// memoryROM returns a ROM writing its status and text in cartridge RAM
+func memoryROM(status byte, text string) []byte {
+	program := []byte{
+		0x21, 0x00, 0x00, // LD HL $0000
+		0x3E, 0x0A, // LD A $0A
+		0x77, // LD [HL], A, RAM enabled
+	}
+
+	write := func(address uint16, values ...byte) {
+		for i, value := range values {
+			target := address + uint16(i)
+			program = append(program, 0x21, byte(target), byte(target>>8), 0x3E, value, 0x77)
+		}
+	}
+
+	write(statusAddress, STATUS_RUNNING)
+	write(statusAddress+1, signature...)
+	write(textAddress, append([]byte(text), 0)...)
+	write(statusAddress, status)
+
+	return newROM(program)
+}
+
+func TestSerial(t *testing.T) {
+	result := Run(serialROM("cpu_instrs\n\n01:ok  02:03  03:ok  04:01\n\nFailed 2 tests.\n"), 60)
+
+	Must(t, result.Err, "Expected the ROM to run: %v")
+	Expect(t, result.Done, "result reported").ToEqual(true)
+	Expect(t, strings.HasSuffix(result.Output, "Failed 2 tests.\n"), "output sent after Failed").ToEqual(true)
+	Expect(t, result.Failed, "failing sub-tests").ToEqual([]int{2, 4})
+	Expect(t, result.Passed(), "passed").ToEqual(false)
+	Expect(t, result.Summary(), "summary").ToEqual("FAIL #2 #4")
+
+	result = Run(serialROM("halt bug\n\nPassed\n"), 60)
+	Must(t, result.Err, "Expected the ROM to run: %v")
+	Expect(t, result.Passed(), "passed").ToEqual(true)
+}
+
+func TestMemory(t *testing.T) {
+	result := Run(memoryROM(0, "01-special\n\n\nPassed\n"), 60)
+
+	Must(t, result.Err, "Expected the ROM to run: %v")
+	Expect(t, result.Output, "text").ToEqual("01-special\n\n\nPassed\n")
+	Expect(t, result.Status, "status").ToEqual(byte(0))
+	Expect(t, result.Passed(), "passed").ToEqual(true)
+
+	result = Run(memoryROM(3, "instr_timing\n\n\nFailed #3\n"), 60)
+	Expect(t, result.Failed, "failing sub-tests").ToEqual([]int{3})
+	Expect(t, result.Passed(), "passed").ToEqual(false)
+}
+
+func TestTimeout(t *testing.T) {
+	result := Run(newROM(nil), 2)
+
+	Must(t, result.Err, "Expected the ROM to run: %v")
+	Expect(t, result.Frames, "frames").ToEqual(2)
+	Expect(t, result.Summary(), "summary").ToEqual("timeout")
+}
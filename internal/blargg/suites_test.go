@@ -0,0 +1,54 @@
+package blargg
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"testing"
+
+	"github.com/carvhal/gby/internal/romtest"
+	. "github.com/carvhal/gby/internal/testutils"
+)
+
+// testSuite runs the ROMs of dir as subtests, failing with the sub-tests they report failing,
+// it skips without the directory as the test ROMs are not distributed with the emulator
+func testSuite(t *testing.T, dir string, frames int) {
+	t.Helper()
+
+	roms, err := romtest.ROMs(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		t.Skipf("no test ROMs in %s", dir)
+	}
+	Must(t, err, "Expected to list the test ROMs: %v")
+
+	for _, rom := range roms {
+		t.Run(filepath.Base(rom), func(t *testing.T) {
+			result := RunFile(rom, frames)
+			Must(t, result.Err, "Expected the ROM to run: %v")
+			Expect(t, result.Done, fmt.Sprintf("result reported within %d frames", result.Frames)).ToEqual(true)
+			Expect(t, result.Failed, "failing sub-tests").ToEqual([]int(nil))
+			Expect(t, result.Passed(), "passed, output:\n"+result.Output).ToEqual(true)
+		})
+	}
+}
+
+func TestCPUInstrs(t *testing.T) {
+	testSuite(t, romtest.Dir("blargg/cpu_instrs"), 0)
+}
+
+func TestInstrTiming(t *testing.T) {
+	testSuite(t, romtest.Dir("blargg/instr_timing"), 0)
+}
+
+func TestMemTiming(t *testing.T) {
+	testSuite(t, romtest.Dir("blargg/mem_timing"), 0)
+}
+
+func TestHaltBug(t *testing.T) {
+	testSuite(t, romtest.Dir("blargg/halt_bug"), 0)
+}
+
+func TestOAMBug(t *testing.T) {
+	testSuite(t, romtest.Dir("blargg/oam_bug"), 0)
+}
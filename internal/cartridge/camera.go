@@ -0,0 +1,284 @@
+package cartridge
+
+import (
+	"fmt"
+
+	"github.com/carvhal/gby/internal/common"
+)
+
+/*
+* Pocket Camera
+*
+* address        | description
+*
+* 0x0000 0x1FFF  | RAM write enable (0x0A)
+* 0x2000 0x3FFF  | ROM bank (0x00 - 0x3F)
+* 0x4000 0x5FFF  | RAM bank (0x00 - 0x0F), bit 4 maps the camera registers instead
+*
+* camera registers (mirrored every 0x80 bytes on 0xA000 - 0xBFFF)
+*
+* 0x00        | bit 0: start capture / busy, only readable register
+* 0x01        | bit 7: N, bits 5-6: VH (edge enhancement when N and VH are all set), bits 0-4: gain
+* 0x02 0x03   | exposure time, big endian
+* 0x04        | bits 4-6: edge enhancement ratio, bit 3: invert output
+* 0x05        | output reference voltage
+* 0x06 0x35   | 4x4 dithering matrix, 3 thresholds per pixel
+*
+* captures are written to RAM bank 0 from 0xA100 as 16x14 tiles
+*
+ */
+
+const (
+	cameraRegisterBank = 0x10
+	cameraRegisters    = 0x36
+	cameraImageOffset  = 0x0100
+
+	// neutral exposure: pixels keep the brightness of the sensor image
+	cameraNeutralExposure = 0x0300
+)
+
+// edgeRatios are the edge enhancement ratios selected by bits 4-6 of register 0x04
+var edgeRatios = [8]float64{0.50, 0.75, 1.00, 1.25, 2.00, 3.00, 4.00, 5.00}
+
+// Camera is the Pocket Camera mapper (MAC-GBD), its sensor is replaced by a Sensor providing images
+type Camera struct {
+	rom        []byte
+	ram        []byte
+	romBank    int
+	ramBank    int
+	ramEnabled bool
+	registers  [cameraRegisters]byte
+	busy       int // clock cycles until the current capture completes
+	sensor     Sensor
+}
+
+func NewCamera(game []byte) *Camera {
+	return &Camera{
+		rom:     game,
+		ram:     make([]byte, 0x20000),
+		romBank: 1,
+	}
+}
+
+// SetSensor sets the image source of the camera, without a sensor captures see a uniform mid grey
+func (c *Camera) SetSensor(sensor Sensor) {
+	c.sensor = sensor
+}
+
+func (c *Camera) ReadROM(address uint16) byte {
+	return readBank(c.rom, c.ROMBank(address), address%romBankSize)
+}
+
+func (c *Camera) ROMBank(address uint16) int {
+	if address < romBankSize {
+		return 0
+	}
+
+	return wrapBank(c.rom, c.romBank)
+}
+
+func (c *Camera) WriteRegister(address uint16, value byte) {
+	switch {
+	case address <= 0x1FFF:
+		c.ramEnabled = value&0x0F == 0x0A
+	case address <= 0x3FFF:
+		c.romBank = int(value & 0x3F)
+	case address <= 0x5FFF:
+		c.ramBank = int(value & 0x1F)
+	}
+}
+
+func (c *Camera) ReadRAM(address uint16) byte {
+	if c.ramBank&cameraRegisterBank != 0 {
+		if address&0x7F == 0 {
+			return c.registers[0]
+		}
+		return 0x00
+	}
+
+	return c.ram[c.ramBank*ramBankSize+int(address-0xA000)]
+}
+
+func (c *Camera) WriteRAM(address uint16, value byte) {
+	if c.ramBank&cameraRegisterBank != 0 {
+		c.writeCameraRegister(byte(address&0x7F), value)
+		return
+	}
+
+	if c.ramEnabled {
+		c.ram[c.ramBank*ramBankSize+int(address-0xA000)] = value
+	}
+}
+
+// writeCameraRegister writes to the camera registers, setting bit 0 of register 0 starts a capture
+func (c *Camera) writeCameraRegister(register byte, value byte) {
+	if int(register) >= cameraRegisters {
+		return
+	}
+
+	if register != 0 {
+		c.registers[register] = value
+		return
+	}
+
+	start := value&0x01 != 0 && c.busy == 0
+	c.registers[0] = value & 0x07
+
+	switch {
+	case start:
+		c.busy = c.captureCycles()
+	case value&0x01 == 0:
+		// stopping a capture
+		c.busy = 0
+	}
+}
+
+// captureCycles returns the duration of a capture in clock cycles: 32446 machine cycles,
+// 512 more with N cleared, plus 16 per unit of exposure time
+func (c *Camera) captureCycles() int {
+	cycles := 32446 + 16*c.exposure()
+
+	if c.registers[1]&0x80 == 0 {
+		cycles += 512
+	}
+
+	return cycles * 4
+}
+
+// Step advances the capture in progress by the given number of clock cycles
+func (c *Camera) Step(cycles int) {
+	if c.busy == 0 {
+		return
+	}
+
+	c.busy -= cycles
+
+	if c.busy <= 0 {
+		c.busy = 0
+		c.capture()
+		c.registers[0] &^= 0x01
+	}
+}
+
+func (c *Camera) exposure() int {
+	return int(c.registers[2])<<8 | int(c.registers[3])
+}
+
+// capture runs the sensor image through exposure, edge enhancement and the dithering matrix
+// and writes the resulting 2bpp tiles to RAM bank 0
+func (c *Camera) capture() {
+	var pixels [sensorHeight][sensorWidth]int
+
+	if c.sensor != nil {
+		if img, err := c.sensor.Capture(); err == nil {
+			pixels = sensorPixels(img)
+		}
+	} else {
+		for y := range pixels {
+			for x := range pixels[y] {
+				pixels[y][x] = 0x80
+			}
+		}
+	}
+
+	exposure := c.exposure()
+	edgeEnhancement := c.registers[1]&0xE0 == 0xE0
+	ratio := edgeRatios[(c.registers[4]>>4)&0x07]
+	invert := c.registers[4]&0x08 != 0
+
+	exposed := func(x, y int) float64 {
+		x = min(max(x, 0), sensorWidth-1)
+		y = min(max(y, 0), sensorHeight-1)
+
+		return float64(pixels[y][x] * exposure / cameraNeutralExposure)
+	}
+
+	for y := 0; y < sensorHeight; y++ {
+		for x := 0; x < sensorWidth; x++ {
+			value := exposed(x, y)
+
+			if edgeEnhancement {
+				neighbours := exposed(x-1, y) + exposed(x+1, y) + exposed(x, y-1) + exposed(x, y+1)
+				value += (4*value - neighbours) * ratio
+			}
+
+			level := byte(min(max(value, 0), 0xFF))
+			if invert {
+				level = 0xFF - level
+			}
+
+			c.writeCapturedPixel(x, y, c.dither(x, y, level))
+		}
+	}
+}
+
+// dither converts a pixel level to a shade (0 white - 3 black) with the thresholds of the matrix cell of the pixel
+func (c *Camera) dither(x, y int, level byte) byte {
+	thresholds := c.registers[6+((y%4)*4+x%4)*3:]
+
+	switch {
+	case level < thresholds[0]:
+		return 3
+	case level < thresholds[1]:
+		return 2
+	case level < thresholds[2]:
+		return 1
+	}
+
+	return 0
+}
+
+// writeCapturedPixel writes a shade to the 2bpp tile data of the captured image
+func (c *Camera) writeCapturedPixel(x, y int, shade byte) {
+	tile := (y/8)*(sensorWidth/8) + x/8
+	offset := cameraImageOffset + tile*16 + (y%8)*2
+	bit := byte(0x80) >> (x % 8)
+
+	c.ram[offset] &^= bit
+	c.ram[offset+1] &^= bit
+
+	if shade&0x01 != 0 {
+		c.ram[offset] |= bit
+	}
+	if shade&0x02 != 0 {
+		c.ram[offset+1] |= bit
+	}
+}
+
+// SaveBattery returns the RAM, holding the saved pictures
+func (c *Camera) SaveBattery() []byte {
+	return append([]byte(nil), c.ram...)
+}
+
+func (c *Camera) LoadBattery(data []byte) error {
+	if len(data) != len(c.ram) {
+		return fmt.Errorf("camera: battery save must be %d bytes, got %d", len(c.ram), len(data))
+	}
+
+	copy(c.ram, data)
+	return nil
+}
+
+func (c *Camera) SaveState() []byte {
+	var state common.StateEncoder
+	state.Int(c.romBank)
+	state.Int(c.ramBank)
+	state.Bool(c.ramEnabled)
+	state.Bytes(c.registers[:])
+	state.Int(c.busy)
+	state.Bytes(c.ram)
+
+	return state.Data
+}
+
+func (c *Camera) LoadState(data []byte) error {
+	state := common.StateDecoder{Data: data}
+	c.romBank = state.Int()
+	c.ramBank = state.Int()
+	c.ramEnabled = state.Bool()
+	state.Bytes(c.registers[:])
+	c.busy = state.Int()
+	state.Bytes(c.ram)
+
+	return state.Err("camera")
+}
@@ -0,0 +1,92 @@
+package cartridge
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	. "github.com/carvhal/gby/internal/testutils"
+)
+
+// cameraROM returns a 1MB Pocket Camera ROM where every bank starts with its bank number
+func cameraROM() []byte {
+	rom := make([]byte, 0x100000)
+	for bank := 0; bank < 64; bank++ {
+		rom[bank*romBankSize] = byte(bank)
+	}
+	rom[0x0147], rom[0x0148], rom[0x0149] = POCKET_CAMERA, 0x05, 0x04
+
+	return rom
+}
+
+// capturedShade reads back the shade of a pixel from the 2bpp tiles written to RAM bank 0
+func capturedShade(c *Camera, x, y int) byte {
+	offset := cameraImageOffset + ((y/8)*16+x/8)*16 + (y%8)*2
+	bit := 7 - x%8
+
+	return (c.ram[offset]>>bit)&1 | ((c.ram[offset+1]>>bit)&1)<<1
+}
+
+func TestCameraBanking(t *testing.T) {
+	c, ok := New(cameraROM()).(*Camera)
+	Expect(t, ok, "camera selected from the header").ToEqual(true)
+
+	c.WriteRegister(0x2000, 0x3F)
+	Expect(t, c.ReadROM(0x4000), "ROM bank 0x3F").ToEqual(byte(0x3F))
+
+	c.WriteRegister(0x0000, 0x0A)
+	c.WriteRegister(0x4000, 0x0F)
+	c.WriteRAM(0xBFFF, 0x42)
+	Expect(t, c.ram[0x1FFFF], "RAM bank 0x0F").ToEqual(byte(0x42))
+
+	c.WriteRegister(0x4000, 0x10)
+	c.WriteRAM(0xA001, 0x55)
+	Expect(t, c.ReadRAM(0xA001), "write only register").ToEqual(byte(0x00))
+	Expect(t, c.registers[1], "register 1").ToEqual(byte(0x55))
+}
+
+func TestCameraCapture(t *testing.T) {
+	// left half white, right half black
+	img := image.NewGray(image.Rect(0, 0, 256, 224))
+	for y := 0; y < 224; y++ {
+		for x := 0; x < 128; x++ {
+			img.SetGray(x, y, color.Gray{Y: 0xFF})
+		}
+	}
+
+	c := NewCamera(cameraROM())
+	c.SetSensor(NewImageSequence(img))
+	c.WriteRegister(0x4000, 0x10)
+
+	// neutral exposure, N set, no edge enhancement
+	c.WriteRAM(0xA001, 0x80)
+	c.WriteRAM(0xA002, 0x03)
+	c.WriteRAM(0xA003, 0x00)
+	for i := uint16(0); i < 16; i++ {
+		c.WriteRAM(0xA006+i*3, 0x40)
+		c.WriteRAM(0xA007+i*3, 0x80)
+		c.WriteRAM(0xA008+i*3, 0xC0)
+	}
+
+	c.WriteRAM(0xA000, 0x01)
+	Expect(t, c.ReadRAM(0xA000)&0x01, "busy").ToEqual(byte(0x01))
+
+	c.Step(c.captureCycles() - 4)
+	Expect(t, c.ReadRAM(0xA000)&0x01, "still busy").ToEqual(byte(0x01))
+
+	c.Step(4)
+	Expect(t, c.ReadRAM(0xA000)&0x01, "capture done").ToEqual(byte(0x00))
+
+	Expect(t, capturedShade(c, 0, 0), "white pixel").ToEqual(byte(0))
+	Expect(t, capturedShade(c, 63, 111), "white pixel").ToEqual(byte(0))
+	Expect(t, capturedShade(c, 64, 0), "black pixel").ToEqual(byte(3))
+	Expect(t, capturedShade(c, 127, 111), "black pixel").ToEqual(byte(3))
+
+	// inverted output
+	c.WriteRAM(0xA004, 0x08)
+	c.WriteRAM(0xA000, 0x01)
+	c.Step(c.captureCycles())
+
+	Expect(t, capturedShade(c, 0, 0), "inverted white pixel").ToEqual(byte(3))
+	Expect(t, capturedShade(c, 64, 0), "inverted black pixel").ToEqual(byte(0))
+}
@@ -0,0 +1,126 @@
+package cartridge
+
+import "fmt"
+
+/*
+* Header
+*
+* address | description
+*
+* 0x0134  | title (up to 16 bytes)
+* 0x0143  | CGB flag
+* 0x0146  | SGB flag
+* 0x0147  | cartridge type
+* 0x0148  | ROM size (32KB << n)
+* 0x0149  | RAM size
+*
+ */
+
+const (
+	romBankSize = 0x4000
+	ramBankSize = 0x2000
+)
+
+// cartridge type codes (header byte 0x0147)
+const (
+	ROM_ONLY          byte = 0x00
+	MBC1_ROM          byte = 0x01
+	MBC1_RAM          byte = 0x02
+	MBC1_RAM_BATTERY  byte = 0x03
+	MMM01_ROM         byte = 0x0B
+	MMM01_RAM         byte = 0x0C
+	MMM01_RAM_BATTERY byte = 0x0D
+	MBC7_SENSOR       byte = 0x22
+	POCKET_CAMERA     byte = 0xFC
+	HUC3              byte = 0xFE
+	HUC1              byte = 0xFF
+)
+
+// Mapper is the memory bank controller of a cartridge, the bus delegates the ROM (0x0000 - 0x7FFF)
+// and RAM (0xA000 - 0xBFFF) ranges to it, addresses are CPU addresses
+type Mapper interface {
+	ReadROM(address uint16) byte
+	WriteRegister(address uint16, value byte) // writes to 0x0000 - 0x7FFF control the banking
+	ReadRAM(address uint16) byte
+	WriteRAM(address uint16, value byte)
+
+	// SaveBattery returns the data kept after power off (RAM, EEPROM, clock), nothing without a battery
+	SaveBattery() []byte
+	LoadBattery(data []byte) error
+
+	// SaveState returns the registers and memories of the mapper, for save states of the whole machine
+	SaveState() []byte
+	LoadState(data []byte) error
+}
+
+// Banked is implemented by the mappers able to tell which 16KB ROM bank an address of 0x0000 - 0x7FFF reads,
+// banks past the end of the ROM wrap around like the reads do
+type Banked interface {
+	ROMBank(address uint16) int
+}
+
+// Factory builds the mapper of a ROM
+type Factory func(game []byte, header Header) Mapper
+
+// Header holds the fields of the cartridge header used to select and configure the cartridge type
+type Header struct {
+	Title   string
+	Type    byte
+	ROMSize int // in bytes
+	RAMSize int // in bytes
+}
+
+// ramSizes maps the header RAM size code to a size in bytes
+var ramSizes = map[byte]int{
+	0x00: 0,
+	0x01: 0x800,
+	0x02: 0x2000,
+	0x03: 0x8000,
+	0x04: 0x20000,
+	0x05: 0x10000,
+}
+
+// ParseHeader reads the cartridge header of a ROM
+func ParseHeader(game []byte) (Header, error) {
+	if len(game) < 0x0150 {
+		return Header{}, fmt.Errorf("rom too small to hold a header (%d bytes)", len(game))
+	}
+
+	title := game[0x0134:0x0144]
+	for i, c := range title {
+		if c == 0 {
+			title = title[:i]
+			break
+		}
+	}
+
+	return Header{
+		Title:   string(title),
+		Type:    game[0x0147],
+		ROMSize: romBankSize * 2 << game[0x0148],
+		RAMSize: ramSizes[game[0x0149]],
+	}, nil
+}
+
+// New returns the mapper detected for the ROM,
+// ROMs without a valid header or of an unsupported type are mapped flat
+func New(game []byte) Mapper {
+	return NewKind(game, Detect(game))
+}
+
+// ramOffset returns the offset in ram of address (0xA000 - 0xBFFF) in an 8KB RAM bank, wrapping around small RAMs
+func ramOffset(ram []byte, bank int, address uint16) int {
+	return (bank*ramBankSize + int(address-0xA000)) % len(ram)
+}
+
+// wrapBank returns the bank of the ROM read when bank is selected
+func wrapBank(rom []byte, bank int) int {
+	return bank % max(len(rom)/romBankSize, 1)
+}
+
+// readBank reads address (0x0000 - 0x3FFF) from a 16KB ROM bank, banks past the end of the ROM wrap around
+func readBank(rom []byte, bank int, address uint16) byte {
+	offset := (bank*romBankSize + int(address)) % len(rom)
+
+	return rom[offset]
+}
@@ -0,0 +1,207 @@
+package cartridge
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Kind names a banking scheme, it is what the header or the checksum database resolve a ROM to
+type Kind string
+
+const (
+	KIND_ROM         Kind = "rom"
+	KIND_MBC1        Kind = "mbc1"
+	KIND_MBC1M       Kind = "mbc1m"
+	KIND_MMM01       Kind = "mmm01"
+	KIND_MBC7        Kind = "mbc7"
+	KIND_CAMERA      Kind = "camera"
+	KIND_HUC1        Kind = "huc1"
+	KIND_HUC3        Kind = "huc3"
+	KIND_SACHEN      Kind = "sachen"
+	KIND_WISDOM_TREE Kind = "wisdomtree"
+)
+
+// factories maps every banking scheme to the factory of its mapper
+var factories = map[Kind]Factory{
+	KIND_ROM:         func(game []byte, header Header) Mapper { return NewROM(game) },
+	KIND_MBC1:        func(game []byte, header Header) Mapper { return NewMBC1(game, header, false) },
+	KIND_MBC1M:       func(game []byte, header Header) Mapper { return NewMBC1(game, header, true) },
+	KIND_MMM01:       func(game []byte, header Header) Mapper { return NewMMM01(game, header) },
+	KIND_MBC7:        func(game []byte, header Header) Mapper { return NewMBC7(game) },
+	KIND_CAMERA:      func(game []byte, header Header) Mapper { return NewCamera(game) },
+	KIND_HUC1:        func(game []byte, header Header) Mapper { return NewHuC1(game, header) },
+	KIND_HUC3:        func(game []byte, header Header) Mapper { return NewHuC3(game, header) },
+	KIND_SACHEN:      func(game []byte, header Header) Mapper { return NewSachen(game) },
+	KIND_WISDOM_TREE: func(game []byte, header Header) Mapper { return NewWisdomTree(game) },
+}
+
+// headerKinds maps the cartridge type byte to a banking scheme
+var headerKinds = map[byte]Kind{
+	ROM_ONLY:          KIND_ROM,
+	MBC1_ROM:          KIND_MBC1,
+	MBC1_RAM:          KIND_MBC1,
+	MBC1_RAM_BATTERY:  KIND_MBC1,
+	MMM01_ROM:         KIND_MMM01,
+	MMM01_RAM:         KIND_MMM01,
+	MMM01_RAM_BATTERY: KIND_MMM01,
+	MBC7_SENSOR:       KIND_MBC7,
+	POCKET_CAMERA:     KIND_CAMERA,
+	HUC3:              KIND_HUC3,
+	HUC1:              KIND_HUC1,
+}
+
+// Register adds a banking scheme, selected for ROMs whose header has one of the cartridge types,
+// registering an existing kind or type replaces it
+func Register(kind Kind, factory Factory, cartridgeTypes ...byte) {
+	factories[kind] = factory
+	for _, cartridgeType := range cartridgeTypes {
+		headerKinds[cartridgeType] = kind
+	}
+}
+
+// checksumDatabase maps the CRC32 of whole ROMs to their banking scheme,
+// for the dumps whose header does not describe the cartridge (most unlicensed games)
+var checksumDatabase = map[uint32]Kind{}
+
+// nintendoLogo is the logo stored at 0x0104 - 0x0133 of the header
+var nintendoLogo = []byte{
+	0xCE, 0xED, 0x66, 0x66, 0xCC, 0x0D, 0x00, 0x0B, 0x03, 0x73, 0x00, 0x83, 0x00, 0x0C, 0x00, 0x0D,
+	0x00, 0x08, 0x11, 0x1F, 0x88, 0x89, 0x00, 0x0E, 0xDC, 0xCC, 0x6E, 0xE6, 0xDD, 0xDD, 0xD9, 0x99,
+	0xBB, 0xBB, 0x67, 0x63, 0x6E, 0x0E, 0xEC, 0xCC, 0xDD, 0xDC, 0x99, 0x9F, 0xBB, 0xB9, 0x33, 0x3E,
+}
+
+// RegisterChecksum adds a ROM to the checksum database, crc is the CRC32 (IEEE) of the whole ROM
+func RegisterChecksum(crc uint32, kind Kind) {
+	checksumDatabase[crc] = kind
+}
+
+// LoadChecksumDatabase adds the entries of a text database to the checksum database,
+// one "<crc32 in hex> <kind>" entry per line, text after # is ignored
+func LoadChecksumDatabase(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) != 2 {
+			return fmt.Errorf("checksum database line %d: expected \"<crc32> <kind>\", got %q", line, text)
+		}
+
+		crc, err := strconv.ParseUint(strings.TrimPrefix(fields[0], "0x"), 16, 32)
+		if err != nil {
+			return fmt.Errorf("checksum database line %d: %w", line, err)
+		}
+
+		kind, err := ParseKind(fields[1])
+		if err != nil {
+			return fmt.Errorf("checksum database line %d: %w", line, err)
+		}
+
+		RegisterChecksum(uint32(crc), kind)
+	}
+
+	return scanner.Err()
+}
+
+// ParseKind returns the banking scheme named name
+func ParseKind(name string) (Kind, error) {
+	kind := Kind(strings.ToLower(name))
+	if _, ok := factories[kind]; !ok {
+		return "", fmt.Errorf("unknown mapper %q", name)
+	}
+
+	return kind, nil
+}
+
+// Detect returns the banking scheme of a ROM: the checksum database is looked up first,
+// then the header, corrected by heuristics for the multicarts that do not describe themselves
+func Detect(game []byte) Kind {
+	if kind, ok := checksumDatabase[crc32.ChecksumIEEE(game)]; ok {
+		return kind
+	}
+
+	header, err := ParseHeader(game)
+	if err != nil {
+		return KIND_ROM
+	}
+
+	// MMM01 multicarts keep the header of the menu in the last 32KB, the first bank holds the header of a game
+	if len(game) > wisdomTreeBankSize {
+		menu := game[len(game)-wisdomTreeBankSize:]
+		if bytes.Equal(menu[0x0104:0x0134], nintendoLogo) && headerKinds[menu[0x0147]] == KIND_MMM01 {
+			return KIND_MMM01
+		}
+	}
+
+	kind, ok := headerKinds[header.Type]
+	if !ok {
+		return KIND_ROM
+	}
+
+	switch {
+	case kind == KIND_MBC1 && isMBC1Multicart(game):
+		return KIND_MBC1M
+	case kind == KIND_ROM && len(game) > wisdomTreeBankSize:
+		if isSachen(game) {
+			return KIND_SACHEN
+		}
+		if isWisdomTree(game) {
+			return KIND_WISDOM_TREE
+		}
+	}
+
+	return kind
+}
+
+// isMBC1Multicart reports whether a 1MB MBC1 ROM holds a second game header at bank 0x10, as the MBC1M collections do
+func isMBC1Multicart(game []byte) bool {
+	const second = 0x10 * romBankSize
+
+	return len(game) == 0x100000 && bytes.Equal(game[second+0x0104:second+0x0134], nintendoLogo)
+}
+
+// isSachen reports whether the logo only matches once read with the address lines the Sachen mappers swap (A0-A6, A1-A4)
+func isSachen(game []byte) bool {
+	if bytes.Equal(game[0x0104:0x0134], nintendoLogo) {
+		return false
+	}
+
+	for i, b := range nintendoLogo {
+		address := 0x0104 + i
+		scrambled := address&^0x53 | address&0x01<<6 | address&0x40>>6 | address&0x02<<3 | address&0x10>>3
+		if game[scrambled] != b {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isWisdomTree reports whether the first bank carries the Wisdom Tree name
+func isWisdomTree(game []byte) bool {
+	bank := game[:romBankSize]
+
+	return bytes.Contains(bank, []byte("WISDOM TREE")) || bytes.Contains(bank, []byte("WISDOM\x00TREE"))
+}
+
+// NewKind returns the mapper of the given banking scheme, regardless of the header,
+// unknown schemes are mapped flat
+func NewKind(game []byte, kind Kind) Mapper {
+	factory, ok := factories[kind]
+	if !ok {
+		factory = factories[KIND_ROM]
+	}
+
+	header, _ := ParseHeader(game)
+
+	return factory(game, header)
+}
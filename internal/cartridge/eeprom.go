@@ -0,0 +1,209 @@
+package cartridge
+
+import "github.com/carvhal/gby/internal/common"
+
+/*
+* 93LC56 serial EEPROM (128 16-bit words), driven bit by bit through the MBC7 EEPROM register
+*
+* every command starts with a 1 bit on DI, followed by 2 opcode bits and 8 address bits (MSB first),
+* bits are sampled on the rising edge of CLK while CS is high
+*
+* command | opcode | address    | description
+*
+* READ    | 10     | xAAAAAAA   | a dummy 0 then the 16 bits of the word are shifted out on DO
+* WRITE   | 01     | xAAAAAAA   | followed by 16 data bits
+* ERASE   | 11     | xAAAAAAA   | the word is set to 0xFFFF
+* EWEN    | 00     | 11xxxxxx   | enable writes
+* EWDS    | 00     | 00xxxxxx   | disable writes
+* WRAL    | 00     | 01xxxxxx   | followed by 16 data bits, written to every word
+* ERAL    | 00     | 10xxxxxx   | every word is set to 0xFFFF
+*
+ */
+
+const (
+	eepromCS  byte = 0x80
+	eepromCLK byte = 0x40
+	eepromDI  byte = 0x02
+	eepromDO  byte = 0x01
+
+	eepromCommandBits = 10
+)
+
+// eepromState is the step of the command being received
+type eepromState byte
+
+const (
+	eepromIdle    eepromState = iota // waiting for the start bit
+	eepromCommand                    // receiving the opcode and the address
+	eepromData                       // receiving the 16 data bits of WRITE / WRAL
+	eepromRead                       // shifting out a word
+)
+
+type eeprom93LC56 struct {
+	words        [128]uint16
+	writeEnabled bool
+
+	state   eepromState
+	cs, clk bool
+	do      bool
+	shift   uint16 // bits received, or the word being shifted out
+	bits    int    // number of bits received / sent
+	command uint16
+}
+
+// reset erases every word, the state of a blank chip
+func (e *eeprom93LC56) reset() {
+	for i := range e.words {
+		e.words[i] = 0xFFFF
+	}
+	e.do = true
+}
+
+// read returns the register value: the last written pins and DO
+func (e *eeprom93LC56) read() byte {
+	var value byte
+
+	if e.cs {
+		value |= eepromCS
+	}
+	if e.clk {
+		value |= eepromCLK
+	}
+	if e.do {
+		value |= eepromDO
+	}
+
+	return value
+}
+
+// write sets the CS, CLK and DI pins, clocking a bit in or out on the rising edge of CLK
+func (e *eeprom93LC56) write(value byte) {
+	cs, clk, di := value&eepromCS != 0, value&eepromCLK != 0, value&eepromDI != 0
+	risingEdge := clk && !e.clk
+
+	e.cs, e.clk = cs, clk
+
+	if !cs {
+		e.state = eepromIdle
+		return
+	}
+
+	if !risingEdge {
+		return
+	}
+
+	switch e.state {
+	case eepromIdle:
+		if di {
+			e.state, e.shift, e.bits = eepromCommand, 0, 0
+		}
+	case eepromCommand:
+		e.shiftIn(di)
+		if e.bits == eepromCommandBits {
+			e.runCommand()
+		}
+	case eepromData:
+		e.shiftIn(di)
+		if e.bits == 16 {
+			e.writeData(e.shift)
+			e.state = eepromIdle
+		}
+	case eepromRead:
+		e.do = e.shift&0x8000 != 0
+		e.shift <<= 1
+		e.bits++
+		if e.bits == 16 {
+			e.state = eepromIdle
+		}
+	}
+}
+
+func (e *eeprom93LC56) shiftIn(bit bool) {
+	e.shift <<= 1
+	if bit {
+		e.shift |= 1
+	}
+	e.bits++
+}
+
+// runCommand decodes the opcode and address once all of their bits are received
+func (e *eeprom93LC56) runCommand() {
+	e.command = e.shift
+	opcode, address := (e.command>>8)&0x03, e.command&0x7F
+	e.state, e.shift, e.bits = eepromIdle, 0, 0
+
+	switch opcode {
+	case 0x02: // READ
+		e.state, e.shift = eepromRead, e.words[address]
+		e.do = false // dummy bit
+	case 0x01: // WRITE
+		e.state = eepromData
+	case 0x03: // ERASE
+		if e.writeEnabled {
+			e.words[address] = 0xFFFF
+		}
+		e.do = true
+	case 0x00:
+		switch (e.command >> 6) & 0x03 {
+		case 0x03: // EWEN
+			e.writeEnabled = true
+		case 0x00: // EWDS
+			e.writeEnabled = false
+		case 0x01: // WRAL
+			e.state = eepromData
+		case 0x02: // ERAL
+			if e.writeEnabled {
+				for i := range e.words {
+					e.words[i] = 0xFFFF
+				}
+			}
+			e.do = true
+		}
+	}
+}
+
+// writeData stores the data bits of a WRITE or WRAL command, DO reports ready afterwards
+func (e *eeprom93LC56) writeData(data uint16) {
+	e.do = true
+
+	if !e.writeEnabled {
+		return
+	}
+
+	if e.command>>8&0x03 == 0x01 {
+		e.words[e.command&0x7F] = data
+		return
+	}
+
+	for i := range e.words {
+		e.words[i] = data
+	}
+}
+
+func (e *eeprom93LC56) saveState(state *common.StateEncoder) {
+	for _, word := range e.words {
+		state.Uint16(word)
+	}
+	state.Bool(e.writeEnabled)
+	state.Byte(byte(e.state))
+	state.Bool(e.cs)
+	state.Bool(e.clk)
+	state.Bool(e.do)
+	state.Uint16(e.shift)
+	state.Int(e.bits)
+	state.Uint16(e.command)
+}
+
+func (e *eeprom93LC56) loadState(state *common.StateDecoder) {
+	for i := range e.words {
+		e.words[i] = state.Uint16()
+	}
+	e.writeEnabled = state.Bool()
+	e.state = eepromState(state.Byte())
+	e.cs = state.Bool()
+	e.clk = state.Bool()
+	e.do = state.Bool()
+	e.shift = state.Uint16()
+	e.bits = state.Int()
+	e.command = state.Uint16()
+}
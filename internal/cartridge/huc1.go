@@ -0,0 +1,114 @@
+package cartridge
+
+import (
+	"fmt"
+
+	"github.com/carvhal/gby/internal/common"
+)
+
+/*
+* HuC1
+*
+* address        | description
+*
+* 0x0000 0x1FFF  | 0x0E maps the IR port on 0xA000 - 0xBFFF, any other value maps the RAM
+* 0x2000 0x3FFF  | ROM bank (0x01 - 0x3F)
+* 0x4000 0x5FFF  | RAM bank (0x00 - 0x03)
+*
+ */
+
+// HuC1 is the Hudson mapper with an infrared port mapped in the cartridge RAM space
+type HuC1 struct {
+	rom      []byte
+	ram      []byte
+	romBank  int
+	ramBank  int
+	irMode   bool
+	infrared Infrared
+}
+
+func NewHuC1(game []byte, header Header) *HuC1 {
+	return &HuC1{
+		rom:     game,
+		ram:     make([]byte, max(header.RAMSize, ramBankSize)),
+		romBank: 1,
+	}
+}
+
+// SetInfrared connects the IR port of the cartridge
+func (h *HuC1) SetInfrared(infrared Infrared) {
+	h.infrared = infrared
+}
+
+func (h *HuC1) ReadROM(address uint16) byte {
+	return readBank(h.rom, h.ROMBank(address), address%romBankSize)
+}
+
+func (h *HuC1) ROMBank(address uint16) int {
+	if address < romBankSize {
+		return 0
+	}
+
+	return wrapBank(h.rom, h.romBank)
+}
+
+func (h *HuC1) WriteRegister(address uint16, value byte) {
+	switch {
+	case address <= 0x1FFF:
+		h.irMode = value&0x0F == 0x0E
+	case address <= 0x3FFF:
+		h.romBank = max(int(value&0x3F), 1)
+	case address <= 0x5FFF:
+		h.ramBank = int(value & 0x03)
+	}
+}
+
+func (h *HuC1) ReadRAM(address uint16) byte {
+	if h.irMode {
+		return readInfrared(h.infrared)
+	}
+
+	return h.ram[ramOffset(h.ram, h.ramBank, address)]
+}
+
+func (h *HuC1) WriteRAM(address uint16, value byte) {
+	if h.irMode {
+		writeInfrared(h.infrared, value)
+		return
+	}
+
+	h.ram[ramOffset(h.ram, h.ramBank, address)] = value
+}
+
+func (h *HuC1) SaveBattery() []byte {
+	return append([]byte(nil), h.ram...)
+}
+
+func (h *HuC1) LoadBattery(data []byte) error {
+	if len(data) != len(h.ram) {
+		return fmt.Errorf("huc1: battery save must be %d bytes, got %d", len(h.ram), len(data))
+	}
+
+	copy(h.ram, data)
+	return nil
+}
+
+func (h *HuC1) SaveState() []byte {
+	var state common.StateEncoder
+	state.Int(h.romBank)
+	state.Int(h.ramBank)
+	state.Bool(h.irMode)
+	state.Bytes(h.ram)
+
+	return state.Data
+}
+
+func (h *HuC1) LoadState(data []byte) error {
+	state := common.StateDecoder{Data: data}
+	h.romBank = state.Int()
+	h.ramBank = state.Int()
+	h.irMode = state.Bool()
+	state.Bytes(h.ram)
+
+	return state.Err("huc1")
+}
@@ -0,0 +1,270 @@
+package cartridge
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/carvhal/gby/internal/common"
+)
+
+/*
+* HuC3
+*
+* address        | description
+*
+* 0x0000 0x1FFF  | mode of 0xA000 - 0xBFFF (see below)
+* 0x2000 0x3FFF  | ROM bank (0x00 - 0x7F)
+* 0x4000 0x5FFF  | RAM bank (0x00 - 0x03)
+*
+* mode | description
+*
+* 0x0  | RAM, read only
+* 0xA  | RAM, read / write
+* 0xB  | RTC command write: bits 4-6 command, bits 0-3 argument
+* 0xC  | RTC response read: 0x80 | command << 4 | response
+* 0xD  | RTC semaphore: reads 0x01 when ready, writing bit 0 cleared runs the last command
+* 0xE  | IR port
+*
+* RTC commands operate on a 256 nibbles memory through an address register
+*
+* command | description
+*
+* 0x1     | read the nibble at the address, then increment the address
+* 0x3     | write the argument at the address, then increment the address
+* 0x4     | set the low nibble of the address
+* 0x5     | set the high nibble of the address
+* 0x6     | extended: 0x0 copy the clock to 0x00 - 0x05, 0x1 set the clock from 0x00 - 0x05,
+*         |           0x2 status (responds 0x1), 0xE play the tone selected by the nibble at 0x26
+*
+* the clock is made of the minute of the day (0x00 - 0x02) and a day counter (0x03 - 0x05), LSB nibble first
+*
+ */
+
+const (
+	minutesPerDay = 24 * 60
+	huc3DayWrap   = 0x1000
+)
+
+// HuC3 is the Hudson mapper with a command based real time clock, a tone generator and an infrared port
+type HuC3 struct {
+	rom      []byte
+	ram      []byte
+	romBank  int
+	ramBank  int
+	mode     byte
+	infrared Infrared
+
+	rtcMemory  [256]byte // nibbles
+	rtcAddress byte
+	command    byte // last command written in mode 0xB
+	response   byte
+	clockBase  time.Time // time at which the clock read 0 minutes, 0 days
+	now        func() time.Time
+	tone       func(tone byte)
+}
+
+func NewHuC3(game []byte, header Header) *HuC3 {
+	h := &HuC3{
+		rom:     game,
+		ram:     make([]byte, max(header.RAMSize, ramBankSize)),
+		romBank: 1,
+		now:     time.Now,
+	}
+	h.clockBase = h.now()
+
+	return h
+}
+
+// SetInfrared connects the IR port of the cartridge
+func (h *HuC3) SetInfrared(infrared Infrared) {
+	h.infrared = infrared
+}
+
+// SetClock replaces the source of the current time, the clock keeps its current value
+func (h *HuC3) SetClock(now func() time.Time) {
+	elapsed := h.now().Sub(h.clockBase)
+	h.now = now
+	h.clockBase = now().Add(-elapsed)
+}
+
+// OnTone registers a function called when the game plays a tone through the tone generator
+func (h *HuC3) OnTone(listener func(tone byte)) {
+	h.tone = listener
+}
+
+func (h *HuC3) ReadROM(address uint16) byte {
+	return readBank(h.rom, h.ROMBank(address), address%romBankSize)
+}
+
+func (h *HuC3) ROMBank(address uint16) int {
+	if address < romBankSize {
+		return 0
+	}
+
+	return wrapBank(h.rom, h.romBank)
+}
+
+func (h *HuC3) WriteRegister(address uint16, value byte) {
+	switch {
+	case address <= 0x1FFF:
+		h.mode = value & 0x0F
+	case address <= 0x3FFF:
+		h.romBank = int(value & 0x7F)
+	case address <= 0x5FFF:
+		h.ramBank = int(value & 0x03)
+	}
+}
+
+func (h *HuC3) ReadRAM(address uint16) byte {
+	switch h.mode {
+	case 0x0, 0xA:
+		return h.ram[ramOffset(h.ram, h.ramBank, address)]
+	case 0xC:
+		return 0x80 | h.command&0x70 | h.response
+	case 0xD:
+		return 0x01
+	case 0xE:
+		return readInfrared(h.infrared)
+	}
+
+	return 0xFF
+}
+
+func (h *HuC3) WriteRAM(address uint16, value byte) {
+	switch h.mode {
+	case 0xA:
+		h.ram[ramOffset(h.ram, h.ramBank, address)] = value
+	case 0xB:
+		h.command = value & 0x7F
+	case 0xD:
+		if value&0x01 == 0 {
+			h.runCommand()
+		}
+	case 0xE:
+		writeInfrared(h.infrared, value)
+	}
+}
+
+// runCommand executes the last command written in mode 0xB
+func (h *HuC3) runCommand() {
+	argument := h.command & 0x0F
+
+	switch h.command >> 4 {
+	case 0x1:
+		h.response = h.rtcMemory[h.rtcAddress] & 0x0F
+		h.rtcAddress++
+	case 0x3:
+		h.rtcMemory[h.rtcAddress] = argument
+		h.rtcAddress++
+	case 0x4:
+		h.rtcAddress = h.rtcAddress&0xF0 | argument
+	case 0x5:
+		h.rtcAddress = h.rtcAddress&0x0F | argument<<4
+	case 0x6:
+		h.extendedCommand(argument)
+	}
+}
+
+func (h *HuC3) extendedCommand(argument byte) {
+	switch argument {
+	case 0x0:
+		minutes, days := h.clock()
+		writeNibbles(h.rtcMemory[0x00:0x03], minutes)
+		writeNibbles(h.rtcMemory[0x03:0x06], days)
+	case 0x1:
+		minutes, days := readNibbles(h.rtcMemory[0x00:0x03]), readNibbles(h.rtcMemory[0x03:0x06])
+		h.setClock(minutes, days)
+	case 0x2:
+		h.response = 0x1
+	case 0xE:
+		if h.tone != nil {
+			h.tone(h.rtcMemory[0x26])
+		}
+	}
+}
+
+// clock returns the minute of the day and the day counter
+func (h *HuC3) clock() (minutes, days int) {
+	elapsed := int(h.now().Sub(h.clockBase) / time.Minute)
+
+	return elapsed % minutesPerDay, (elapsed / minutesPerDay) % huc3DayWrap
+}
+
+// setClock sets the minute of the day and the day counter
+func (h *HuC3) setClock(minutes, days int) {
+	elapsed := time.Duration(days*minutesPerDay+minutes) * time.Minute
+	h.clockBase = h.now().Add(-elapsed)
+}
+
+// writeNibbles stores a value in nibbles, LSB first
+func writeNibbles(nibbles []byte, value int) {
+	for i := range nibbles {
+		nibbles[i] = byte(value>>(i*4)) & 0x0F
+	}
+}
+
+// readNibbles reads a value stored in nibbles, LSB first
+func readNibbles(nibbles []byte) int {
+	value := 0
+	for i := range nibbles {
+		value |= int(nibbles[i]&0x0F) << (i * 4)
+	}
+
+	return value
+}
+
+// SaveBattery returns the RAM, the time the clock was started at (unix seconds, little endian),
+// so the clock keeps running while the emulator is off, and the RTC memory, one nibble per byte
+func (h *HuC3) SaveBattery() []byte {
+	data := append([]byte(nil), h.ram...)
+	data = binary.LittleEndian.AppendUint64(data, uint64(h.clockBase.Unix()))
+
+	return append(data, h.rtcMemory[:]...)
+}
+
+// LoadBattery restores RAM, the clock and the RTC memory (alarm, tone...),
+// saves written before the RTC memory was kept only restore RAM and the clock
+func (h *HuC3) LoadBattery(data []byte) error {
+	size := len(h.ram) + 8
+	if len(data) != size && len(data) != size+len(h.rtcMemory) {
+		return fmt.Errorf("huc3: battery save must be %d bytes, got %d", size+len(h.rtcMemory), len(data))
+	}
+
+	copy(h.ram, data)
+	h.clockBase = time.Unix(int64(binary.LittleEndian.Uint64(data[len(h.ram):])), 0)
+	copy(h.rtcMemory[:], data[size:])
+
+	return nil
+}
+
+// SaveState stores the clock as the minutes elapsed since it read 0, it resumes from there when the state is loaded
+func (h *HuC3) SaveState() []byte {
+	var state common.StateEncoder
+	state.Int(h.romBank)
+	state.Int(h.ramBank)
+	state.Byte(h.mode)
+	state.Bytes(h.rtcMemory[:])
+	state.Byte(h.rtcAddress)
+	state.Byte(h.command)
+	state.Byte(h.response)
+	state.Int(int(h.now().Sub(h.clockBase) / time.Minute))
+	state.Bytes(h.ram)
+
+	return state.Data
+}
+
+func (h *HuC3) LoadState(data []byte) error {
+	state := common.StateDecoder{Data: data}
+	h.romBank = state.Int()
+	h.ramBank = state.Int()
+	h.mode = state.Byte()
+	state.Bytes(h.rtcMemory[:])
+	h.rtcAddress = state.Byte()
+	h.command = state.Byte()
+	h.response = state.Byte()
+	h.clockBase = h.now().Add(-time.Duration(state.Int()) * time.Minute)
+	state.Bytes(h.ram)
+
+	return state.Err("huc3")
+}
@@ -0,0 +1,115 @@
+package cartridge
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/carvhal/gby/internal/testutils"
+)
+
+func hudsonROM(cartridgeType byte) []byte {
+	rom := make([]byte, 0x8000)
+	rom[0x0147], rom[0x0149] = cartridgeType, 0x03
+
+	return rom
+}
+
+// huc3Command writes a command in mode 0xB and runs it through the semaphore
+func huc3Command(h *HuC3, command, argument byte) {
+	h.WriteRegister(0x0000, 0x0B)
+	h.WriteRAM(0xA000, command<<4|argument)
+	h.WriteRegister(0x0000, 0x0D)
+	h.WriteRAM(0xA000, 0xFE)
+}
+
+// huc3ReadNibbles reads count nibbles starting at address through the read command
+func huc3ReadNibbles(h *HuC3, address byte, count int) int {
+	huc3Command(h, 0x4, address&0x0F)
+	huc3Command(h, 0x5, address>>4)
+
+	value := 0
+	for i := 0; i < count; i++ {
+		huc3Command(h, 0x1, 0)
+		h.WriteRegister(0x0000, 0x0C)
+		value |= int(h.ReadRAM(0xA000)&0x0F) << (i * 4)
+	}
+
+	return value
+}
+
+func TestHuC1Infrared(t *testing.T) {
+	a, ok := New(hudsonROM(HUC1)).(*HuC1)
+	Expect(t, ok, "HuC1 selected from the header").ToEqual(true)
+	b := New(hudsonROM(HUC1)).(*HuC1)
+
+	sideA, sideB := NewInfraredLoopback()
+	a.SetInfrared(sideA)
+	b.SetInfrared(sideB)
+
+	a.WriteRegister(0x0000, 0x0E)
+	b.WriteRegister(0x0000, 0x0E)
+
+	Expect(t, b.ReadRAM(0xA000), "no light").ToEqual(byte(0xC0))
+
+	a.WriteRAM(0xA000, 0x01)
+	Expect(t, b.ReadRAM(0xA000), "light from the other instance").ToEqual(byte(0xC1))
+	Expect(t, a.ReadRAM(0xA000), "own LED is not seen").ToEqual(byte(0xC0))
+
+	// back to RAM mode
+	a.WriteRegister(0x0000, 0x00)
+	a.WriteRAM(0xA000, 0x42)
+	Expect(t, a.ReadRAM(0xA000), "RAM").ToEqual(byte(0x42))
+}
+
+func TestHuC3Clock(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	h, ok := New(hudsonROM(HUC3)).(*HuC3)
+	Expect(t, ok, "HuC3 selected from the header").ToEqual(true)
+	h.SetClock(func() time.Time { return now })
+
+	// set the clock to day 2, 10:00 by writing 600 minutes and 2 days to 0x00 - 0x05 and copying them to the clock
+	huc3Command(h, 0x4, 0x0)
+	huc3Command(h, 0x5, 0x0)
+	for _, nibble := range []byte{0x8, 0x5, 0x2, 0x2, 0x0, 0x0} {
+		huc3Command(h, 0x3, nibble)
+	}
+	huc3Command(h, 0x6, 0x1)
+
+	now = now.Add(90 * time.Minute)
+	huc3Command(h, 0x6, 0x0)
+
+	Expect(t, huc3ReadNibbles(h, 0x00, 3), "minutes").ToEqual(690)
+	Expect(t, huc3ReadNibbles(h, 0x03, 3), "days").ToEqual(2)
+
+	// the clock keeps running while the cartridge is saved
+	save := h.SaveBattery()
+	restored := NewHuC3(hudsonROM(HUC3), Header{RAMSize: 0x8000})
+	restored.now = func() time.Time { return now.Add(24 * time.Hour) }
+	Must(t, restored.LoadBattery(save), "Expected no error loading the battery save: %v")
+
+	huc3Command(restored, 0x6, 0x0)
+	Expect(t, huc3ReadNibbles(restored, 0x03, 3), "days after a day off").ToEqual(3)
+}
+
+func TestHuC3Tone(t *testing.T) {
+	h := NewHuC3(hudsonROM(HUC3), Header{})
+
+	var played []byte
+	h.OnTone(func(tone byte) { played = append(played, tone) })
+
+	huc3Command(h, 0x4, 0x6)
+	huc3Command(h, 0x5, 0x2)
+	huc3Command(h, 0x3, 0x1)
+	huc3Command(h, 0x6, 0xE)
+
+	Expect(t, played, "tones").ToEqual([]byte{0x1})
+
+	// the tone setting survives a power cycle with the battery save
+	restored := NewHuC3(hudsonROM(HUC3), Header{})
+	Must(t, restored.LoadBattery(h.SaveBattery()), "Expected no error loading the battery save: %v")
+	restored.OnTone(func(tone byte) { played = append(played, tone) })
+
+	huc3Command(restored, 0x6, 0xE)
+	Expect(t, played, "tones after a power cycle").ToEqual([]byte{0x1, 0x1})
+}
@@ -0,0 +1,48 @@
+package cartridge
+
+import "sync/atomic"
+
+// Infrared is the IR LED and receiver of a cartridge (HuC1, HuC3)
+type Infrared interface {
+	SetLED(on bool)
+	LightDetected() bool
+}
+
+// InfraredEndpoint is one side of an infrared link, it sees the LED of its peer,
+// endpoints can be used by emulator instances running on different goroutines
+type InfraredEndpoint struct {
+	led  atomic.Bool
+	peer *InfraredEndpoint
+}
+
+// NewInfraredLoopback returns two endpoints facing each other, to link two local instances
+func NewInfraredLoopback() (*InfraredEndpoint, *InfraredEndpoint) {
+	a, b := &InfraredEndpoint{}, &InfraredEndpoint{}
+	a.peer, b.peer = b, a
+
+	return a, b
+}
+
+func (e *InfraredEndpoint) SetLED(on bool) {
+	e.led.Store(on)
+}
+
+func (e *InfraredEndpoint) LightDetected() bool {
+	return e.peer != nil && e.peer.led.Load()
+}
+
+// readInfrared returns the value of the cartridge RAM area in IR mode: 0xC1 when light is detected, 0xC0 otherwise
+func readInfrared(ir Infrared) byte {
+	if ir != nil && ir.LightDetected() {
+		return 0xC1
+	}
+
+	return 0xC0
+}
+
+// writeInfrared turns the LED on or off with bit 0
+func writeInfrared(ir Infrared, value byte) {
+	if ir != nil {
+		ir.SetLED(value&0x01 != 0)
+	}
+}
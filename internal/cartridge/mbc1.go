@@ -0,0 +1,148 @@
+package cartridge
+
+import (
+	"fmt"
+
+	"github.com/carvhal/gby/internal/common"
+)
+
+/*
+* MBC1
+*
+* address        | description
+*
+* 0x0000 0x1FFF  | RAM enable (0x0A)
+* 0x2000 0x3FFF  | ROM bank, lower 5 bits (0 selects 1)
+* 0x4000 0x5FFF  | RAM bank or upper 2 bits of the ROM bank
+* 0x6000 0x7FFF  | banking mode, 1 applies the upper bits to 0x0000 - 0x3FFF and to the RAM
+*
+* multicart variant (MBC1M): bit 4 of the ROM bank register is not wired, the upper bits select 256KB games
+*
+ */
+
+// MBC1 is the MBC1 mapper, also used wired as MBC1M by the licensed multicart collections
+type MBC1 struct {
+	rom        []byte
+	ram        []byte
+	battery    bool
+	multicart  bool
+	ramEnabled bool
+	bankLow    byte
+	bankHigh   byte
+	mode       byte
+}
+
+func NewMBC1(game []byte, header Header, multicart bool) *MBC1 {
+	return &MBC1{
+		rom:       game,
+		ram:       make([]byte, max(header.RAMSize, 1)),
+		battery:   header.Type == MBC1_RAM_BATTERY,
+		multicart: multicart,
+		bankLow:   1,
+	}
+}
+
+// upperShift returns the position of the upper bits in the ROM bank number
+func (m *MBC1) upperShift() byte {
+	if m.multicart {
+		return 4
+	}
+
+	return 5
+}
+
+func (m *MBC1) ReadROM(address uint16) byte {
+	return readBank(m.rom, m.ROMBank(address), address%romBankSize)
+}
+
+func (m *MBC1) ROMBank(address uint16) int {
+	if address < romBankSize {
+		var bank byte
+		if m.mode == 1 {
+			bank = m.bankHigh << m.upperShift()
+		}
+		return wrapBank(m.rom, int(bank))
+	}
+
+	low := m.bankLow
+	if m.multicart {
+		low &= 0x0F
+	}
+
+	return wrapBank(m.rom, int(m.bankHigh<<m.upperShift()|low))
+}
+
+func (m *MBC1) WriteRegister(address uint16, value byte) {
+	switch {
+	case address <= 0x1FFF:
+		m.ramEnabled = value&0x0F == 0x0A
+	case address <= 0x3FFF:
+		m.bankLow = max(value&0x1F, 1)
+	case address <= 0x5FFF:
+		m.bankHigh = value & 0x03
+	default:
+		m.mode = value & 0x01
+	}
+}
+
+func (m *MBC1) ramBank() int {
+	if m.mode == 1 {
+		return int(m.bankHigh)
+	}
+
+	return 0
+}
+
+func (m *MBC1) ReadRAM(address uint16) byte {
+	if !m.ramEnabled {
+		return 0xFF
+	}
+
+	return m.ram[ramOffset(m.ram, m.ramBank(), address)]
+}
+
+func (m *MBC1) WriteRAM(address uint16, value byte) {
+	if m.ramEnabled {
+		m.ram[ramOffset(m.ram, m.ramBank(), address)] = value
+	}
+}
+
+// SaveBattery returns the RAM, or nothing for cartridges without a battery
+func (m *MBC1) SaveBattery() []byte {
+	if !m.battery {
+		return nil
+	}
+
+	return append([]byte(nil), m.ram...)
+}
+
+func (m *MBC1) LoadBattery(data []byte) error {
+	if len(data) != len(m.ram) {
+		return fmt.Errorf("mbc1: battery save must be %d bytes, got %d", len(m.ram), len(data))
+	}
+
+	copy(m.ram, data)
+	return nil
+}
+
+func (m *MBC1) SaveState() []byte {
+	var state common.StateEncoder
+	state.Bool(m.ramEnabled)
+	state.Byte(m.bankLow)
+	state.Byte(m.bankHigh)
+	state.Byte(m.mode)
+	state.Bytes(m.ram)
+
+	return state.Data
+}
+
+func (m *MBC1) LoadState(data []byte) error {
+	state := common.StateDecoder{Data: data}
+	m.ramEnabled = state.Bool()
+	m.bankLow = state.Byte()
+	m.bankHigh = state.Byte()
+	m.mode = state.Byte()
+	state.Bytes(m.ram)
+
+	return state.Err("mbc1")
+}
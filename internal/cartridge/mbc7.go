@@ -0,0 +1,200 @@
+package cartridge
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/carvhal/gby/internal/common"
+)
+
+/*
+* MBC7
+*
+* address        | description
+*
+* 0x0000 0x1FFF  | RAM enable 1 (0x0A)
+* 0x2000 0x3FFF  | ROM bank (0x00 - 0x7F)
+* 0x4000 0x5FFF  | RAM enable 2 (0x40)
+*
+* registers on 0xA000 - 0xAFFF (both RAM enables set), selected by bits 4-7 of the address
+*
+* 0xAx0x      | write 0x55 to erase the accelerometer latch
+* 0xAx1x      | write 0xAA to latch the accelerometer
+* 0xAx2x      | accelerometer X, low byte
+* 0xAx3x      | accelerometer X, high byte
+* 0xAx4x      | accelerometer Y, low byte
+* 0xAx5x      | accelerometer Y, high byte
+* 0xAx6x      | always 0x00
+* 0xAx8x      | EEPROM, bit 7: CS, bit 6: CLK, bit 1: DI, bit 0: DO
+*
+ */
+
+const (
+	accelerometerCenter = 0x81D0
+	accelerometerG      = 0x70 // difference between the center and a reading at 1g
+	accelerometerErased = 0x8000
+)
+
+// Accelerometer provides the acceleration applied to an MBC7 cartridge, in g, on the X and Y axis
+type Accelerometer interface {
+	Acceleration() (x, y float64)
+}
+
+// AccelerometerFunc adapts a function to the Accelerometer interface, allowing tests to script the tilt
+type AccelerometerFunc func() (x, y float64)
+
+func (f AccelerometerFunc) Acceleration() (x, y float64) {
+	return f()
+}
+
+// MBC7 is the mapper of Kirby Tilt 'n' Tumble style cartridges, with a 2 axis accelerometer
+// and a 93LC56 serial EEPROM storing the save data
+type MBC7 struct {
+	rom           []byte
+	romBank       int
+	ramEnabled1   bool
+	ramEnabled2   bool
+	latchErased   bool
+	x, y          uint16
+	accelerometer Accelerometer
+	eeprom        eeprom93LC56
+}
+
+func NewMBC7(game []byte) *MBC7 {
+	m := &MBC7{rom: game, romBank: 1, x: accelerometerErased, y: accelerometerErased}
+	m.eeprom.reset()
+
+	return m
+}
+
+// SetAccelerometer sets the source of the accelerometer readings, without one the cartridge is level
+func (m *MBC7) SetAccelerometer(accelerometer Accelerometer) {
+	m.accelerometer = accelerometer
+}
+
+func (m *MBC7) ReadROM(address uint16) byte {
+	return readBank(m.rom, m.ROMBank(address), address%romBankSize)
+}
+
+func (m *MBC7) ROMBank(address uint16) int {
+	if address < romBankSize {
+		return 0
+	}
+
+	return wrapBank(m.rom, m.romBank)
+}
+
+func (m *MBC7) WriteRegister(address uint16, value byte) {
+	switch {
+	case address <= 0x1FFF:
+		m.ramEnabled1 = value == 0x0A
+	case address <= 0x3FFF:
+		m.romBank = int(value & 0x7F)
+	case address <= 0x5FFF:
+		m.ramEnabled2 = value == 0x40
+	}
+}
+
+func (m *MBC7) ReadRAM(address uint16) byte {
+	if !m.ramEnabled1 || !m.ramEnabled2 || address > 0xAFFF {
+		return 0xFF
+	}
+
+	switch (address >> 4) & 0x0F {
+	case 0x2:
+		return byte(m.x)
+	case 0x3:
+		return byte(m.x >> 8)
+	case 0x4:
+		return byte(m.y)
+	case 0x5:
+		return byte(m.y >> 8)
+	case 0x6:
+		return 0x00
+	case 0x8:
+		return m.eeprom.read()
+	}
+
+	return 0xFF
+}
+
+func (m *MBC7) WriteRAM(address uint16, value byte) {
+	if !m.ramEnabled1 || !m.ramEnabled2 || address > 0xAFFF {
+		return
+	}
+
+	switch (address >> 4) & 0x0F {
+	case 0x0:
+		if value == 0x55 {
+			m.latchErased = true
+			m.x, m.y = accelerometerErased, accelerometerErased
+		}
+	case 0x1:
+		if value == 0xAA && m.latchErased {
+			m.latchErased = false
+			m.latchAccelerometer()
+		}
+	case 0x8:
+		m.eeprom.write(value)
+	}
+}
+
+// latchAccelerometer samples the accelerometer into the X and Y registers
+func (m *MBC7) latchAccelerometer() {
+	var x, y float64
+	if m.accelerometer != nil {
+		x, y = m.accelerometer.Acceleration()
+	}
+
+	m.x = uint16(accelerometerCenter + int(x*accelerometerG))
+	m.y = uint16(accelerometerCenter + int(y*accelerometerG))
+}
+
+// SaveBattery returns the EEPROM contents, 128 little endian words
+func (m *MBC7) SaveBattery() []byte {
+	data := make([]byte, len(m.eeprom.words)*2)
+	for i, word := range m.eeprom.words {
+		binary.LittleEndian.PutUint16(data[i*2:], word)
+	}
+
+	return data
+}
+
+// LoadBattery restores the EEPROM contents saved by SaveBattery
+func (m *MBC7) LoadBattery(data []byte) error {
+	if len(data) != len(m.eeprom.words)*2 {
+		return fmt.Errorf("mbc7: battery save must be %d bytes, got %d", len(m.eeprom.words)*2, len(data))
+	}
+
+	for i := range m.eeprom.words {
+		m.eeprom.words[i] = binary.LittleEndian.Uint16(data[i*2:])
+	}
+
+	return nil
+}
+
+func (m *MBC7) SaveState() []byte {
+	var state common.StateEncoder
+	state.Int(m.romBank)
+	state.Bool(m.ramEnabled1)
+	state.Bool(m.ramEnabled2)
+	state.Bool(m.latchErased)
+	state.Uint16(m.x)
+	state.Uint16(m.y)
+	m.eeprom.saveState(&state)
+
+	return state.Data
+}
+
+func (m *MBC7) LoadState(data []byte) error {
+	state := common.StateDecoder{Data: data}
+	m.romBank = state.Int()
+	m.ramEnabled1 = state.Bool()
+	m.ramEnabled2 = state.Bool()
+	m.latchErased = state.Bool()
+	m.x = state.Uint16()
+	m.y = state.Uint16()
+	m.eeprom.loadState(&state)
+
+	return state.Err("mbc7")
+}
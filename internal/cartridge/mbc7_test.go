@@ -0,0 +1,111 @@
+package cartridge
+
+import (
+	"testing"
+
+	. "github.com/carvhal/gby/internal/testutils"
+)
+
+func enabledMBC7() *MBC7 {
+	m := NewMBC7(make([]byte, 0x8000))
+	m.WriteRegister(0x0000, 0x0A)
+	m.WriteRegister(0x4000, 0x40)
+
+	return m
+}
+
+// clockBits sends bits MSB first to the EEPROM, keeping CS high
+func clockBits(m *MBC7, value uint16, count int) {
+	for i := count - 1; i >= 0; i-- {
+		var di byte
+		if value&(1<<i) != 0 {
+			di = eepromDI
+		}
+		m.WriteRAM(0xA080, eepromCS|di)
+		m.WriteRAM(0xA080, eepromCS|eepromCLK|di)
+	}
+}
+
+// sendEEPROMCommand sends a start bit, a 2 bit opcode and 8 address bits, then drops CS
+func sendEEPROMCommand(m *MBC7, opcode, address uint16, data ...uint16) {
+	m.WriteRAM(0xA080, 0x00)
+	clockBits(m, 1, 1)
+	clockBits(m, opcode<<8|address, 10)
+	for _, d := range data {
+		clockBits(m, d, 16)
+	}
+	m.WriteRAM(0xA080, 0x00)
+}
+
+// readEEPROMWord reads a word, the dummy bit is already on DO once the command is received
+func readEEPROMWord(m *MBC7, address uint16) (dummy byte, word uint16) {
+	m.WriteRAM(0xA080, 0x00)
+	clockBits(m, 1, 1)
+	clockBits(m, 0x02<<8|address, 10)
+	dummy = m.ReadRAM(0xA080) & eepromDO
+
+	for i := 0; i < 16; i++ {
+		m.WriteRAM(0xA080, eepromCS)
+		m.WriteRAM(0xA080, eepromCS|eepromCLK)
+		word = word<<1 | uint16(m.ReadRAM(0xA080)&eepromDO)
+	}
+
+	m.WriteRAM(0xA080, 0x00)
+	return dummy, word
+}
+
+func TestMBC7Accelerometer(t *testing.T) {
+	m := enabledMBC7()
+	x, y := 0.0, -1.0
+	m.SetAccelerometer(AccelerometerFunc(func() (float64, float64) { return x, y }))
+
+	readAxis := func(address uint16) uint16 {
+		return uint16(m.ReadRAM(address)) | uint16(m.ReadRAM(address+0x10))<<8
+	}
+
+	Expect(t, readAxis(0xA020), "X before latching").ToEqual(uint16(0x8000))
+
+	m.WriteRAM(0xA000, 0x55)
+	m.WriteRAM(0xA010, 0xAA)
+	Expect(t, readAxis(0xA020), "X level").ToEqual(uint16(0x81D0))
+	Expect(t, readAxis(0xA040), "Y at -1g").ToEqual(uint16(0x81D0 - 0x70))
+
+	// the latch holds until it is erased and latched again
+	x = 0.5
+	m.WriteRAM(0xA010, 0xAA)
+	Expect(t, readAxis(0xA020), "X still latched").ToEqual(uint16(0x81D0))
+
+	m.WriteRAM(0xA000, 0x55)
+	Expect(t, readAxis(0xA020), "X erased").ToEqual(uint16(0x8000))
+	m.WriteRAM(0xA010, 0xAA)
+	Expect(t, readAxis(0xA020), "X at 0.5g").ToEqual(uint16(0x81D0 + 0x38))
+}
+
+func TestMBC7EEPROM(t *testing.T) {
+	m := enabledMBC7()
+
+	// writes are ignored until EWEN
+	sendEEPROMCommand(m, 0x01, 0x05, 0x1234)
+	_, word := readEEPROMWord(m, 0x05)
+	Expect(t, word, "write protected").ToEqual(uint16(0xFFFF))
+
+	sendEEPROMCommand(m, 0x00, 0xC0)
+	sendEEPROMCommand(m, 0x01, 0x05, 0x1234)
+
+	dummy, word := readEEPROMWord(m, 0x05)
+	Expect(t, dummy, "dummy bit").ToEqual(byte(0))
+	Expect(t, word, "written word").ToEqual(uint16(0x1234))
+
+	sendEEPROMCommand(m, 0x03, 0x05)
+	_, word = readEEPROMWord(m, 0x05)
+	Expect(t, word, "erased word").ToEqual(uint16(0xFFFF))
+
+	// WRAL then battery round trip
+	sendEEPROMCommand(m, 0x00, 0x40, 0xBEEF)
+	save := m.SaveBattery()
+
+	restored := enabledMBC7()
+	Must(t, restored.LoadBattery(save), "Expected no error loading the battery save: %v")
+	_, word = readEEPROMWord(restored, 0x7F)
+	Expect(t, word, "restored word").ToEqual(uint16(0xBEEF))
+}
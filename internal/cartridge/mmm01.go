@@ -0,0 +1,162 @@
+package cartridge
+
+import (
+	"fmt"
+
+	"github.com/carvhal/gby/internal/common"
+)
+
+/*
+* MMM01
+*
+* multicart mapper: at power on the last 32KB of the ROM (the menu) is mapped and every register is writable,
+* the menu selects a game and maps it, after which the registers marked (unmapped) are locked and the
+* cartridge behaves like an MBC1 restricted to the selected game
+*
+* address        | description
+*
+* 0x0000 0x1FFF  | bits 0-3 RAM enable (0x0A), bit 6 map the selected game (unmapped)
+* 0x2000 0x3FFF  | bits 0-4 ROM bank, bits 5-6 ROM bank bits 5-6 (unmapped)
+* 0x4000 0x5FFF  | bits 0-1 RAM bank, bits 2-3 RAM bank bits 2-3 (unmapped), bits 4-5 ROM bank bits 7-8 (unmapped)
+* 0x6000 0x7FFF  | bit 0 banking mode, bits 2-5 ROM bank bits 1-4 locked once mapped (unmapped)
+*
+ */
+
+// MMM01 is the MMM01 multicart mapper
+type MMM01 struct {
+	rom        []byte
+	ram        []byte
+	battery    bool
+	mapped     bool
+	ramEnabled bool
+	romBank    int  // 9 bits
+	romLocked  int  // ROM bank bits that cannot be changed by the game once mapped
+	ramBank    int  // 4 bits
+	mode       byte // MBC1 banking mode
+}
+
+func NewMMM01(game []byte, header Header) *MMM01 {
+	return &MMM01{
+		rom:     game,
+		ram:     make([]byte, max(header.RAMSize, 1)),
+		battery: header.Type == MMM01_RAM_BATTERY,
+	}
+}
+
+// Mapped reports whether the menu has mapped a game
+func (m *MMM01) Mapped() bool {
+	return m.mapped
+}
+
+func (m *MMM01) ReadROM(address uint16) byte {
+	return readBank(m.rom, m.ROMBank(address), address%romBankSize)
+}
+
+func (m *MMM01) ROMBank(address uint16) int {
+	// the menu lives in the last 32KB of the ROM
+	if !m.mapped {
+		menu := len(m.rom)/romBankSize - 2
+		return wrapBank(m.rom, menu+int(address)/romBankSize)
+	}
+
+	outer := m.romBank &^ 0x1F
+	if address < romBankSize {
+		bank := outer | m.romBank&m.romLocked
+		if m.mode == 0 {
+			bank = outer
+		}
+		return wrapBank(m.rom, bank)
+	}
+
+	bank := m.romBank
+	if bank&0x1F == 0 {
+		bank |= 1
+	}
+
+	return wrapBank(m.rom, bank)
+}
+
+func (m *MMM01) WriteRegister(address uint16, value byte) {
+	switch {
+	case address <= 0x1FFF:
+		m.ramEnabled = value&0x0F == 0x0A
+		if !m.mapped && value&0x40 != 0 {
+			m.mapped = true
+		}
+	case address <= 0x3FFF:
+		writable := 0x1F &^ m.romLocked
+		if !m.mapped {
+			writable = 0x7F
+		}
+		m.romBank = m.romBank&^writable | int(value)&writable
+	case address <= 0x5FFF:
+		m.ramBank = m.ramBank&^0x03 | int(value&0x03)
+		if !m.mapped {
+			m.ramBank = int(value & 0x0F)
+			m.romBank = m.romBank&0x7F | int(value&0x30)<<3
+		}
+	default:
+		m.mode = value & 0x01
+		if !m.mapped {
+			m.romLocked = int(value&0x3C) >> 1
+		}
+	}
+}
+
+func (m *MMM01) ReadRAM(address uint16) byte {
+	if !m.ramEnabled {
+		return 0xFF
+	}
+
+	return m.ram[ramOffset(m.ram, m.ramBank, address)]
+}
+
+func (m *MMM01) WriteRAM(address uint16, value byte) {
+	if m.ramEnabled {
+		m.ram[ramOffset(m.ram, m.ramBank, address)] = value
+	}
+}
+
+// SaveBattery returns the RAM, or nothing for cartridges without a battery
+func (m *MMM01) SaveBattery() []byte {
+	if !m.battery {
+		return nil
+	}
+
+	return append([]byte(nil), m.ram...)
+}
+
+func (m *MMM01) LoadBattery(data []byte) error {
+	if len(data) != len(m.ram) {
+		return fmt.Errorf("mmm01: battery save must be %d bytes, got %d", len(m.ram), len(data))
+	}
+
+	copy(m.ram, data)
+	return nil
+}
+
+func (m *MMM01) SaveState() []byte {
+	var state common.StateEncoder
+	state.Bool(m.mapped)
+	state.Bool(m.ramEnabled)
+	state.Int(m.romBank)
+	state.Int(m.romLocked)
+	state.Int(m.ramBank)
+	state.Byte(m.mode)
+	state.Bytes(m.ram)
+
+	return state.Data
+}
+
+func (m *MMM01) LoadState(data []byte) error {
+	state := common.StateDecoder{Data: data}
+	m.mapped = state.Bool()
+	m.ramEnabled = state.Bool()
+	m.romBank = state.Int()
+	m.romLocked = state.Int()
+	m.ramBank = state.Int()
+	m.mode = state.Byte()
+	state.Bytes(m.ram)
+
+	return state.Err("mmm01")
+}
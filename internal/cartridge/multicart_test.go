@@ -0,0 +1,127 @@
+package cartridge
+
+import (
+	"fmt"
+	"hash/crc32"
+	"strings"
+	"testing"
+
+	. "github.com/carvhal/gby/internal/testutils"
+)
+
+// bankedROM returns a ROM of size bytes whose 16KB banks start with their bank number
+func bankedROM(size int) []byte {
+	rom := make([]byte, size)
+	for bank := 0; bank < size/romBankSize; bank++ {
+		rom[bank*romBankSize] = byte(bank)
+	}
+
+	return rom
+}
+
+// writeHeader writes a header with the Nintendo logo at offset
+func writeHeader(rom []byte, offset int, cartridgeType byte) {
+	copy(rom[offset+0x0104:], nintendoLogo)
+	rom[offset+0x0147] = cartridgeType
+}
+
+func TestMBC1Multicart(t *testing.T) {
+	rom := bankedROM(0x100000)
+	writeHeader(rom, 0, MBC1_ROM)
+	writeHeader(rom, 0x10*romBankSize, MBC1_ROM)
+
+	Expect(t, Detect(rom), "second header at bank 0x10").ToEqual(KIND_MBC1M)
+
+	m := New(rom).(*MBC1)
+
+	// second game, bank 3
+	m.WriteRegister(0x4000, 0x01)
+	m.WriteRegister(0x2000, 0x13)
+	Expect(t, m.ReadROM(0x4000), "bit 4 of the ROM bank is not wired").ToEqual(byte(0x13))
+	Expect(t, m.ROMBank(0x4000), "bank mapped at 0x4000").ToEqual(0x13)
+
+	m.WriteRegister(0x6000, 0x01)
+	Expect(t, m.ReadROM(0x0000), "bank 0 of the second game").ToEqual(byte(0x10))
+	Expect(t, m.ROMBank(0x0000), "bank mapped at 0x0000").ToEqual(0x10)
+
+	plain := bankedROM(0x100000)
+	writeHeader(plain, 0, MBC1_ROM)
+	Expect(t, Detect(plain), "plain MBC1").ToEqual(KIND_MBC1)
+}
+
+func TestMMM01(t *testing.T) {
+	rom := bankedROM(0x80000)
+	writeHeader(rom, len(rom)-0x8000, MMM01_ROM)
+
+	Expect(t, Detect(rom), "menu header in the last 32KB").ToEqual(KIND_MMM01)
+
+	m := New(rom).(*MMM01)
+	Expect(t, m.ReadROM(0x0000), "menu bank 0").ToEqual(byte(0x1E))
+	Expect(t, m.ReadROM(0x4000), "menu bank 1").ToEqual(byte(0x1F))
+
+	// the menu selects the game at bank 0x08 (128KB), locking ROM bank bits 3-4, then maps it
+	m.WriteRegister(0x2000, 0x08)
+	m.WriteRegister(0x6000, 0x30)
+	m.WriteRegister(0x0000, 0x40)
+	Expect(t, m.Mapped(), "game mapped").ToEqual(true)
+
+	m.WriteRegister(0x2000, 0x01)
+	Expect(t, m.ReadROM(0x4000), "banks are relative to the game").ToEqual(byte(0x09))
+
+	m.WriteRegister(0x2000, 0x1F)
+	Expect(t, m.ReadROM(0x4000), "locked bits are kept").ToEqual(byte(0x0F))
+
+	m.WriteRegister(0x0000, 0x00)
+	Expect(t, m.Mapped(), "the game cannot unmap itself").ToEqual(true)
+}
+
+func TestSachen(t *testing.T) {
+	rom := bankedROM(0x40000)
+
+	// logo stored at the addresses the boot ROM reads through the swapped address lines
+	for i, b := range nintendoLogo {
+		address := 0x0104 + i
+		rom[address&^0x53|address&0x01<<6|address&0x40>>6|address&0x02<<3|address&0x10>>3] = b
+	}
+
+	Expect(t, Detect(rom), "scrambled logo").ToEqual(KIND_SACHEN)
+
+	s := New(rom).(*Sachen)
+
+	s.WriteRegister(0x0000, 0x04)
+	Expect(t, s.ReadROM(0x0000), "outer bank locked").ToEqual(byte(0x00))
+
+	s.WriteRegister(0x2000, 0x30)
+	s.WriteRegister(0x0000, 0x04)
+	s.WriteRegister(0x4000, 0x0C)
+	s.WriteRegister(0x2000, 0x01)
+	Expect(t, s.ReadROM(0x0000), "outer bank").ToEqual(byte(0x04))
+	Expect(t, s.ReadROM(0x4000), "inner bank").ToEqual(byte(0x05))
+}
+
+func TestWisdomTree(t *testing.T) {
+	rom := bankedROM(0x20000)
+	copy(rom[0x0200:], "WISDOM TREE")
+
+	Expect(t, Detect(rom), "name in the first bank").ToEqual(KIND_WISDOM_TREE)
+
+	w := New(rom).(*WisdomTree)
+	w.WriteRegister(0x0002, 0xFF)
+	Expect(t, w.ReadROM(0x0000), "32KB bank 2, first half").ToEqual(byte(0x04))
+	Expect(t, w.ReadROM(0x4000), "32KB bank 2, second half").ToEqual(byte(0x05))
+}
+
+func TestChecksumDatabase(t *testing.T) {
+	rom := bankedROM(0x10000)
+	crc := crc32.ChecksumIEEE(rom)
+	defer delete(checksumDatabase, crc)
+
+	Expect(t, Detect(rom), "no entry").ToEqual(KIND_ROM)
+
+	database := "# unlicensed games\n" + fmt.Sprintf("%08X", crc) + " Sachen # comment\n"
+	Must(t, LoadChecksumDatabase(strings.NewReader(database)), "Expected no error loading the database: %v")
+	Expect(t, Detect(rom), "database entry").ToEqual(KIND_SACHEN)
+
+	err := LoadChecksumDatabase(strings.NewReader("1234 unknown\n"))
+	Expect(t, err != nil, "unknown mapper").ToEqual(true)
+}
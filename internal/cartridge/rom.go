@@ -0,0 +1,43 @@
+package cartridge
+
+// ROM is a cartridge without a memory bank controller, the ROM is mapped flat on 0x0000 - 0x7FFF
+type ROM struct {
+	noBattery
+	rom []byte
+}
+
+func NewROM(game []byte) *ROM {
+	return &ROM{rom: game}
+}
+
+func (r *ROM) ReadROM(address uint16) byte {
+	if int(address) >= len(r.rom) {
+		return 0xFF
+	}
+
+	return r.rom[address]
+}
+
+func (r *ROM) ROMBank(address uint16) int {
+	return int(address) / romBankSize
+}
+
+// WriteRegister is ignored, there are no registers to write to
+func (r *ROM) WriteRegister(address uint16, value byte) {}
+
+// ReadRAM returns open bus, there is no cartridge RAM
+func (r *ROM) ReadRAM(address uint16) byte {
+	return 0xFF
+}
+
+func (r *ROM) WriteRAM(address uint16, value byte) {}
+
+// SaveState returns nothing, there is no state besides the ROM
+func (r *ROM) SaveState() []byte {
+	return nil
+}
+
+// LoadState ignores data, the fields of newer versions included
+func (r *ROM) LoadState(data []byte) error {
+	return nil
+}
@@ -0,0 +1,85 @@
+package cartridge
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/png" // decode PNG sensor images
+	"os"
+)
+
+const (
+	sensorWidth  = 128
+	sensorHeight = 112
+)
+
+// Sensor is the image source of the Pocket Camera, Capture returns the next image seen by the camera
+type Sensor interface {
+	Capture() (image.Image, error)
+}
+
+// ImageSequence is a Sensor that returns a sequence of images, one per capture, repeating the last one once exhausted
+type ImageSequence struct {
+	images []image.Image
+	next   int
+}
+
+// NewImageSequence returns a sensor capturing the given images in order
+func NewImageSequence(images ...image.Image) *ImageSequence {
+	return &ImageSequence{images: images}
+}
+
+// LoadImageSequence decodes a still image or a sequence of PNG files to feed the camera with
+func LoadImageSequence(paths ...string) (*ImageSequence, error) {
+	images := make([]image.Image, 0, len(paths))
+
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("camera sensor: %w", err)
+		}
+
+		img, _, err := image.Decode(file)
+		file.Close()
+
+		if err != nil {
+			return nil, fmt.Errorf("camera sensor: decoding %s: %w", path, err)
+		}
+
+		images = append(images, img)
+	}
+
+	return NewImageSequence(images...), nil
+}
+
+func (s *ImageSequence) Capture() (image.Image, error) {
+	if len(s.images) == 0 {
+		return nil, fmt.Errorf("camera sensor: no images")
+	}
+
+	img := s.images[s.next]
+
+	if s.next < len(s.images)-1 {
+		s.next++
+	}
+
+	return img, nil
+}
+
+// sensorPixels scales an image to the sensor size and converts it to 8-bit greyscale
+func sensorPixels(img image.Image) [sensorHeight][sensorWidth]int {
+	var pixels [sensorHeight][sensorWidth]int
+	bounds := img.Bounds()
+
+	for y := 0; y < sensorHeight; y++ {
+		for x := 0; x < sensorWidth; x++ {
+			sourceX := bounds.Min.X + x*bounds.Dx()/sensorWidth
+			sourceY := bounds.Min.Y + y*bounds.Dy()/sensorHeight
+			grey := color.GrayModel.Convert(img.At(sourceX, sourceY)).(color.Gray)
+
+			pixels[y][x] = int(grey.Y)
+		}
+	}
+
+	return pixels
+}
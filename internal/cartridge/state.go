@@ -0,0 +1,12 @@
+package cartridge
+
+// noBattery is embedded by the mappers without battery backed memory
+type noBattery struct{}
+
+func (noBattery) SaveBattery() []byte {
+	return nil
+}
+
+func (noBattery) LoadBattery(data []byte) error {
+	return nil
+}
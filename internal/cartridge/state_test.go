@@ -0,0 +1,73 @@
+package cartridge
+
+import (
+	"testing"
+
+	. "github.com/carvhal/gby/internal/testutils"
+)
+
+func TestSaveStateRoundTrip(t *testing.T) {
+	for kind := range factories {
+		rom := bankedROM(0x80000)
+		rom[0x0149] = 0x03
+
+		mapper := NewKind(rom, kind)
+		mapper.WriteRegister(0x0000, 0x0A)
+		mapper.WriteRegister(0x2000, 0x05)
+		mapper.WriteRegister(0x4000, 0x01)
+		mapper.WriteRAM(0xA000, 0x42)
+
+		state := mapper.SaveState()
+
+		restored := NewKind(rom, kind)
+		Must(t, restored.LoadState(state), string(kind)+": Expected no error loading the state: %v")
+		Expect(t, restored.SaveState(), string(kind)+" state").ToEqual(state)
+		Expect(t, restored.ReadROM(0x4000), string(kind)+" ROM bank").ToEqual(mapper.ReadROM(0x4000))
+		Expect(t, restored.ReadRAM(0xA000), string(kind)+" RAM").ToEqual(mapper.ReadRAM(0xA000))
+
+		newer := append(append([]byte(nil), state...), 0xFF)
+		Must(t, restored.LoadState(newer), string(kind)+": Expected the fields of newer versions to be ignored: %v")
+		Expect(t, restored.SaveState(), string(kind)+" state with a newer field").ToEqual(state)
+	}
+}
+
+func TestShortSaveState(t *testing.T) {
+	rom := bankedROM(0x80000)
+	rom[0x0149] = 0x03
+
+	mapper := NewKind(rom, KIND_MBC1)
+	mapper.WriteRegister(0x0000, 0x0A)
+	mapper.WriteRegister(0x2000, 0x05)
+	mapper.WriteRAM(0xA000, 0x42)
+
+	// a state saved with less RAM than the cartridge has
+	state := mapper.SaveState()
+	short := state[:len(state)-0x100]
+
+	restored := NewKind(rom, KIND_MBC1)
+	Must(t, restored.LoadState(short), "Expected a short state to load: %v")
+	Expect(t, restored.ReadROM(0x4000), "ROM bank").ToEqual(mapper.ReadROM(0x4000))
+	Expect(t, restored.ReadRAM(0xA000), "RAM").ToEqual(byte(0x42))
+}
+
+type testMapper struct {
+	ROM
+}
+
+func TestRegister(t *testing.T) {
+	const cartridgeType = 0xF0
+	defer delete(headerKinds, cartridgeType)
+	defer delete(factories, "test")
+
+	Register("test", func(game []byte, header Header) Mapper { return &testMapper{ROM{rom: game}} }, cartridgeType)
+
+	rom := bankedROM(0x8000)
+	rom[0x0147] = cartridgeType
+
+	_, ok := New(rom).(*testMapper)
+	Expect(t, ok, "mapper registered for the cartridge type").ToEqual(true)
+
+	kind, err := ParseKind("TEST")
+	Must(t, err, "Expected the registered kind to parse: %v")
+	Expect(t, kind, "kind").ToEqual(Kind("test"))
+}
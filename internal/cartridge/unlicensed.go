@@ -0,0 +1,142 @@
+package cartridge
+
+import "github.com/carvhal/gby/internal/common"
+
+/*
+* Sachen MMC1
+*
+* address        | description
+*
+* 0x0000 0x1FFF  | outer ROM bank, only written while the ROM bank register has bits 4-5 set
+* 0x2000 0x3FFF  | ROM bank (0 selects 1)
+* 0x4000 0x5FFF  | outer ROM bank mask, only written while the ROM bank register has bits 4-5 set
+*
+* banks: 0x0000 - 0x3FFF reads outer & mask, 0x4000 - 0x7FFF reads (outer & mask) | (bank &^ mask)
+*
+* the real cartridge scrambles the address lines while the boot ROM reads the logo,
+* the logo is never read through the bus here so only the detection relies on it
+*
+ */
+
+// Sachen is the banking scheme of the Sachen multicarts and single games
+type Sachen struct {
+	noBattery
+	rom     []byte
+	outer   byte
+	mask    byte
+	romBank byte
+}
+
+func NewSachen(game []byte) *Sachen {
+	return &Sachen{rom: game, romBank: 1}
+}
+
+func (s *Sachen) ReadROM(address uint16) byte {
+	return readBank(s.rom, s.ROMBank(address), address%romBankSize)
+}
+
+func (s *Sachen) ROMBank(address uint16) int {
+	base := s.outer & s.mask
+	if address < romBankSize {
+		return wrapBank(s.rom, int(base))
+	}
+
+	return wrapBank(s.rom, int(base|s.romBank&^s.mask))
+}
+
+func (s *Sachen) WriteRegister(address uint16, value byte) {
+	unlocked := s.romBank&0x30 == 0x30
+
+	switch {
+	case address <= 0x1FFF:
+		if unlocked {
+			s.outer = value
+		}
+	case address <= 0x3FFF:
+		s.romBank = max(value, 1)
+	case address <= 0x5FFF:
+		if unlocked {
+			s.mask = value
+		}
+	}
+}
+
+func (s *Sachen) ReadRAM(address uint16) byte {
+	return 0xFF
+}
+
+func (s *Sachen) WriteRAM(address uint16, value byte) {}
+
+func (s *Sachen) SaveState() []byte {
+	var state common.StateEncoder
+	state.Byte(s.outer)
+	state.Byte(s.mask)
+	state.Byte(s.romBank)
+
+	return state.Data
+}
+
+func (s *Sachen) LoadState(data []byte) error {
+	state := common.StateDecoder{Data: data}
+	s.outer = state.Byte()
+	s.mask = state.Byte()
+	s.romBank = state.Byte()
+
+	return state.Err("sachen")
+}
+
+/*
+* Wisdom Tree
+*
+* a write anywhere in 0x0000 - 0x3FFF maps the 32KB bank selected by the low byte of the address
+* to 0x0000 - 0x7FFF, the value written is ignored
+*
+ */
+
+const wisdomTreeBankSize = 2 * romBankSize
+
+// WisdomTree is the banking scheme of the Wisdom Tree games and of the "XX-in-1" menus switching whole 32KB games
+type WisdomTree struct {
+	noBattery
+	rom  []byte
+	bank int
+}
+
+func NewWisdomTree(game []byte) *WisdomTree {
+	return &WisdomTree{rom: game}
+}
+
+func (w *WisdomTree) ReadROM(address uint16) byte {
+	return w.rom[(w.bank*wisdomTreeBankSize+int(address))%len(w.rom)]
+}
+
+// ROMBank returns the 16KB half of the 32KB bank mapped at address
+func (w *WisdomTree) ROMBank(address uint16) int {
+	return wrapBank(w.rom, w.bank*2+int(address)/romBankSize)
+}
+
+func (w *WisdomTree) WriteRegister(address uint16, value byte) {
+	if address <= 0x3FFF {
+		w.bank = int(address & 0xFF)
+	}
+}
+
+func (w *WisdomTree) ReadRAM(address uint16) byte {
+	return 0xFF
+}
+
+func (w *WisdomTree) WriteRAM(address uint16, value byte) {}
+
+func (w *WisdomTree) SaveState() []byte {
+	var state common.StateEncoder
+	state.Int(w.bank)
+
+	return state.Data
+}
+
+func (w *WisdomTree) LoadState(data []byte) error {
+	state := common.StateDecoder{Data: data}
+	w.bank = state.Int()
+
+	return state.Err("wisdom tree")
+}
@@ -0,0 +1,97 @@
+package common
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// StateEncoder appends the registers and memories of a component to a save state, little endian
+type StateEncoder struct {
+	Data []byte
+}
+
+func (s *StateEncoder) Bool(value bool) {
+	if value {
+		s.Data = append(s.Data, 1)
+		return
+	}
+
+	s.Data = append(s.Data, 0)
+}
+
+func (s *StateEncoder) Byte(value byte) {
+	s.Data = append(s.Data, value)
+}
+
+func (s *StateEncoder) Uint16(value uint16) {
+	s.Data = binary.LittleEndian.AppendUint16(s.Data, value)
+}
+
+func (s *StateEncoder) Uint64(value uint64) {
+	s.Data = binary.LittleEndian.AppendUint64(s.Data, value)
+}
+
+func (s *StateEncoder) Int(value int) {
+	s.Uint64(uint64(int64(value)))
+}
+
+func (s *StateEncoder) Bytes(value []byte) {
+	s.Data = append(s.Data, value...)
+}
+
+// StateDecoder reads back what a StateEncoder wrote, in the same order, so that states stay loadable
+// when components gain fields or memories grow: the fields missing at the end of the state read zeros,
+// so do the bytes missing from a memory cut short, and the fields following the ones read are ignored
+type StateDecoder struct {
+	Data      []byte
+	truncated bool // the state ended in the middle of a number
+}
+
+func (s *StateDecoder) next(n int) []byte {
+	if len(s.Data) < n {
+		s.truncated = s.truncated || len(s.Data) > 0
+		s.Data = nil
+		return make([]byte, n)
+	}
+
+	value := s.Data[:n]
+	s.Data = s.Data[n:]
+
+	return value
+}
+
+func (s *StateDecoder) Bool() bool {
+	return s.next(1)[0] != 0
+}
+
+func (s *StateDecoder) Byte() byte {
+	return s.next(1)[0]
+}
+
+func (s *StateDecoder) Uint16() uint16 {
+	return binary.LittleEndian.Uint16(s.next(2))
+}
+
+func (s *StateDecoder) Uint64() uint64 {
+	return binary.LittleEndian.Uint64(s.next(8))
+}
+
+func (s *StateDecoder) Int() int {
+	return int(int64(s.Uint64()))
+}
+
+// Bytes fills value, the bytes missing at the end of the state are zeroed
+func (s *StateDecoder) Bytes(value []byte) {
+	n := copy(value, s.Data)
+	clear(value[n:])
+	s.Data = s.Data[n:]
+}
+
+// Err reports a state ending in the middle of a number, the state of the component is then undefined
+func (s *StateDecoder) Err(component string) error {
+	if s.truncated {
+		return fmt.Errorf("%s: save state does not match the machine", component)
+	}
+
+	return nil
+}
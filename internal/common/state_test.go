@@ -0,0 +1,57 @@
+package common
+
+import (
+	"testing"
+
+	. "github.com/carvhal/gby/internal/testutils"
+)
+
+func TestStateDecoder(t *testing.T) {
+	var encoder StateEncoder
+	encoder.Byte(0x12)
+	encoder.Uint16(0x3456)
+	encoder.Bytes([]byte{0xAB, 0xCD})
+	encoder.Int(-2)
+
+	decoder := StateDecoder{Data: encoder.Data}
+	Expect(t, decoder.Byte(), "byte").ToEqual(byte(0x12))
+	Expect(t, decoder.Uint16(), "uint16").ToEqual(uint16(0x3456))
+	bytes := make([]byte, 2)
+	decoder.Bytes(bytes)
+	Expect(t, bytes, "bytes").ToEqual([]byte{0xAB, 0xCD})
+	Expect(t, decoder.Int(), "int").ToEqual(-2)
+	Must(t, decoder.Err("test"), "Expected no error decoding the whole state: %v")
+}
+
+func TestStateDecoderLayouts(t *testing.T) {
+	// a state saved before the last fields were added
+	older := StateDecoder{Data: []byte{0x12, 0x56, 0x34}}
+	Expect(t, older.Byte(), "byte").ToEqual(byte(0x12))
+	Expect(t, older.Uint16(), "uint16").ToEqual(uint16(0x3456))
+	Expect(t, older.Bool(), "missing bool").ToEqual(false)
+	Expect(t, older.Int(), "missing int").ToEqual(0)
+	Must(t, older.Err("test"), "Expected missing fields to read zeros: %v")
+
+	// a state saved with fields added since
+	newer := StateDecoder{Data: []byte{0x12, 0x56, 0x34, 0x01, 0x02}}
+	Expect(t, newer.Byte(), "byte").ToEqual(byte(0x12))
+	Expect(t, newer.Uint16(), "uint16").ToEqual(uint16(0x3456))
+	Must(t, newer.Err("test"), "Expected the fields following to be ignored: %v")
+
+	// a state ending in the middle of a field
+	cut := StateDecoder{Data: []byte{0x12, 0x56}}
+	Expect(t, cut.Byte(), "byte").ToEqual(byte(0x12))
+	Expect(t, cut.Uint16(), "cut uint16").ToEqual(uint16(0))
+	Expect(t, cut.Err("test") != nil, "cut field reported").ToEqual(true)
+}
+
+func TestStateDecoderShortBytes(t *testing.T) {
+	// a memory saved smaller than it is now
+	short := StateDecoder{Data: []byte{0x12, 0xAB, 0xCD}}
+	Expect(t, short.Byte(), "byte").ToEqual(byte(0x12))
+	bytes := []byte{0xFF, 0xFF, 0xFF, 0xFF}
+	short.Bytes(bytes)
+	Expect(t, bytes, "bytes zeroed past the end of the state").ToEqual([]byte{0xAB, 0xCD, 0x00, 0x00})
+	Expect(t, short.Bool(), "missing bool").ToEqual(false)
+	Must(t, short.Err("test"), "Expected a memory cut short to load: %v")
+}
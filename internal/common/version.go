@@ -0,0 +1,4 @@
+package common
+
+// VERSION is the version of the emulator, recorded in the files it writes
+const VERSION = "0.1.0"
@@ -0,0 +1,81 @@
+package cpu
+
+import (
+	"fmt"
+	"io"
+)
+
+// MAX_CALL_DEPTH bounds the shadow call stack, the outermost frames are dropped past it
+const MAX_CALL_DEPTH = 256
+
+// FrameKind is how a frame was entered
+type FrameKind byte
+
+const (
+	FRAME_CALL FrameKind = iota
+	FRAME_RST
+	FRAME_INTERRUPT
+)
+
+var interruptNames = []string{"VBlank", "STAT", "timer", "serial", "joypad"}
+
+// Frame is an entry of the shadow call stack
+type Frame struct {
+	Kind       FrameKind
+	Site       uint16 // address of the call, or of the instruction interrupted
+	SiteBank   int
+	Target     uint16 // address called
+	TargetBank int
+	Interrupt  byte   // interrupt dispatched, for FRAME_INTERRUPT
+	SP         uint16 // where the return address was pushed
+}
+
+// pushFrame records a call, the return address was just pushed at SP
+func (c *CPU) pushFrame(frame Frame) {
+	frame.SP = c.sp
+	frame.SiteBank, frame.TargetBank = c.ROMBank(frame.Site), c.ROMBank(frame.Target)
+
+	// frames at or below the new return address were abandoned, by a game resetting SP for instance
+	c.dropFrames(frame.SP)
+
+	if len(c.callStack) == MAX_CALL_DEPTH {
+		c.callStack = append(c.callStack[:0], c.callStack[1:]...)
+	}
+	c.callStack = append(c.callStack, frame)
+}
+
+// dropFrames removes the innermost frames whose return address is at or below sp
+func (c *CPU) dropFrames(sp uint16) {
+	for len(c.callStack) > 0 && c.callStack[len(c.callStack)-1].SP <= sp {
+		c.callStack = c.callStack[:len(c.callStack)-1]
+	}
+}
+
+// CallStack returns the frames of the shadow call stack, innermost last
+func (c *CPU) CallStack() []Frame {
+	return append([]Frame(nil), c.callStack...)
+}
+
+// CallDepth returns the number of frames of the shadow call stack, without copying them
+func (c *CPU) CallDepth() int {
+	return len(c.callStack)
+}
+
+// PrintBacktrace writes the call stack, innermost first, starting from PC
+func (c *CPU) PrintBacktrace(w io.Writer) {
+	fmt.Fprintf(w, "#0  %s\n", c.FormatAddress(c.PC))
+
+	for i := len(c.callStack) - 1; i >= 0; i-- {
+		frame := c.callStack[i]
+		site := c.formatAddress(frame.SiteBank, frame.Site)
+
+		switch frame.Kind {
+		case FRAME_INTERRUPT:
+			fmt.Fprintf(w, "#%-2d %s interrupted by %s\n", len(c.callStack)-i, site, interruptNames[frame.Interrupt])
+		case FRAME_RST:
+			fmt.Fprintf(w, "#%-2d %s rst $%02X\n", len(c.callStack)-i, site, frame.Target)
+		default:
+			fmt.Fprintf(w, "#%-2d %s call %s\n", len(c.callStack)-i, site, c.formatAddress(frame.TargetBank, frame.Target))
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package cpu
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/carvhal/gby/internal/testutils"
+)
+
+// interruptingMemory raises the interrupts in requested
+type interruptingMemory struct {
+	*mockMemController
+	requested byte
+}
+
+func (m *interruptingMemory) PendingInterrupt() (byte, bool) {
+	for interrupt := byte(0); interrupt < 5; interrupt++ {
+		if m.requested&(1<<interrupt) != 0 {
+			return interrupt, true
+		}
+	}
+
+	return 0, false
+}
+
+func (m *interruptingMemory) AcknowledgeInterrupt(interrupt byte) {
+	m.requested &^= 1 << interrupt
+}
+
+func TestCallStack(t *testing.T) {
+	memory := &interruptingMemory{mockMemController: mockMemory(make([]byte, 0x10000))}
+	copy(memory.ram, []byte{
+		0x31, 0xFE, 0xFF, // 0000 LD SP $FFFE
+		0xCD, 0x10, 0x00, // 0003 CALL $0010
+		0xFB,       // 0006 EI
+		0x06, 0x05, // 0007 LD B $05
+		0xCD, 0x20, 0x00, // 0009 CALL $0020
+	})
+	copy(memory.ram[0x0010:], []byte{0xFF, 0xC9})                         // RST $38, RET
+	copy(memory.ram[0x0020:], []byte{0x31, 0xFE, 0xFF, 0xCD, 0x30, 0x00}) // LD SP $FFFE, CALL $0030
+	memory.ram[0x0038] = 0xC9                                             // RET
+	memory.ram[0x0040] = 0xD9                                             // RETI
+
+	c := &CPU{memoryBus: memory}
+	tick := func(count int) {
+		for i := 0; i < count; i++ {
+			_, err := c.Tick()
+			Must(t, err, "Expected no error: %v")
+		}
+	}
+
+	tick(3)
+	Expect(t, c.PC, "in the RST handler").ToEqual(uint16(0x0038))
+	Expect(t, len(c.CallStack()), "CALL then RST").ToEqual(2)
+
+	var out strings.Builder
+	c.PrintBacktrace(&out)
+	Expect(t, out.String(), "backtrace").ToEqual("#0  0x0038\n#1  0x0010 rst $38\n#2  0x0003 call 0x0010\n")
+
+	tick(2)
+	Expect(t, c.PC, "returned").ToEqual(uint16(0x0006))
+	Expect(t, c.CallDepth(), "unwound").ToEqual(0)
+
+	memory.requested = 1 << 0
+	tick(1)
+	Expect(t, c.PC, "EI delays IME by an instruction").ToEqual(uint16(0x0007))
+	tick(2)
+	Expect(t, c.PC, "VBlank handler").ToEqual(uint16(0x0040))
+	Expect(t, c.CallStack()[0].Kind, "interrupt frame").ToEqual(FRAME_INTERRUPT)
+	Expect(t, c.CallStack()[0].Site, "interrupted after LD B").ToEqual(uint16(0x0009))
+	Expect(t, c.IME(), "IME cleared by the dispatch").ToEqual(false)
+
+	tick(1)
+	Expect(t, c.PC, "RETI").ToEqual(uint16(0x0009))
+	Expect(t, c.IME(), "IME set by RETI").ToEqual(true)
+	Expect(t, c.CallDepth(), "interrupt returned").ToEqual(0)
+
+	// the subroutine resets SP and calls again, abandoning the frame of the first call
+	tick(3)
+	Expect(t, c.PC, "second call").ToEqual(uint16(0x0030))
+	frames := c.CallStack()
+	Expect(t, len(frames), "abandoned frame dropped").ToEqual(1)
+	Expect(t, frames[0].Site, "frame of the second call").ToEqual(uint16(0x0023))
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/carvhal/gby/internal/common"
+	"github.com/carvhal/gby/internal/symbols"
 )
 
 type register uint8
@@ -37,7 +38,10 @@ var flagMap = map[flag]byte{
 
 // instruction embeds an opcode and the context(operands) of an instruction
 type instruction struct {
-	opcode *opcode
+	opcode  *opcode
+	address uint16
+	bank    int     // ROM bank of address
+	bytes   [3]byte // opcode and operands as fetched
 	context
 }
 
@@ -46,41 +50,163 @@ func (i *instruction) execute() (cycle int, err error) {
 	return i.opcode.handler(i.context)
 }
 
+// executionObserver is implemented by memory buses watching the instructions executed
+type executionObserver interface {
+	Execute(address uint16)
+}
+
+// peeker is implemented by memory buses able to read without triggering their watchpoints,
+// instruction fetches and disassembly are not data reads
+type peeker interface {
+	Peek(address uint16, ammount int) ([]byte, error)
+}
+
+// romBanker is implemented by memory buses able to tell which ROM bank is mapped at an address
+type romBanker interface {
+	ROMBank(address uint16) int
+}
+
+// speedSwitcher is implemented by memory buses supporting the CGB double speed mode, switched by STOP
+type speedSwitcher interface {
+	SwitchSpeed() bool
+}
+
 type CPU struct {
-	A         byte   // Accumulator
-	F         byte   // Flag Register (stored in the hi nibble as ZNHC)
-	B, C      byte   // Register pair BC
-	D, E      byte   // Register pair DE
-	H, L      byte   // Register pair HL
-	sp        uint16 // Stack Pointer
-	PC        uint16 // Program Counter
-	memoryBus common.MemoryReadWriter
-	callStack []*instruction
+	A            byte   // Accumulator
+	F            byte   // Flag Register (stored in the hi nibble as ZNHC)
+	B, C         byte   // Register pair BC
+	D, E         byte   // Register pair DE
+	H, L         byte   // Register pair HL
+	sp           uint16 // Stack Pointer
+	PC           uint16 // Program Counter
+	memoryBus    common.MemoryReadWriter
+	history      history
+	callStack    []Frame // shadow call stack
+	ime          bool    // interrupt master enable
+	imeScheduled bool    // set by EI, IME is set after the next instruction
+	symbols      *symbols.Table
+	tracer       *Tracer
+
+	illegalOpcodes IllegalOpcodePolicy
+	locked         bool // locked up on an undefined opcode, it neither executes nor takes interrupts
+	stopped        bool // in the STOP low power mode until a button is pressed
+	halted         bool // halted by HALT until an interrupt is pending
 }
 
 func NewCPU(memoryReadWriter common.MemoryReadWriter) *CPU {
-	return &CPU{memoryBus: memoryReadWriter}
+	return &CPU{memoryBus: memoryReadWriter, history: newHistory(DEFAULT_HISTORY_SIZE)}
+}
+
+// SP returns the stack pointer
+func (c *CPU) SP() uint16 {
+	return c.sp
+}
+
+// SetSP sets the stack pointer
+func (c *CPU) SetSP(sp uint16) {
+	c.sp = sp
+}
+
+// SetSymbols sets the symbols used to show addresses, nil for none
+func (c *CPU) SetSymbols(table *symbols.Table) {
+	c.symbols = table
+}
+
+// Symbols returns the symbols used to show addresses, nil without symbols
+func (c *CPU) Symbols() *symbols.Table {
+	return c.symbols
+}
+
+// ROMBank returns the ROM bank mapped at address, 0 when the bus cannot tell
+func (c *CPU) ROMBank(address uint16) int {
+	if banker, ok := c.memoryBus.(romBanker); ok {
+		return banker.ROMBank(address)
+	}
+
+	return 0
+}
+
+// FormatAddress returns address in hexadecimal followed by its symbol in the ROM bank mapped now, if any
+func (c *CPU) FormatAddress(address uint16) string {
+	return c.formatAddress(c.ROMBank(address), address)
+}
+
+func (c *CPU) formatAddress(bank int, address uint16) string {
+	if symbol := c.symbols.Format(bank, address); symbol != "" {
+		return fmt.Sprintf("0x%04X <%s>", address, symbol)
+	}
+
+	return fmt.Sprintf("0x%04X", address)
+}
+
+// SetTracer logs the instructions executed with tracer, nil stops tracing,
+// it fails without attaching tracer when its condition does not evaluate on this CPU
+func (c *CPU) SetTracer(tracer *Tracer) error {
+	if tracer != nil && tracer.condition != nil {
+		if err := tracer.condition.Check(Environment{CPU: c, PC: c.PC}); err != nil {
+			return err
+		}
+	}
+
+	c.tracer = tracer
+
+	return nil
+}
+
+// peek reads memory through Peek when the bus supports it
+func (c *CPU) peek(address uint16, ammount int) ([]byte, error) {
+	if p, ok := c.memoryBus.(peeker); ok {
+		return p.Peek(address, ammount)
+	}
+
+	return c.memoryBus.ReadFromAddress(address, ammount)
 }
 
 // Tick fetches the next instuction and executes it, returning the number of cycles it took and an error if any
 func (c *CPU) Tick() (cycles int, err error) {
-	instruction, err := c.fetch()
-	fmt.Printf("0X%X\n", c.PC)
+	if c.locked {
+		return LOCKED_CYCLES, nil
+	}
+
+	if c.stopped && !c.wake() {
+		return STOPPED_CYCLES, nil
+	}
 
+	if c.halted && !c.wakeUp() {
+		return HALTED_CYCLES, nil
+	}
+
+	if dispatched, err := c.dispatchInterrupt(); dispatched || err != nil {
+		return 20, err
+	}
+
+	if observer, ok := c.memoryBus.(executionObserver); ok {
+		observer.Execute(c.PC)
+	}
+
+	if c.tracer != nil {
+		c.tracer.trace(c)
+	}
+
+	registers := c.Registers()
+
+	instruction, err := c.fetch()
 	if err != nil {
+		if c.lockUp(err) {
+			return LOCKED_CYCLES, nil
+		}
 		return 0, err
 	}
 
-	c.callStack = append(c.callStack, instruction)
+	c.record(instruction, registers)
 
-	return instruction.execute()
-}
-
-// PrintStack prints the opcodes and their contexts on stdout in the order they were called
-func (c *CPU) PrintStack() {
-	for i, instruction := range c.callStack {
-		fmt.Printf("[%d] opcode: %s (n8: 0x%X, e8: %v, n16: 0x%X) \n", i, instruction.opcode.mnemonic, instruction.context.n8, instruction.context.e8, instruction.context.n16)
+	enableIME := c.imeScheduled
+	cycles, err = instruction.execute()
+	if enableIME && c.imeScheduled {
+		c.ime, c.imeScheduled = true, false
 	}
+
+	return cycles, err
 }
 
 // setFlag sets the state of a flag
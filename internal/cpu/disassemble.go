@@ -0,0 +1,28 @@
+package cpu
+
+import (
+	"github.com/carvhal/gby/internal/disasm"
+)
+
+// Disassemble returns the instruction at address with its operands, and its size,
+// bytes that are not a known opcode are shown as data
+func (c *CPU) Disassemble(address uint16) (text string, size uint16) {
+	instruction, err := disasm.Decode(c.memoryBus, address)
+	if err != nil {
+		return "??", 1
+	}
+
+	return instruction.Format(c.label), instruction.Size()
+}
+
+// label returns the symbol at address in the ROM bank mapped now
+func (c *CPU) label(address uint16) (string, bool) {
+	return c.symbols.Lookup(c.ROMBank(address), address)
+}
+
+// IsCall reports whether the instruction at address pushes a return address (CALL, RST)
+func (c *CPU) IsCall(address uint16) bool {
+	instruction, err := disasm.Decode(c.memoryBus, address)
+
+	return err == nil && instruction.Flow() == disasm.FLOW_CALL
+}
@@ -0,0 +1,80 @@
+package cpu
+
+// Environment exposes the registers, flags and memory to expressions, the conditions of breakpoints,
+// watchpoints and traces
+type Environment struct {
+	CPU   *CPU
+	PC    uint16 // address of the instruction the expression is evaluated for
+	Hits  int
+	Value *byte // value accessed, for watchpoints
+}
+
+func (e Environment) Variable(name string) (int, bool) {
+	c := e.CPU
+
+	switch name {
+	case "A":
+		return int(c.A), true
+	case "F":
+		return int(c.F), true
+	case "B":
+		return int(c.B), true
+	case "C":
+		return int(c.C), true
+	case "D":
+		return int(c.D), true
+	case "E":
+		return int(c.E), true
+	case "H":
+		return int(c.H), true
+	case "L":
+		return int(c.L), true
+	case "AF":
+		return int(c.A)<<8 | int(c.F), true
+	case "BC":
+		return int(c.B)<<8 | int(c.C), true
+	case "DE":
+		return int(c.D)<<8 | int(c.E), true
+	case "HL":
+		return int(c.H)<<8 | int(c.L), true
+	case "SP":
+		return int(c.SP()), true
+	case "PC":
+		return int(e.PC), true
+	case "ZF":
+		return flagValue(c.getFlag(ZERO)), true
+	case "NF":
+		return flagValue(c.getFlag(SUBSTRACT)), true
+	case "HF":
+		return flagValue(c.getFlag(HALF_CARRY)), true
+	case "CF":
+		return flagValue(c.getFlag(CARRY)), true
+	case "HITS":
+		return e.Hits, true
+	case "VALUE":
+		if e.Value != nil {
+			return int(*e.Value), true
+		}
+	}
+
+	return 0, false
+}
+
+// flagValue returns the value of a flag in expressions
+func flagValue(set bool) int {
+	if set {
+		return 1
+	}
+
+	return 0
+}
+
+// ReadMemory reads without triggering watchpoints, unreadable addresses read 0xFF
+func (e Environment) ReadMemory(address uint16) byte {
+	value, err := e.CPU.peek(address, 1)
+	if err != nil {
+		return 0xFF
+	}
+
+	return value[0]
+}
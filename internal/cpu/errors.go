@@ -0,0 +1,34 @@
+package cpu
+
+import (
+	"fmt"
+
+	"github.com/carvhal/gby/internal/disasm"
+)
+
+// IllegalOpcodeError is an opcode the CPU cannot execute, one of the opcodes the SM83 leaves undefined
+// or one not implemented yet
+type IllegalOpcodeError struct {
+	Opcode   byte // opcode after the 0xCB prefix when Prefixed
+	Prefixed bool
+	PC       uint16
+	Bank     int // ROM bank mapped at PC
+}
+
+// Undefined reports whether the opcode is one of the opcodes the SM83 does not define, which lock the CPU up
+func (e *IllegalOpcodeError) Undefined() bool {
+	return !e.Prefixed && !disasm.DecodeBytes([]byte{e.Opcode, 0, 0}, e.PC).Legal()
+}
+
+func (e *IllegalOpcodeError) Error() string {
+	kind := "unknown"
+	if e.Undefined() {
+		kind = "illegal"
+	}
+
+	if e.Prefixed {
+		return fmt.Sprintf("%s opcode 0xCB 0x%02X at %02X:%04X", kind, e.Opcode, e.Bank, e.PC)
+	}
+
+	return fmt.Sprintf("%s opcode 0x%02X at %02X:%04X", kind, e.Opcode, e.Bank, e.PC)
+}
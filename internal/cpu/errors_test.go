@@ -0,0 +1,27 @@
+package cpu
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/carvhal/gby/internal/testutils"
+)
+
+func TestIllegalOpcodeError(t *testing.T) {
+	cpu := getMockCPU()
+	cpu.PC = 0x0150
+	copy(cpu.memoryBus.(*mockMemController).ram[0x0150:], []byte{0xD3})
+
+	_, err := cpu.Tick()
+
+	var illegal *IllegalOpcodeError
+	Expect(t, errors.As(err, &illegal), "error is an IllegalOpcodeError").ToEqual(true)
+	Expect(t, illegal.Opcode, "opcode").ToEqual(byte(0xD3))
+	Expect(t, illegal.Prefixed, "prefixed").ToEqual(false)
+	Expect(t, illegal.PC, "PC").ToEqual(uint16(0x0150))
+	Expect(t, illegal.Undefined(), "D3 is undefined").ToEqual(true)
+	Expect(t, err.Error(), "message").ToEqual("illegal opcode 0xD3 at 00:0150")
+
+	implemented := &IllegalOpcodeError{Opcode: 0xC3, PC: 0x0150}
+	Expect(t, implemented.Undefined(), "C3 is defined").ToEqual(false)
+}
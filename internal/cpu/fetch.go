@@ -9,7 +9,7 @@ func (c *CPU) fetch() (*instruction, error) {
 	var lookup map[byte]opcode = opcodeLookup
 
 	// fetch the opcode
-	opcodeSlice, err := c.memoryBus.ReadFromAddress(c.PC, 1)
+	opcodeSlice, err := c.peek(c.PC, 1)
 
 	if err != nil {
 		return nil, fmt.Errorf("cpu error on fetch: %w", err)
@@ -20,7 +20,7 @@ func (c *CPU) fetch() (*instruction, error) {
 
 	if isPrefixed {
 		lookup = cbPrefixedOpcodeLookup
-		opcodeSlice, err = c.memoryBus.ReadFromAddress(c.PC+1, 1)
+		opcodeSlice, err = c.peek(c.PC+1, 1)
 
 		if err != nil {
 			return nil, fmt.Errorf("cpu error on fetch: %w", err)
@@ -30,17 +30,24 @@ func (c *CPU) fetch() (*instruction, error) {
 	opcode, ok := lookup[opcodeSlice[0]]
 
 	if !ok {
-		return nil, fmt.Errorf("cpu error on fetch: illegal / unknown opcode 0x%X prefixed: %v", opcodeSlice[0], isPrefixed)
+		return nil, &IllegalOpcodeError{Opcode: opcodeSlice[0], Prefixed: isPrefixed, PC: c.PC, Bank: c.ROMBank(c.PC)}
 	}
 
 	// build context for the instruction
 	context := context{cpu: c}
 
-	operands, err := c.memoryBus.ReadFromAddress(c.PC+1, int(opcode.size))
+	operands, err := c.peek(c.PC+1, int(opcode.size))
 	if err != nil {
 		return nil, fmt.Errorf("cpu error on fetch: %w", err)
 	}
 
+	var bytes [3]byte
+	bytes[0] = 0xCB
+	if !isPrefixed {
+		bytes[0] = opcodeSlice[0]
+	}
+	copy(bytes[1:opcode.size], operands)
+
 	switch opcode.size {
 	case 1:
 	case 2:
@@ -50,8 +57,9 @@ func (c *CPU) fetch() (*instruction, error) {
 		context.n16 = mergeBytesToUint16(operands[1], operands[0])
 	}
 
+	address := c.PC
 	c.PC += opcode.size
 
-	return &instruction{opcode: &opcode, context: context}, nil
+	return &instruction{opcode: &opcode, address: address, bank: c.ROMBank(address), bytes: bytes, context: context}, nil
 
 }
@@ -0,0 +1,112 @@
+package cpu
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/carvhal/gby/internal/disasm"
+)
+
+// DEFAULT_HISTORY_SIZE is the number of instructions remembered by a new CPU
+const DEFAULT_HISTORY_SIZE = 1024
+
+// Registers is a copy of the registers of the CPU
+type Registers struct {
+	A, F, B, C, D, E, H, L byte
+	SP, PC                 uint16
+}
+
+func (r Registers) String() string {
+	return fmt.Sprintf("A:%02X F:%02X B:%02X C:%02X D:%02X E:%02X H:%02X L:%02X SP:%04X",
+		r.A, r.F, r.B, r.C, r.D, r.E, r.H, r.L, r.SP)
+}
+
+// Registers returns a copy of the registers
+func (c *CPU) Registers() Registers {
+	return Registers{A: c.A, F: c.F, B: c.B, C: c.C, D: c.D, E: c.E, H: c.H, L: c.L, SP: c.sp, PC: c.PC}
+}
+
+// HistoryEntry is an executed instruction, with the registers before it ran
+type HistoryEntry struct {
+	Bank      int     // ROM bank mapped at Registers.PC
+	Bytes     [3]byte // opcode and operands, Size of them are used
+	Size      uint16
+	Registers Registers
+}
+
+// Instruction decodes the entry
+func (e HistoryEntry) Instruction() disasm.Instruction {
+	return disasm.DecodeBytes(e.Bytes[:e.Size], e.Registers.PC)
+}
+
+// history is a ring buffer of the last instructions executed, allocated once
+type history struct {
+	entries []HistoryEntry
+	next    int
+	full    bool
+}
+
+func newHistory(size int) history {
+	return history{entries: make([]HistoryEntry, size)}
+}
+
+func (h *history) add(entry HistoryEntry) {
+	if len(h.entries) == 0 {
+		return
+	}
+
+	h.entries[h.next] = entry
+	h.next++
+	if h.next == len(h.entries) {
+		h.next, h.full = 0, true
+	}
+}
+
+// list returns the entries, oldest first
+func (h *history) list() []HistoryEntry {
+	if !h.full {
+		return append([]HistoryEntry(nil), h.entries[:h.next]...)
+	}
+
+	return append(append([]HistoryEntry(nil), h.entries[h.next:]...), h.entries[:h.next]...)
+}
+
+// SetHistorySize sets how many instructions are remembered, 0 disables the history, the history is cleared
+func (c *CPU) SetHistorySize(size int) {
+	c.history = newHistory(max(size, 0))
+}
+
+// History returns the last instructions executed, oldest first
+func (c *CPU) History() []HistoryEntry {
+	return c.history.list()
+}
+
+// record adds the instruction about to run to the history, registers are the ones before its fetch
+func (c *CPU) record(instruction *instruction, registers Registers) {
+	c.history.add(HistoryEntry{
+		Bank:      instruction.bank,
+		Bytes:     instruction.bytes,
+		Size:      instruction.opcode.size,
+		Registers: registers,
+	})
+}
+
+// PrintHistory writes the last count instructions executed, all for 0, disassembled with the registers before they ran
+func (c *CPU) PrintHistory(w io.Writer, count int) {
+	entries := c.History()
+	if count > 0 && count < len(entries) {
+		entries = entries[len(entries)-count:]
+	}
+
+	for _, entry := range entries {
+		label := func(address uint16) (string, bool) {
+			bank := entry.Bank
+			if address < 0x4000 || address > 0x7FFF {
+				bank = 0
+			}
+			return c.symbols.Lookup(bank, address)
+		}
+
+		fmt.Fprintf(w, "%-24s %-20s %s\n", c.formatAddress(entry.Bank, entry.Registers.PC), entry.Instruction().Format(label), entry.Registers)
+	}
+}
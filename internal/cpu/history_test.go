@@ -0,0 +1,48 @@
+package cpu
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/carvhal/gby/internal/testutils"
+)
+
+func TestHistory(t *testing.T) {
+	c := getMockCPU()
+	copy(c.memoryBus.(*mockMemController).ram, []byte{
+		0x06, 0x03, // LD B $03
+		0x05,       // DEC B
+		0x20, 0xFD, // JR NZ $0002
+		0xCB, 0x7C, // BIT 7 H
+	})
+	c.SetHistorySize(3)
+
+	for i := 0; i < 7; i++ {
+		_, err := c.Tick()
+		Must(t, err, "Expected no error: %v")
+	}
+
+	history := c.History()
+	Expect(t, len(history), "bounded").ToEqual(3)
+
+	pcs := []uint16{history[0].Registers.PC, history[1].Registers.PC, history[2].Registers.PC}
+	Expect(t, pcs, "oldest first").ToEqual([]uint16{0x0003, 0x0002, 0x0003})
+	Expect(t, history[1].Registers.B, "registers before the instruction").ToEqual(byte(1))
+	Expect(t, history[2].Instruction().String(), "decoded").ToEqual("jr nz, $0002")
+
+	_, err := c.Tick()
+	Must(t, err, "Expected no error: %v")
+	Expect(t, c.History()[2].Instruction().String(), "prefixed").ToEqual("bit 7, h")
+
+	var out strings.Builder
+	c.PrintHistory(&out, 2)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	Expect(t, len(lines), "tail").ToEqual(2)
+	Expect(t, strings.HasPrefix(lines[1], "0x0005"), "last instruction").ToEqual(true)
+	Expect(t, strings.Contains(lines[1], "bit 7, h"), "disassembled").ToEqual(true)
+	Expect(t, strings.HasSuffix(lines[0], "A:00 F:C0 B:00 C:00 D:00 E:00 H:00 L:00 SP:0000"), "registers").ToEqual(true)
+
+	c.SetHistorySize(0)
+	_, err = c.Tick()
+	Expect(t, len(c.History()), "disabled").ToEqual(0)
+}
@@ -0,0 +1,57 @@
+package cpu
+
+// interruptController is implemented by memory buses raising interrupts (IF and IE)
+type interruptController interface {
+	PendingInterrupt() (interrupt byte, ok bool) // highest priority interrupt requested and enabled
+	AcknowledgeInterrupt(interrupt byte)
+}
+
+// HALTED_CYCLES is the number of cycles a halted CPU reports per Tick, so the rest of the machine keeps running
+const HALTED_CYCLES = 4
+
+// IME returns the interrupt master enable flag
+func (c *CPU) IME() bool {
+	return c.ime
+}
+
+// dispatchInterrupt calls the handler of the pending interrupt when IME is set, at 0x40 + 8 * interrupt,
+// it reports whether an interrupt was dispatched
+func (c *CPU) dispatchInterrupt() (bool, error) {
+	controller, ok := c.memoryBus.(interruptController)
+	if !ok || !c.ime {
+		return false, nil
+	}
+
+	interrupt, ok := controller.PendingInterrupt()
+	if !ok {
+		return false, nil
+	}
+
+	controller.AcknowledgeInterrupt(interrupt)
+	c.ime = false
+
+	return true, c.callSubroutine(Frame{Kind: FRAME_INTERRUPT, Site: c.PC, Target: 0x40 + 8*uint16(interrupt), Interrupt: interrupt})
+}
+
+// Halted reports whether the CPU is halted by HALT, waiting for an interrupt
+func (c *CPU) Halted() bool {
+	return c.halted
+}
+
+// halt executes HALT, the CPU waits for an interrupt unless one is already pending
+func (c *CPU) halt() {
+	c.halted = true
+	c.wakeUp()
+}
+
+// wakeUp leaves HALT once an interrupt is requested and enabled, whatever IME, it reports whether the CPU is running.
+// The interrupt is only dispatched with IME set, otherwise the execution goes on after HALT
+func (c *CPU) wakeUp() bool {
+	if controller, ok := c.memoryBus.(interruptController); ok {
+		if _, pending := controller.PendingInterrupt(); pending {
+			c.halted = false
+		}
+	}
+
+	return !c.halted
+}
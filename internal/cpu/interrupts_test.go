@@ -0,0 +1,116 @@
+package cpu
+
+import (
+	"math/bits"
+	"testing"
+
+	. "github.com/carvhal/gby/internal/testutils"
+)
+
+// mockInterruptController is a memory raising the interrupts requested in pending
+type mockInterruptController struct {
+	mockMemController
+	pending byte
+}
+
+func (c *mockInterruptController) PendingInterrupt() (byte, bool) {
+	if c.pending == 0 {
+		return 0, false
+	}
+
+	return byte(bits.TrailingZeros8(c.pending)), true
+}
+
+func (c *mockInterruptController) AcknowledgeInterrupt(interrupt byte) {
+	c.pending &^= 1 << interrupt
+}
+
+func newInterruptCPU(program ...byte) (*CPU, *mockInterruptController) {
+	bus := &mockInterruptController{mockMemController: mockMemController{ram: make([]byte, 0x10000)}}
+	copy(bus.ram, program)
+
+	c := NewCPU(bus)
+	c.sp = 0xFFFE
+
+	return c, bus
+}
+
+func TestInterruptDispatch(t *testing.T) {
+	c, bus := newInterruptCPU(
+		0xFB,       // EI
+		0x3E, 0x01, // LD A $01
+		0x3E, 0x02, // LD A $02
+	)
+	bus.pending = 1<<2 | 1<<4 // timer and joypad
+
+	tick := func() int {
+		cycles, err := c.Tick()
+		Must(t, err, "Expected no error: %v")
+		return cycles
+	}
+
+	tick()
+	Expect(t, c.IME(), "IME right after EI").ToEqual(false)
+
+	tick()
+	Expect(t, c.IME(), "IME after the instruction following EI").ToEqual(true)
+	Expect(t, c.PC, "the instruction following EI runs before the interrupt").ToEqual(uint16(0x0003))
+
+	Expect(t, tick(), "dispatch cycles").ToEqual(20)
+	Expect(t, c.PC, "timer handler, the highest priority interrupt").ToEqual(uint16(0x0050))
+	Expect(t, c.IME(), "IME during the handler").ToEqual(false)
+	Expect(t, bus.pending, "acknowledged").ToEqual(byte(1 << 4))
+	Expect(t, bus.ram[0xFFFC:0xFFFE], "return address").ToEqual([]byte{0x03, 0x00})
+}
+
+func TestInterruptDisabled(t *testing.T) {
+	c, bus := newInterruptCPU(
+		0xFB,       // EI
+		0xF3,       // DI
+		0x3E, 0x01, // LD A $01
+	)
+	bus.pending = 1
+
+	for i := 0; i < 3; i++ {
+		_, err := c.Tick()
+		Must(t, err, "Expected no error: %v")
+	}
+
+	Expect(t, c.PC, "DI right after EI keeps interrupts disabled").ToEqual(uint16(0x0004))
+	Expect(t, bus.pending, "still requested").ToEqual(byte(1))
+}
+
+func TestHalt(t *testing.T) {
+	tests := []struct {
+		name     string
+		ime      bool
+		expected uint16 // PC once woken up
+	}{
+		{"dispatched with IME", true, 0x0040},
+		{"resumed after HALT without IME", false, 0x0003},
+	}
+
+	for _, test := range tests {
+		c, bus := newInterruptCPU(
+			0x76,       // HALT
+			0x3E, 0x01, // LD A $01
+		)
+		c.ime = test.ime
+
+		tick := func() int {
+			cycles, err := c.Tick()
+			Must(t, err, "Expected no error: %v")
+			return cycles
+		}
+
+		tick()
+		Expect(t, c.Halted(), test.name+": halted").ToEqual(true)
+		Expect(t, tick(), test.name+": halted cycles").ToEqual(HALTED_CYCLES)
+		Expect(t, c.PC, test.name+": PC while halted").ToEqual(uint16(0x0001))
+
+		bus.pending = 1
+		tick()
+		Expect(t, c.Halted(), test.name+": halted once an interrupt is pending").ToEqual(false)
+		Expect(t, c.PC, test.name+": PC").ToEqual(test.expected)
+	}
+}
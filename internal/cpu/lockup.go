@@ -0,0 +1,38 @@
+package cpu
+
+import "errors"
+
+// IllegalOpcodePolicy tells what the CPU does on the opcodes the SM83 leaves undefined
+// (0xD3, 0xDB, 0xDD, 0xE3, 0xE4, 0xEB, 0xEC, 0xED, 0xF4, 0xFC, 0xFD)
+type IllegalOpcodePolicy byte
+
+const (
+	ILLEGAL_OPCODE_ERROR  IllegalOpcodePolicy = iota // Tick returns an IllegalOpcodeError
+	ILLEGAL_OPCODE_LOCKUP                            // the CPU locks up as the hardware does, the rest of the machine keeps running
+)
+
+// LOCKED_CYCLES is the number of cycles a locked up CPU reports per Tick, so the rest of the machine keeps running
+const LOCKED_CYCLES = 4
+
+// SetIllegalOpcodePolicy sets what the CPU does on undefined opcodes, ILLEGAL_OPCODE_ERROR by default
+func (c *CPU) SetIllegalOpcodePolicy(policy IllegalOpcodePolicy) {
+	c.illegalOpcodes = policy
+}
+
+// Locked reports whether the CPU locked up on an undefined opcode, only a reset gets it out
+func (c *CPU) Locked() bool {
+	return c.locked
+}
+
+// lockUp locks the CPU when err is an undefined opcode and the policy emulates the hardware,
+// opcodes that are only not implemented are still errors
+func (c *CPU) lockUp(err error) bool {
+	var illegal *IllegalOpcodeError
+	if c.illegalOpcodes != ILLEGAL_OPCODE_LOCKUP || !errors.As(err, &illegal) || !illegal.Undefined() {
+		return false
+	}
+
+	c.locked = true
+
+	return true
+}
@@ -0,0 +1,32 @@
+package cpu
+
+import (
+	"testing"
+
+	. "github.com/carvhal/gby/internal/testutils"
+)
+
+func TestIllegalOpcodeLockup(t *testing.T) {
+	cpu := getMockCPU()
+	cpu.SetIllegalOpcodePolicy(ILLEGAL_OPCODE_LOCKUP)
+	cpu.PC = 0x0150
+	copy(cpu.memoryBus.(*mockMemController).ram[0x0150:], []byte{0xFD})
+
+	for i := 0; i < 3; i++ {
+		cycles, err := cpu.Tick()
+		Must(t, err, "Expected no error on a locked up CPU: %v")
+		Expect(t, cycles, "cycles").ToEqual(LOCKED_CYCLES)
+	}
+
+	Expect(t, cpu.Locked(), "locked").ToEqual(true)
+	Expect(t, cpu.PC, "PC stays on the opcode").ToEqual(uint16(0x0150))
+
+	// opcodes that are not implemented are still errors
+	cpu = getMockCPU()
+	cpu.SetIllegalOpcodePolicy(ILLEGAL_OPCODE_LOCKUP)
+	copy(cpu.memoryBus.(*mockMemController).ram, []byte{0xCB, 0x30})
+
+	_, err := cpu.Tick()
+	Expect(t, err != nil, "unimplemented opcode error").ToEqual(true)
+	Expect(t, cpu.Locked(), "locked").ToEqual(false)
+}
@@ -1,10 +1,10 @@
 package cpu
 
-// opcode is a struct that holds the metadata and handler function for an opcode
+// opcode is a struct that holds the size and handler function for an opcode,
+// the mnemonics are in the templates of the disasm package
 type opcode struct {
-	mnemonic string
-	size     uint16
-	handler  func(context context) (duration int, err error) // duration in clock cycles, divide by 4 to get duration in machine cycles
+	size    uint16
+	handler func(context context) (duration int, err error) // duration in clock cycles, divide by 4 to get duration in machine cycles
 }
 
 // context is a struct that holds the operands of an instruction and a pointer to the CPU
@@ -90,8 +90,8 @@ func (c *CPU) pop() (hi byte, lo byte, err error) {
 	return bytes[1], bytes[0], err
 }
 
-// callSubroutine calls a subroutine at the given address
-func (c *CPU) callSubroutine(address uint16) error {
+// callSubroutine calls a subroutine at frame.Target, recording frame in the shadow call stack
+func (c *CPU) callSubroutine(frame Frame) error {
 	// Write current pc to stack
 	err := c.push(c.PC)
 
@@ -99,12 +99,67 @@ func (c *CPU) callSubroutine(address uint16) error {
 		return err
 	}
 
+	c.pushFrame(frame)
+
 	// JMP to address
-	c.PC = address
+	c.PC = frame.Target
+
+	return nil
+}
+
+// returnFromSubroutine pops the return address into PC, unwinding the shadow call stack,
+// returns without a matching call (pushing an address and returning to jump) only drop abandoned frames
+func (c *CPU) returnFromSubroutine() error {
+	sp := c.sp
+	hi, lo, err := c.pop()
+
+	if err != nil {
+		return err
+	}
+
+	c.dropFrames(sp)
+	c.PC = mergeBytesToUint16(hi, lo)
 
 	return nil
 }
 
+// conditions maps the condition of the conditional jumps, calls and returns (bits 3-4 of their opcode) to their test
+var conditions = [4]func(c *CPU) bool{
+	func(c *CPU) bool { return !c.getFlag(ZERO) },
+	func(c *CPU) bool { return c.getFlag(ZERO) },
+	func(c *CPU) bool { return !c.getFlag(CARRY) },
+	func(c *CPU) bool { return c.getFlag(CARRY) },
+}
+
+// conditionalCall returns the handler of CALL cc n16
+func conditionalCall(code byte) func(ctx context) (int, error) {
+	return func(ctx context) (int, error) {
+		if !conditions[code>>3&3](ctx.cpu) {
+			return 12, nil
+		}
+
+		return 24, ctx.cpu.callSubroutine(Frame{Kind: FRAME_CALL, Site: ctx.cpu.PC - 3, Target: ctx.n16})
+	}
+}
+
+// conditionalReturn returns the handler of RET cc
+func conditionalReturn(code byte) func(ctx context) (int, error) {
+	return func(ctx context) (int, error) {
+		if !conditions[code>>3&3](ctx.cpu) {
+			return 8, nil
+		}
+
+		return 20, ctx.cpu.returnFromSubroutine()
+	}
+}
+
+// restart returns the handler of RST, which calls the vector in bits 3-5 of its opcode
+func restart(code byte) func(ctx context) (int, error) {
+	return func(ctx context) (int, error) {
+		return 16, ctx.cpu.callSubroutine(Frame{Kind: FRAME_RST, Site: ctx.cpu.PC - 1, Target: uint16(code & 0x38)})
+	}
+}
+
 // rotateLeft rotates a register to the left by one and set's the shiftedBit to the carry flag
 // the old carry flag becomes the 8th bit of the register, implements the behaviour of RL N
 func (c *CPU) rotateLeft(register *byte) {
@@ -139,25 +194,25 @@ func (c *CPU) rotateLeft(register *byte) {
 
 // opcodeLookup is a map of opcodes to their handler functions and metadata
 var opcodeLookup = map[byte]opcode{
-	0x01: {mnemonic: "LD BC n16", size: 3, handler: func(ctx context) (int, error) {
+	0x01: {size: 3, handler: func(ctx context) (int, error) {
 		load16Bit(&ctx.cpu.B, &ctx.cpu.C, ctx.n16)
 
 		return 12, nil
 	}},
 
-	0x21: {mnemonic: "LD HL n16", size: 3, handler: func(ctx context) (int, error) {
+	0x21: {size: 3, handler: func(ctx context) (int, error) {
 		load16Bit(&ctx.cpu.H, &ctx.cpu.L, ctx.n16)
 
 		return 12, nil
 	}},
 
-	0x31: {mnemonic: "LD SP n16", size: 3, handler: func(ctx context) (int, error) {
+	0x31: {size: 3, handler: func(ctx context) (int, error) {
 		ctx.cpu.sp = ctx.n16
 
 		return 12, nil
 	}},
 
-	0x32: {mnemonic: "LD [HL-],A", size: 1, handler: func(ctx context) (int, error) {
+	0x32: {size: 1, handler: func(ctx context) (int, error) {
 		hl := mergeBytesToUint16(ctx.cpu.H, ctx.cpu.L)
 
 		err := ctx.cpu.memoryBus.WriteToAddress(hl, []byte{ctx.cpu.A})
@@ -171,26 +226,26 @@ var opcodeLookup = map[byte]opcode{
 		return 8, nil
 	}},
 
-	0x0E: {mnemonic: "LD C n8", size: 2, handler: func(ctx context) (int, error) {
+	0x0E: {size: 2, handler: func(ctx context) (int, error) {
 		load8bit(&ctx.cpu.C, ctx.n8)
 
 		return 8, nil
 	}},
 
-	0x3E: {mnemonic: "LD A n8", size: 2, handler: func(ctx context) (int, error) {
+	0x3E: {size: 2, handler: func(ctx context) (int, error) {
 		load8bit(&ctx.cpu.A, ctx.n8)
 
 		return 8, nil
 	}},
 
-	0xAF: {mnemonic: "XOR A,A", size: 1, handler: func(ctx context) (int, error) {
+	0xAF: {size: 1, handler: func(ctx context) (int, error) {
 		ctx.cpu.A = 0
 		ctx.cpu.setFlag(ZERO, true)
 
 		return 4, nil
 	}},
 
-	0x20: {mnemonic: "JR NZ e8", size: 2, handler: func(ctx context) (int, error) {
+	0x20: {size: 2, handler: func(ctx context) (int, error) {
 
 		if !ctx.cpu.getFlag(ZERO) {
 			offset := ctx.e8
@@ -203,7 +258,7 @@ var opcodeLookup = map[byte]opcode{
 		return 8, nil
 	}},
 
-	0xE2: {mnemonic: "LD [C] A", size: 1, handler: func(ctx context) (int, error) {
+	0xE2: {size: 1, handler: func(ctx context) (int, error) {
 		offset := uint16(0xFF00)
 		address := offset + uint16(ctx.cpu.C)
 
@@ -216,13 +271,13 @@ var opcodeLookup = map[byte]opcode{
 		return 8, nil
 	}},
 
-	0x0C: {mnemonic: "INC C", size: 1, handler: func(ctx context) (int, error) {
+	0x0C: {size: 1, handler: func(ctx context) (int, error) {
 		ctx.cpu.incrementRegister(&ctx.cpu.C)
 
 		return 4, nil
 	}},
 
-	0x77: {mnemonic: "LD [HL] A", size: 1, handler: func(ctx context) (int, error) {
+	0x77: {size: 1, handler: func(ctx context) (int, error) {
 		hl := mergeBytesToUint16(ctx.cpu.H, ctx.cpu.L)
 		err := ctx.cpu.memoryBus.WriteToAddress(hl, []byte{ctx.cpu.A})
 
@@ -234,7 +289,7 @@ var opcodeLookup = map[byte]opcode{
 	}},
 
 	// TODO: test me
-	0xE0: {mnemonic: "LDH (N), A", size: 2, handler: func(ctx context) (int, error) {
+	0xE0: {size: 2, handler: func(ctx context) (int, error) {
 		offset := uint16(0xFF00)
 		address := offset + uint16(ctx.n8)
 
@@ -247,13 +302,13 @@ var opcodeLookup = map[byte]opcode{
 		return 12, nil
 	}},
 
-	0x11: {mnemonic: "LD DE n16", size: 3, handler: func(ctx context) (int, error) {
+	0x11: {size: 3, handler: func(ctx context) (int, error) {
 		load16Bit(&ctx.cpu.D, &ctx.cpu.E, ctx.n16)
 
 		return 12, nil
 	}},
 
-	0x1A: {mnemonic: "LD A [DE]", size: 1, handler: func(ctx context) (int, error) {
+	0x1A: {size: 1, handler: func(ctx context) (int, error) {
 		DE := mergeBytesToUint16(ctx.cpu.D, ctx.cpu.E)
 		bytes, err := ctx.cpu.memoryBus.ReadFromAddress(DE, 1)
 
@@ -269,23 +324,71 @@ var opcodeLookup = map[byte]opcode{
 	}},
 
 	// TODO: test me
-	0xCD: {mnemonic: "CALL n16", size: 3, handler: func(ctx context) (int, error) {
-		return 24, ctx.cpu.callSubroutine(ctx.n16)
+	0xCD: {size: 3, handler: func(ctx context) (int, error) {
+		return 24, ctx.cpu.callSubroutine(Frame{Kind: FRAME_CALL, Site: ctx.cpu.PC - 3, Target: ctx.n16})
+	}},
+
+	0xC9: {size: 1, handler: func(ctx context) (int, error) {
+		return 16, ctx.cpu.returnFromSubroutine()
+	}},
+
+	0xD9: {size: 1, handler: func(ctx context) (int, error) {
+		ctx.cpu.ime = true
+
+		return 16, ctx.cpu.returnFromSubroutine()
+	}},
+
+	0xC4: {size: 3, handler: conditionalCall(0xC4)},
+	0xCC: {size: 3, handler: conditionalCall(0xCC)},
+	0xD4: {size: 3, handler: conditionalCall(0xD4)},
+	0xDC: {size: 3, handler: conditionalCall(0xDC)},
+
+	0xC0: {size: 1, handler: conditionalReturn(0xC0)},
+	0xC8: {size: 1, handler: conditionalReturn(0xC8)},
+	0xD0: {size: 1, handler: conditionalReturn(0xD0)},
+	0xD8: {size: 1, handler: conditionalReturn(0xD8)},
+
+	0xC7: {size: 1, handler: restart(0xC7)},
+	0xCF: {size: 1, handler: restart(0xCF)},
+	0xD7: {size: 1, handler: restart(0xD7)},
+	0xDF: {size: 1, handler: restart(0xDF)},
+	0xE7: {size: 1, handler: restart(0xE7)},
+	0xEF: {size: 1, handler: restart(0xEF)},
+	0xF7: {size: 1, handler: restart(0xF7)},
+	0xFF: {size: 1, handler: restart(0xFF)},
+
+	0xF3: {size: 1, handler: func(ctx context) (int, error) {
+		ctx.cpu.ime, ctx.cpu.imeScheduled = false, false
+
+		return 4, nil
+	}},
+
+	0x76: {size: 1, handler: func(ctx context) (int, error) {
+		ctx.cpu.halt()
+
+		return 4, nil
 	}},
 
-	0x4F: {mnemonic: "LD C A", size: 1, handler: func(ctx context) (int, error) {
+	// IME is set after the instruction following EI
+	0xFB: {size: 1, handler: func(ctx context) (int, error) {
+		ctx.cpu.imeScheduled = true
+
+		return 4, nil
+	}},
+
+	0x4F: {size: 1, handler: func(ctx context) (int, error) {
 		load8bit(&ctx.cpu.C, ctx.cpu.A)
 
 		return 4, nil
 	}},
 
-	0x06: {mnemonic: "LD B n8", size: 2, handler: func(ctx context) (int, error) {
+	0x06: {size: 2, handler: func(ctx context) (int, error) {
 		load8bit(&ctx.cpu.B, ctx.n8)
 
 		return 8, nil
 	}},
 
-	0xC5: {mnemonic: "PUSH BC", size: 1, handler: func(ctx context) (int, error) {
+	0xC5: {size: 1, handler: func(ctx context) (int, error) {
 		err := ctx.cpu.push(mergeBytesToUint16(ctx.cpu.B, ctx.cpu.C))
 
 		if err != nil {
@@ -295,7 +398,7 @@ var opcodeLookup = map[byte]opcode{
 		return 16, nil
 	}},
 
-	0x17: {mnemonic: "RLA", size: 1, handler: func(ctx context) (int, error) {
+	0x17: {size: 1, handler: func(ctx context) (int, error) {
 		ctx.cpu.rotateLeft(&ctx.cpu.A)
 
 		ctx.cpu.setFlag(ZERO, false)
@@ -303,7 +406,7 @@ var opcodeLookup = map[byte]opcode{
 		return 4, nil
 	}},
 
-	0xC1: {mnemonic: "POP BC", size: 1, handler: func(ctx context) (int, error) {
+	0xC1: {size: 1, handler: func(ctx context) (int, error) {
 		hi, lo, err := ctx.cpu.pop()
 
 		if err != nil {
@@ -314,22 +417,26 @@ var opcodeLookup = map[byte]opcode{
 		return 12, nil
 	}},
 
-	0x05: {mnemonic: "DEC B", size: 1, handler: func(ctx context) (int, error) {
+	0x05: {size: 1, handler: func(ctx context) (int, error) {
 		ctx.cpu.decrementRegister(&ctx.cpu.B)
 		return 4, nil
 	}},
+
+	0x10: {size: 2, handler: func(ctx context) (int, error) {
+		return ctx.cpu.stop(), nil
+	}},
 }
 
 // cbPrefixedOpcodeLookup is a map of opcodes to their handler functions and metadata
 var cbPrefixedOpcodeLookup = map[byte]opcode{
 	// TODO - tests
-	0x7C: {mnemonic: "BIT 7 H", size: 2, handler: func(ctx context) (int, error) {
+	0x7C: {size: 2, handler: func(ctx context) (int, error) {
 		ctx.cpu.checkBit(7, ctx.cpu.H)
 
 		return 8, nil
 	}},
 
-	0x11: {mnemonic: "RL C", size: 2, handler: func(ctx context) (int, error) {
+	0x11: {size: 2, handler: func(ctx context) (int, error) {
 		ctx.cpu.rotateLeft(&ctx.cpu.C)
 		return 8, nil
 	}},
@@ -3,6 +3,7 @@ package cpu
 import (
 	"testing"
 
+	"github.com/carvhal/gby/internal/disasm"
 	. "github.com/carvhal/gby/internal/testutils"
 )
 
@@ -203,6 +204,116 @@ func TestOpcodes(t *testing.T) {
 				Expect(t, c.cpu.getFlag(HALF_CARRY), "Half-Carry flag").ToEqual(true)
 			},
 		},
+		{
+			name:   "CALL NZ n16 - taken",
+			opcode: 0xC4,
+			cycles: 24,
+			setup: func(c *context) {
+				c.cpu.sp, c.cpu.PC, c.n16 = 0xFFFE, 0x0153, 0x4000
+				c.cpu.setFlag(ZERO, false)
+			},
+			expected: func(t *testing.T, c context) {
+				Expect(t, c.cpu.PC, "PC").ToEqual(uint16(0x4000))
+				Expect(t, c.cpu.sp, "SP").ToEqual(uint16(0xFFFC))
+
+				returnAddress, _ := c.cpu.memoryBus.ReadFromAddress(0xFFFC, 2)
+				Expect(t, returnAddress, "return address").ToEqual([]byte{0x53, 0x01})
+			},
+		},
+		{
+			name:   "CALL C n16 - not taken",
+			opcode: 0xDC,
+			cycles: 12,
+			setup: func(c *context) {
+				c.cpu.sp, c.cpu.PC, c.n16 = 0xFFFE, 0x0153, 0x4000
+				c.cpu.setFlag(CARRY, false)
+			},
+			expected: func(t *testing.T, c context) {
+				Expect(t, c.cpu.PC, "PC").ToEqual(uint16(0x0153))
+				Expect(t, c.cpu.sp, "SP").ToEqual(uint16(0xFFFE))
+			},
+		},
+		{
+			name:   "RET",
+			opcode: 0xC9,
+			cycles: 16,
+			setup: func(c *context) {
+				c.cpu.sp = 0xFFFC
+				c.cpu.memoryBus.WriteToAddress(0xFFFC, []byte{0x53, 0x01})
+			},
+			expected: func(t *testing.T, c context) {
+				Expect(t, c.cpu.PC, "PC").ToEqual(uint16(0x0153))
+				Expect(t, c.cpu.sp, "SP").ToEqual(uint16(0xFFFE))
+			},
+		},
+		{
+			name:   "RET Z - not taken",
+			opcode: 0xC8,
+			cycles: 8,
+			setup: func(c *context) {
+				c.cpu.sp, c.cpu.PC = 0xFFFC, 0x0200
+				c.cpu.setFlag(ZERO, false)
+			},
+			expected: func(t *testing.T, c context) {
+				Expect(t, c.cpu.PC, "PC").ToEqual(uint16(0x0200))
+				Expect(t, c.cpu.sp, "SP").ToEqual(uint16(0xFFFC))
+			},
+		},
+		{
+			name:   "RET NC - taken",
+			opcode: 0xD0,
+			cycles: 20,
+			setup: func(c *context) {
+				c.cpu.sp = 0xFFFC
+				c.cpu.memoryBus.WriteToAddress(0xFFFC, []byte{0x53, 0x01})
+				c.cpu.setFlag(CARRY, false)
+			},
+			expected: func(t *testing.T, c context) {
+				Expect(t, c.cpu.PC, "PC").ToEqual(uint16(0x0153))
+			},
+		},
+		{
+			name:   "RETI",
+			opcode: 0xD9,
+			cycles: 16,
+			setup: func(c *context) {
+				c.cpu.sp = 0xFFFC
+				c.cpu.memoryBus.WriteToAddress(0xFFFC, []byte{0x53, 0x01})
+			},
+			expected: func(t *testing.T, c context) {
+				Expect(t, c.cpu.PC, "PC").ToEqual(uint16(0x0153))
+				Expect(t, c.cpu.ime, "IME").ToEqual(true)
+			},
+		},
+		{
+			name:   "RST $38",
+			opcode: 0xFF,
+			cycles: 16,
+			setup:  func(c *context) { c.cpu.sp, c.cpu.PC = 0xFFFE, 0x0151 },
+			expected: func(t *testing.T, c context) {
+				Expect(t, c.cpu.PC, "PC").ToEqual(uint16(0x0038))
+
+				returnAddress, _ := c.cpu.memoryBus.ReadFromAddress(0xFFFC, 2)
+				Expect(t, returnAddress, "return address").ToEqual([]byte{0x51, 0x01})
+			},
+		},
+		{
+			name:     "EI",
+			opcode:   0xFB,
+			cycles:   4,
+			setup:    func(c *context) {},
+			expected: func(t *testing.T, c context) { Expect(t, c.cpu.imeScheduled, "IME scheduled").ToEqual(true) },
+		},
+		{
+			name:   "DI",
+			opcode: 0xF3,
+			cycles: 4,
+			setup:  func(c *context) { c.cpu.ime, c.cpu.imeScheduled = true, true },
+			expected: func(t *testing.T, c context) {
+				Expect(t, c.cpu.ime, "IME").ToEqual(false)
+				Expect(t, c.cpu.imeScheduled, "IME scheduled").ToEqual(false)
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -229,3 +340,15 @@ func TestOpcodes(t *testing.T) {
 	}
 
 }
+
+func TestOpcodeSizes(t *testing.T) {
+	for code, opcode := range opcodeLookup {
+		instruction := disasm.DecodeBytes([]byte{code, 0, 0}, 0)
+		Expect(t, instruction.Size(), "size of "+instruction.String()).ToEqual(opcode.size)
+	}
+
+	for code, opcode := range cbPrefixedOpcodeLookup {
+		instruction := disasm.DecodeBytes([]byte{0xCB, code}, 0)
+		Expect(t, instruction.Size(), "size of "+instruction.String()).ToEqual(opcode.size)
+	}
+}
@@ -0,0 +1,37 @@
+package cpu
+
+import "github.com/carvhal/gby/internal/common"
+
+// SaveState returns the registers and the internal state of the CPU, for save states of the whole machine
+func (c *CPU) SaveState() []byte {
+	var state common.StateEncoder
+	state.Bytes([]byte{c.A, c.F, c.B, c.C, c.D, c.E, c.H, c.L})
+	state.Uint16(c.sp)
+	state.Uint16(c.PC)
+	state.Bool(c.ime)
+	state.Bool(c.imeScheduled)
+	state.Bool(c.locked)
+	state.Bool(c.stopped)
+	state.Bool(c.halted)
+
+	return state.Data
+}
+
+// LoadState restores a state returned by SaveState, the shadow call stack does not survive it
+func (c *CPU) LoadState(data []byte) error {
+	state := common.StateDecoder{Data: data}
+
+	var registers [8]byte
+	state.Bytes(registers[:])
+	c.A, c.F, c.B, c.C, c.D, c.E, c.H, c.L = registers[0], registers[1], registers[2], registers[3], registers[4], registers[5], registers[6], registers[7]
+	c.sp = state.Uint16()
+	c.PC = state.Uint16()
+	c.ime = state.Bool()
+	c.imeScheduled = state.Bool()
+	c.locked = state.Bool()
+	c.stopped = state.Bool()
+	c.halted = state.Bool()
+	c.callStack = nil
+
+	return state.Err("cpu")
+}
@@ -0,0 +1,38 @@
+package cpu
+
+// SPEED_SWITCH_CYCLES is the number of cycles the CPU is stopped for by a CGB speed switch
+const SPEED_SWITCH_CYCLES = 8200
+
+// STOPPED_CYCLES is the number of cycles a stopped CPU reports per Tick, so the rest of the machine keeps running
+const STOPPED_CYCLES = 4
+
+// buttonReader is implemented by memory buses with a joypad, a pressed button wakes the CPU up from STOP
+type buttonReader interface {
+	ButtonPressed() bool
+}
+
+// Stopped reports whether the CPU is in the STOP low power mode, waiting for a button press
+func (c *CPU) Stopped() bool {
+	return c.stopped
+}
+
+// stop executes STOP, it switches the CGB speed when a switch was armed through KEY1
+// and enters the low power mode otherwise
+func (c *CPU) stop() int {
+	if bus, ok := c.memoryBus.(speedSwitcher); ok && bus.SwitchSpeed() {
+		return SPEED_SWITCH_CYCLES
+	}
+
+	c.stopped = true
+
+	return 4
+}
+
+// wake leaves the low power mode once a button is pressed, it reports whether the CPU is running
+func (c *CPU) wake() bool {
+	if reader, ok := c.memoryBus.(buttonReader); ok && reader.ButtonPressed() {
+		c.stopped = false
+	}
+
+	return !c.stopped
+}
@@ -0,0 +1,55 @@
+package cpu
+
+import (
+	"testing"
+
+	. "github.com/carvhal/gby/internal/testutils"
+)
+
+// mockStopController is a memory with a joypad and a CGB speed switch
+type mockStopController struct {
+	mockMemController
+	pressed bool
+	armed   bool
+}
+
+func (c *mockStopController) ButtonPressed() bool {
+	return c.pressed
+}
+
+func (c *mockStopController) SwitchSpeed() bool {
+	armed := c.armed
+	c.armed = false
+	return armed
+}
+
+func TestStop(t *testing.T) {
+	bus := &mockStopController{mockMemController: mockMemController{ram: make([]byte, 0x10000)}}
+	copy(bus.ram, []byte{
+		0x10, 0x00, // STOP
+		0x10, 0x00, // STOP
+		0x3E, 0x01, // LD A $01
+	})
+	c := NewCPU(bus)
+
+	tick := func() int {
+		cycles, err := c.Tick()
+		Must(t, err, "Expected no error: %v")
+		return cycles
+	}
+
+	bus.armed = true
+	Expect(t, tick(), "speed switch cycles").ToEqual(SPEED_SWITCH_CYCLES)
+	Expect(t, c.Stopped(), "stopped after a speed switch").ToEqual(false)
+
+	tick()
+	Expect(t, c.Stopped(), "stopped without a speed switch armed").ToEqual(true)
+
+	Expect(t, tick(), "stopped cycles").ToEqual(STOPPED_CYCLES)
+	Expect(t, c.PC, "PC while stopped").ToEqual(uint16(0x0004))
+
+	bus.pressed = true
+	tick()
+	Expect(t, c.Stopped(), "stopped after a button press").ToEqual(false)
+	Expect(t, c.A, "instruction following STOP").ToEqual(byte(0x01))
+}
@@ -0,0 +1,128 @@
+package cpu
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/carvhal/gby/internal/expr"
+)
+
+/*
+* Trace format, one line per instruction with the state before it runs
+*
+* A:01 F:B0 B:00 C:13 D:00 E:D8 H:01 L:4D SP:FFFE PC:0100 PCMEM:00,C3,13,02
+*
+* the format of Gameboy Doctor, diffable against the logs of other emulators
+*
+* instructions can be filtered by address ranges and by a condition, as in "A > 0x10 && [HL] == 0xFF",
+* using the variables of the debugger conditions, HITS counts the instructions the condition was checked for
+*
+ */
+
+// AddressRange is an inclusive range of addresses
+type AddressRange struct {
+	Start, End uint16
+}
+
+// Tracer logs the instructions executed in the Gameboy Doctor format
+type Tracer struct {
+	out       *bufio.Writer
+	ranges    []AddressRange   // traced PCs, all when empty
+	condition *expr.Expression // nil to trace every instruction in the ranges
+	hits      int
+}
+
+func NewTracer(w io.Writer, ranges ...AddressRange) *Tracer {
+	return &Tracer{out: bufio.NewWriter(w), ranges: ranges}
+}
+
+// SetCondition only traces the instructions before which condition holds, nil traces them all,
+// the condition is checked against the CPU by SetTracer
+func (t *Tracer) SetCondition(condition *expr.Expression) {
+	t.condition = condition
+}
+
+// ParseRanges parses comma separated hexadecimal addresses and ranges, as in "0150,C000-DFFF"
+func ParseRanges(text string) ([]AddressRange, error) {
+	var ranges []AddressRange
+
+	for _, field := range strings.Split(text, ",") {
+		startText, endText, isRange := strings.Cut(strings.TrimSpace(field), "-")
+		if !isRange {
+			endText = startText
+		}
+
+		start, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(startText), "0x"), 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address %q", startText)
+		}
+
+		end, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(endText), "0x"), 16, 16)
+		if err != nil || end < start {
+			return nil, fmt.Errorf("invalid range %q", field)
+		}
+
+		ranges = append(ranges, AddressRange{uint16(start), uint16(end)})
+	}
+
+	return ranges, nil
+}
+
+// inRanges reports whether pc is in the traced ranges
+func (t *Tracer) inRanges(pc uint16) bool {
+	if len(t.ranges) == 0 {
+		return true
+	}
+
+	for _, r := range t.ranges {
+		if pc >= r.Start && pc <= r.End {
+			return true
+		}
+	}
+
+	return false
+}
+
+// traced reports whether the instruction at PC is logged, a condition that cannot be evaluated logs it
+func (t *Tracer) traced(c *CPU) bool {
+	if !t.inRanges(c.PC) {
+		return false
+	}
+
+	if t.condition == nil {
+		return true
+	}
+
+	t.hits++
+	hit, err := t.condition.True(Environment{CPU: c, PC: c.PC, Hits: t.hits})
+
+	return hit || err != nil
+}
+
+// trace logs the state of c before the instruction at PC runs
+func (t *Tracer) trace(c *CPU) {
+	if !t.traced(c) {
+		return
+	}
+
+	memory := make([]string, 4)
+	for i := range memory {
+		value, err := c.peek(c.PC+uint16(i), 1)
+		if err != nil {
+			memory[i] = "FF"
+			continue
+		}
+		memory[i] = fmt.Sprintf("%02X", value[0])
+	}
+
+	fmt.Fprintf(t.out, "A:%02X F:%02X B:%02X C:%02X D:%02X E:%02X H:%02X L:%02X SP:%04X PC:%04X PCMEM:%s\n",
+		c.A, c.F, c.B, c.C, c.D, c.E, c.H, c.L, c.sp, c.PC, strings.Join(memory, ","))
+}
+
+// Flush writes the buffered lines
+func (t *Tracer) Flush() error {
+	return t.out.Flush()
+}
@@ -0,0 +1,92 @@
+package cpu
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/carvhal/gby/internal/expr"
+	. "github.com/carvhal/gby/internal/testutils"
+)
+
+func TestTracer(t *testing.T) {
+	c := getMockCPU()
+	copy(c.memoryBus.(*mockMemController).ram[0x0100:], []byte{
+		0x06, 0x02, // LD B $02
+		0x05,       // DEC B
+		0x20, 0xFD, // JR NZ $0102
+	})
+	c.PC, c.sp = 0x0100, 0xFFFE
+
+	var out strings.Builder
+	tracer := NewTracer(&out)
+	c.SetTracer(tracer)
+
+	for i := 0; i < 5; i++ {
+		_, err := c.Tick()
+		Must(t, err, "Expected no error: %v")
+	}
+	Must(t, tracer.Flush(), "Expected no error flushing: %v")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	Expect(t, len(lines), "one line per instruction").ToEqual(5)
+	Expect(t, lines[0], "first line").ToEqual("A:00 F:00 B:00 C:00 D:00 E:00 H:00 L:00 SP:FFFE PC:0100 PCMEM:06,02,05,20")
+	Expect(t, lines[3], "second DEC B").ToEqual("A:00 F:40 B:01 C:00 D:00 E:00 H:00 L:00 SP:FFFE PC:0102 PCMEM:05,20,FD,00")
+}
+
+func TestTracerRanges(t *testing.T) {
+	ranges, err := ParseRanges("0102,0x0200-02FF")
+	Must(t, err, "Expected no error parsing the ranges: %v")
+	Expect(t, ranges, "ranges").ToEqual([]AddressRange{{0x0102, 0x0102}, {0x0200, 0x02FF}})
+
+	_, err = ParseRanges("0300-0200")
+	Expect(t, err != nil, "reversed range").ToEqual(true)
+
+	c := getMockCPU()
+	copy(c.memoryBus.(*mockMemController).ram[0x0100:], []byte{0x06, 0x02, 0x05, 0x20, 0xFD})
+	c.PC = 0x0100
+
+	var out strings.Builder
+	tracer := NewTracer(&out, ranges...)
+	c.SetTracer(tracer)
+
+	for i := 0; i < 5; i++ {
+		_, err := c.Tick()
+		Must(t, err, "Expected no error: %v")
+	}
+	Must(t, tracer.Flush(), "Expected no error flushing: %v")
+
+	Expect(t, strings.Count(out.String(), "PC:0102"), "DEC B traced twice").ToEqual(2)
+	Expect(t, strings.Count(out.String(), "\n"), "nothing else").ToEqual(2)
+}
+
+func TestTracerCondition(t *testing.T) {
+	c := getMockCPU()
+	copy(c.memoryBus.(*mockMemController).ram[0x0100:], []byte{
+		0x06, 0x03, // LD B $03
+		0x05,       // DEC B
+		0x20, 0xFD, // JR NZ $0102
+	})
+	c.PC = 0x0100
+
+	condition, err := expr.Parse("B < 3 && [PC] == 0x05")
+	Must(t, err, "Expected no error parsing the condition: %v")
+
+	var out strings.Builder
+	tracer := NewTracer(&out)
+	tracer.SetCondition(condition)
+	Must(t, c.SetTracer(tracer), "Expected no error attaching the tracer: %v")
+
+	for i := 0; i < 7; i++ {
+		_, err := c.Tick()
+		Must(t, err, "Expected no error: %v")
+	}
+	Must(t, tracer.Flush(), "Expected no error flushing: %v")
+
+	Expect(t, strings.Count(out.String(), "PC:0102"), "DEC B traced once B was decremented").ToEqual(2)
+	Expect(t, strings.Count(out.String(), "\n"), "nothing else").ToEqual(2)
+
+	unknown, err := expr.Parse("VALUE == 1")
+	Must(t, err, "Expected no error parsing the condition: %v")
+	tracer.SetCondition(unknown)
+	Expect(t, c.SetTracer(tracer) != nil, "VALUE only exists for watchpoints").ToEqual(true)
+}
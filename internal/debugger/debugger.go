@@ -0,0 +1,366 @@
+package debugger
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync/atomic"
+
+	"github.com/carvhal/gby/internal/cpu"
+	"github.com/carvhal/gby/internal/expr"
+	"github.com/carvhal/gby/internal/memory"
+	"github.com/carvhal/gby/internal/ppu"
+	"github.com/carvhal/gby/internal/rewind"
+)
+
+// StopReason tells why Run returned
+type StopReason byte
+
+const (
+	STOP_DONE       StopReason = iota // the stop condition was met
+	STOP_BREAKPOINT                   // a breakpoint was reached
+	STOP_INTERRUPT                    // Interrupt was called
+	STOP_WATCHPOINT                   // a watchpoint asked to pause
+)
+
+// Stop describes where and why Run returned
+type Stop struct {
+	Reason      StopReason
+	Address     uint16             // PC the CPU stopped at
+	Breakpoint  int                // ID of the breakpoint hit
+	Access      memory.AccessEvent // access that hit the watchpoint
+	Instruction string             // instruction responsible for the access
+}
+
+func (s Stop) String() string {
+	switch s.Reason {
+	case STOP_BREAKPOINT:
+		return fmt.Sprintf("breakpoint #%d at 0x%04X", s.Breakpoint, s.Address)
+	case STOP_INTERRUPT:
+		return "interrupted"
+	case STOP_WATCHPOINT:
+		return fmt.Sprintf("watchpoint %d: %s (%s)", s.Access.Watchpoint, s.Access, s.Instruction)
+	}
+
+	return ""
+}
+
+// Breakpoint stops execution before an instruction runs, when its condition holds
+type Breakpoint struct {
+	ID        int
+	Address   uint16
+	Bank      int              // ROM bank that must be mapped at Address, -1 for any
+	Anywhere  bool             // checked before every instruction instead of at Address
+	Condition *expr.Expression // nil for unconditional
+	Hits      int              // times Address was reached, or the condition checked for breakpoints set anywhere
+}
+
+// location is where a breakpoint stops, bank is -1 for any ROM bank
+type location struct {
+	bank    int
+	address uint16
+}
+
+// Debugger drives the CPU one instruction at a time, stopping on breakpoints and conditions
+type Debugger struct {
+	cpu            *cpu.CPU
+	bus            *memory.Controller
+	breakpoints    map[location]*Breakpoint
+	anywhere       []*Breakpoint
+	nextBreakpoint int
+	interrupted    atomic.Bool
+	statePath      string           // save state file used when savestate and loadstate are given none
+	rewinder       *rewind.Rewinder // nil without rewinding
+}
+
+func New(cpu *cpu.CPU, bus *memory.Controller) *Debugger {
+	return &Debugger{
+		cpu:         cpu,
+		bus:         bus,
+		breakpoints: make(map[location]*Breakpoint),
+	}
+}
+
+// SetStatePath sets the save state file used by the savestate and loadstate commands without a file
+func (d *Debugger) SetStatePath(path string) {
+	d.statePath = path
+}
+
+// SetRewinder snapshots every frame run with rewinder, for the rewind command, nil stops snapshotting
+func (d *Debugger) SetRewinder(rewinder *rewind.Rewinder) {
+	d.rewinder = rewinder
+}
+
+// Rewind restores the machine to the start of the frame count frames before the current one
+func (d *Debugger) Rewind(count int) (uint64, error) {
+	if d.rewinder == nil {
+		return 0, errors.New("rewinding is disabled")
+	}
+
+	return d.rewinder.Rewind(count)
+}
+
+// AddBreakpoint stops execution before the instruction at address runs
+func (d *Debugger) AddBreakpoint(address uint16) {
+	d.AddConditionalBreakpoint(address, nil)
+}
+
+// AddConditionalBreakpoint stops execution before the instruction at address runs if condition holds,
+// the condition can use the registers, the flags (ZF, NF, HF, CF), the memory and the hit count of the breakpoint
+func (d *Debugger) AddConditionalBreakpoint(address uint16, condition *expr.Expression) error {
+	return d.AddBankedBreakpoint(-1, address, condition)
+}
+
+// AddBankedBreakpoint is AddConditionalBreakpoint only stopping when bank is the ROM bank mapped at address,
+// -1 for any, it replaces the breakpoint at address in the same bank
+func (d *Debugger) AddBankedBreakpoint(bank int, address uint16, condition *expr.Expression) error {
+	if condition != nil {
+		if err := d.checkCondition(condition, false); err != nil {
+			return err
+		}
+	}
+
+	d.nextBreakpoint++
+	d.breakpoints[location{bank, address}] = &Breakpoint{ID: d.nextBreakpoint, Address: address, Bank: bank, Condition: condition}
+
+	return nil
+}
+
+// AddBreakpointAnywhere stops execution before any instruction for which condition holds, it returns the breakpoint ID
+func (d *Debugger) AddBreakpointAnywhere(condition *expr.Expression) (int, error) {
+	if err := d.checkCondition(condition, false); err != nil {
+		return 0, err
+	}
+
+	d.nextBreakpoint++
+	d.anywhere = append(d.anywhere, &Breakpoint{ID: d.nextBreakpoint, Bank: -1, Anywhere: true, Condition: condition})
+
+	return d.nextBreakpoint, nil
+}
+
+// RemoveBreakpoint removes the breakpoint at address in any bank, it reports whether there was one
+func (d *Debugger) RemoveBreakpoint(address uint16) bool {
+	return d.RemoveBankedBreakpoint(-1, address)
+}
+
+// RemoveBankedBreakpoint removes the breakpoint at address in bank, -1 for the one in any bank,
+// it reports whether there was one
+func (d *Debugger) RemoveBankedBreakpoint(bank int, address uint16) bool {
+	_, ok := d.breakpoints[location{bank, address}]
+	delete(d.breakpoints, location{bank, address})
+
+	return ok
+}
+
+// RemoveBreakpointID removes a breakpoint by ID, it reports whether there was one
+func (d *Debugger) RemoveBreakpointID(id int) bool {
+	for at, b := range d.breakpoints {
+		if b.ID == id {
+			delete(d.breakpoints, at)
+			return true
+		}
+	}
+
+	for i, b := range d.anywhere {
+		if b.ID == id {
+			d.anywhere = append(d.anywhere[:i], d.anywhere[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// Breakpoints returns the breakpoints by ID
+func (d *Debugger) Breakpoints() []Breakpoint {
+	breakpoints := make([]Breakpoint, 0, len(d.breakpoints)+len(d.anywhere))
+	for _, b := range d.breakpoints {
+		breakpoints = append(breakpoints, *b)
+	}
+	for _, b := range d.anywhere {
+		breakpoints = append(breakpoints, *b)
+	}
+	sort.Slice(breakpoints, func(i, j int) bool { return breakpoints[i].ID < breakpoints[j].ID })
+
+	return breakpoints
+}
+
+// hitBreakpoint counts a hit of the breakpoint and reports whether its condition holds
+func (d *Debugger) hitBreakpoint(b *Breakpoint) (bool, error) {
+	b.Hits++
+	if b.Condition == nil {
+		return true, nil
+	}
+
+	hit, err := b.Condition.True(cpu.Environment{CPU: d.cpu, PC: d.cpu.PC, Hits: b.Hits})
+	if err != nil {
+		return true, fmt.Errorf("breakpoint %d condition %q: %w", b.ID, b.Condition, err)
+	}
+
+	return hit, nil
+}
+
+// breakpointsAt returns the breakpoints at address in any bank and in the ROM bank mapped there
+func (d *Debugger) breakpointsAt(address uint16) []*Breakpoint {
+	var breakpoints []*Breakpoint
+	for _, bank := range []int{-1, d.bus.ROMBank(address)} {
+		if b, ok := d.breakpoints[location{bank, address}]; ok {
+			breakpoints = append(breakpoints, b)
+		}
+	}
+
+	return breakpoints
+}
+
+// checkBreakpoints returns the breakpoint stopping the instruction at PC, if any
+func (d *Debugger) checkBreakpoints() (*Breakpoint, error) {
+	for _, b := range d.breakpointsAt(d.cpu.PC) {
+		if hit, err := d.hitBreakpoint(b); hit {
+			return b, err
+		}
+	}
+
+	for _, b := range d.anywhere {
+		if hit, err := d.hitBreakpoint(b); hit {
+			return b, err
+		}
+	}
+
+	return nil, nil
+}
+
+// AddWatchpoint pauses Run after an instruction accessing start - end (inclusive), or before an instruction
+// executed from it, condition is optional and filters on the value accessed
+func (d *Debugger) AddWatchpoint(start, end uint16, access memory.Access, condition func(value byte) bool) int {
+	return d.bus.AddWatchpoint(memory.Watchpoint{Start: start, End: end, Access: access, Condition: condition})
+}
+
+// AddConditionalWatchpoint is AddWatchpoint with a condition expression, which can use the value accessed (VALUE),
+// the hit count of the watchpoint, the registers, flags and memory, PC is the address of the instruction accessing
+func (d *Debugger) AddConditionalWatchpoint(start, end uint16, access memory.Access, condition *expr.Expression) (int, error) {
+	if err := d.checkCondition(condition, true); err != nil {
+		return 0, err
+	}
+
+	hits := 0
+	return d.AddWatchpoint(start, end, access, func(value byte) bool {
+		hits++
+		hit, err := condition.True(cpu.Environment{CPU: d.cpu, PC: d.bus.InstructionPC(), Hits: hits, Value: &value})
+
+		// a condition that cannot be evaluated pauses, so it gets noticed
+		return hit || err != nil
+	}), nil
+}
+
+// RemoveWatchpoint removes a watchpoint by ID, it reports whether there was one
+func (d *Debugger) RemoveWatchpoint(id int) bool {
+	return d.bus.RemoveWatchpoint(id)
+}
+
+// Interrupt stops a running Run at the next instruction, it is safe to call from another goroutine
+func (d *Debugger) Interrupt() {
+	d.interrupted.Store(true)
+}
+
+// Step runs one instruction and advances the rest of the machine by the cycles it took
+func (d *Debugger) Step() error {
+	cycles, err := d.cpu.Tick()
+	if err != nil {
+		return err
+	}
+
+	d.bus.Step(cycles)
+
+	if d.rewinder != nil {
+		d.rewinder.Capture()
+	}
+
+	return nil
+}
+
+// Run runs instructions until stop returns true, a breakpoint is reached, Interrupt is called or an instruction fails,
+// the instruction at the current PC always runs so a stopped breakpoint or execute watchpoint does not stop again
+func (d *Debugger) Run(stop func() bool) (Stop, error) {
+	d.interrupted.Store(false)
+	d.bus.TakePause()
+
+	for first := true; ; first = false {
+		if !first {
+			if b, err := d.checkBreakpoints(); b != nil {
+				return Stop{Reason: STOP_BREAKPOINT, Address: d.cpu.PC, Breakpoint: b.ID}, err
+			}
+
+			d.bus.WatchExecute(d.cpu.PC)
+			if event, ok := d.bus.TakePause(); ok {
+				return d.watchpointStop(event), nil
+			}
+
+			if d.interrupted.Load() {
+				return Stop{Reason: STOP_INTERRUPT, Address: d.cpu.PC}, nil
+			}
+		}
+
+		if err := d.Step(); err != nil {
+			return Stop{Reason: STOP_DONE, Address: d.cpu.PC}, err
+		}
+
+		if event, ok := d.bus.TakePause(); ok {
+			return d.watchpointStop(event), nil
+		}
+
+		if stop != nil && stop() {
+			return Stop{Reason: STOP_DONE, Address: d.cpu.PC}, nil
+		}
+	}
+}
+
+// watchpointStop describes a stop on the access event of a watchpoint
+func (d *Debugger) watchpointStop(event memory.AccessEvent) Stop {
+	instruction, _ := d.cpu.Disassemble(event.PC)
+
+	return Stop{Reason: STOP_WATCHPOINT, Address: d.cpu.PC, Access: event, Instruction: instruction}
+}
+
+// Next runs the instruction at PC, running a called subroutine until it returns
+func (d *Debugger) Next() (Stop, error) {
+	if !d.cpu.IsCall(d.cpu.PC) {
+		err := d.Step()
+		return Stop{Reason: STOP_DONE, Address: d.cpu.PC}, err
+	}
+
+	_, size := d.cpu.Disassemble(d.cpu.PC)
+	returnAddress, sp := d.cpu.PC+size, d.cpu.SP()
+
+	return d.Run(func() bool { return d.cpu.PC == returnAddress && d.cpu.SP() >= sp })
+}
+
+// Finish runs until the current subroutine returns, when its frame leaves the shadow call stack,
+// or without frames when the stack pointer rises above its current value
+func (d *Debugger) Finish() (Stop, error) {
+	if depth := d.cpu.CallDepth(); depth > 0 {
+		return d.Run(func() bool { return d.cpu.CallDepth() < depth })
+	}
+
+	sp := d.cpu.SP()
+
+	return d.Run(func() bool { return d.cpu.SP() > sp })
+}
+
+// RunUntilVBlank runs until the PPU enters the next VBlank period
+func (d *Debugger) RunUntilVBlank() (Stop, error) {
+	frames := d.bus.PPU().Frames()
+
+	return d.Run(func() bool { return d.bus.PPU().Frames() != frames })
+}
+
+// RunFrames runs until count frames have completed and the PPU starts drawing the next one
+func (d *Debugger) RunFrames(count int) (Stop, error) {
+	target := d.bus.PPU().Frames() + uint64(count)
+	if d.bus.PPU().Mode() == ppu.VBLANK {
+		target--
+	}
+
+	return d.Run(func() bool {
+		return d.bus.PPU().Frames() >= target && d.bus.PPU().Mode() != ppu.VBLANK
+	})
+}
@@ -0,0 +1,314 @@
+package debugger
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/carvhal/gby/internal/cpu"
+	"github.com/carvhal/gby/internal/memory"
+	"github.com/carvhal/gby/internal/ppu"
+	"github.com/carvhal/gby/internal/rewind"
+	"github.com/carvhal/gby/internal/symbols"
+	. "github.com/carvhal/gby/internal/testutils"
+)
+
+// newDebugger returns a debugger on a ROM starting with program
+func newDebugger(program ...byte) *Debugger {
+	rom := make([]byte, 0x8000)
+	copy(rom, program)
+
+	bus := memory.NewController(rom)
+
+	return New(cpu.NewCPU(bus), bus)
+}
+
+func TestREPL(t *testing.T) {
+	d := newDebugger(
+		0x06, 0x03, // LD B $03
+		0x05,       // DEC B
+		0x20, 0xFD, // JR NZ $0002
+		0x31, 0xFE, 0xFF, // LD SP $FFFE
+	)
+
+	script := strings.Join([]string{
+		"break 0x0005",
+		"continue",
+		"regs",
+		"write c000 de ad",
+		"x c000 2",
+		"disasm",
+		"step",
+		"",
+		"quit",
+	}, "\n")
+
+	var out strings.Builder
+	Must(t, d.REPL(strings.NewReader(script), &out), "Expected no error from the REPL: %v")
+
+	output := out.String()
+	for _, expected := range []string{
+		"breakpoint at 0x0005",
+		"B: 00  C: 00",
+		"[ZN--]",
+		"C000: DE AD",
+		"   0x0003: jr nz, $0002\n=> 0x0005: ld sp, $FFFE",
+		"0x0008: nop",
+	} {
+		Expect(t, strings.Contains(output, expected), "output contains "+expected).ToEqual(true)
+	}
+
+	Expect(t, d.cpu.SP(), "SP").ToEqual(uint16(0xFFFE))
+}
+
+func TestHelp(t *testing.T) {
+	var out strings.Builder
+	Must(t, helpCommand(newDebugger(), &out, nil), "Expected no error from help: %v")
+
+	for name, command := range commands {
+		Expect(t, strings.Contains(out.String(), command.usage), "help lists "+name).ToEqual(true)
+	}
+}
+
+func TestWriteAcrossRegions(t *testing.T) {
+	d := newDebugger()
+
+	script := strings.Join([]string{
+		"write 9fff 01 02",
+		"write fe9f 01 02",
+		"write dfff 01 02",
+		"write fffe 03 04",
+		"write ffff 01 02",
+		"x fffe 2",
+		"quit",
+	}, "\n")
+
+	var out strings.Builder
+	Must(t, d.REPL(strings.NewReader(script), &out), "Expected no error from the REPL: %v")
+
+	output := out.String()
+	for _, expected := range []string{
+		"error: illegal write at 0xE000 (echo RAM)",
+		"error: write past the end of the memory map (0xFFFF + 2 bytes)",
+		"FFFE: 03 04",
+	} {
+		Expect(t, strings.Contains(output, expected), "output contains "+expected).ToEqual(true)
+	}
+}
+
+func TestRunFrames(t *testing.T) {
+	d := newDebugger(0x20, 0xFE) // JR NZ $0000
+
+	_, err := d.RunUntilVBlank()
+	Must(t, err, "Expected no error running until VBlank: %v")
+	Expect(t, d.bus.PPU().Mode(), "mode").ToEqual(ppu.VBLANK)
+	Expect(t, d.bus.PPU().LY(), "LY").ToEqual(byte(ppu.ScreenHeight))
+
+	_, err = d.RunFrames(2)
+	Must(t, err, "Expected no error running frames: %v")
+	Expect(t, d.bus.PPU().Frames(), "frames").ToEqual(uint64(2))
+	Expect(t, d.bus.PPU().LY(), "LY").ToEqual(byte(0))
+}
+
+func TestInterrupt(t *testing.T) {
+	d := newDebugger(0x20, 0xFE)
+
+	steps := 0
+	stop, err := d.Run(func() bool {
+		if steps++; steps == 10 {
+			d.Interrupt()
+		}
+		return false
+	})
+
+	Must(t, err, "Expected no error: %v")
+	Expect(t, stop.Reason, "reason").ToEqual(STOP_INTERRUPT)
+}
+
+func TestError(t *testing.T) {
+	d := newDebugger(0xD3) // illegal opcode
+
+	_, err := d.Run(nil)
+	Expect(t, err != nil, "error").ToEqual(true)
+	Expect(t, d.cpu.PC, "PC stays on the failing instruction").ToEqual(uint16(0))
+}
+
+func TestWatchpointREPL(t *testing.T) {
+	d := newDebugger(
+		0x3E, 0x01, // LD A $01
+		0xE0, 0x80, // LDH ($FF80), A
+		0x3E, 0x42, // LD A $42
+		0xE0, 0x80, // LDH ($FF80), A
+		0x20, 0xFE, // JR NZ $0008
+	)
+
+	var out strings.Builder
+	script := "watch ff80 w == 42\ncontinue\nwatch\nquit"
+	Must(t, d.REPL(strings.NewReader(script), &out), "Expected no error from the REPL: %v")
+
+	expected := "watchpoint 1: write of 0x42 at 0xFF80 by the instruction at 0x0006 (ldh [$FF80], a)"
+	Expect(t, strings.Contains(out.String(), expected), "stop message").ToEqual(true)
+	Expect(t, d.cpu.PC, "PC after the write").ToEqual(uint16(0x0008))
+}
+
+func TestExecuteWatchpoint(t *testing.T) {
+	d := newDebugger(
+		0x06, 0x03, // LD B $03
+		0x05,       // DEC B
+		0x20, 0xFD, // JR NZ $0002
+		0x31, 0xFE, 0xFF, // LD SP $FFFE
+	)
+
+	var out strings.Builder
+	script := "watch 0002 x\ncontinue\ncontinue\nquit"
+	Must(t, d.REPL(strings.NewReader(script), &out), "Expected no error from the REPL: %v")
+
+	expected := "watchpoint 1: execute of 0x05 at 0x0002 by the instruction at 0x0002 (dec b)"
+	Expect(t, strings.Count(out.String(), expected), "stops, once per continue").ToEqual(2)
+	Expect(t, d.cpu.PC, "PC on the watched instruction").ToEqual(uint16(0x0002))
+	Expect(t, d.cpu.B, "the watched instruction ran once between the stops").ToEqual(byte(0x02))
+}
+
+func TestConditionalBreakpoint(t *testing.T) {
+	d := newDebugger(
+		0x06, 0x05, // LD B $05
+		0x05,       // DEC B
+		0x20, 0xFD, // JR NZ $0002
+		0x20, 0xFE, // JR NZ $0005
+	)
+
+	var out strings.Builder
+	script := strings.Join([]string{
+		"break 0x0002 if hit count >= 3",
+		"break if B == 1 && PC == $0003",
+		"break 0x0002 if B ==",
+		"continue",
+		"regs",
+		"delete #1",
+		"continue",
+		"break",
+		"quit",
+	}, "\n")
+	Must(t, d.REPL(strings.NewReader(script), &out), "Expected no error from the REPL: %v")
+
+	output := out.String()
+	for _, expected := range []string{
+		"breakpoint at 0x0002 if hit count >= 3 (#1)",
+		"invalid condition, column 5: expected a number, a variable, ( or [, got end of expression",
+		"breakpoint #1 at 0x0002",
+		"B: 03",
+		"breakpoint #2 at 0x0003",
+		"#2: anywhere if B == 1 && PC == $0003, ",
+	} {
+		Expect(t, strings.Contains(output, expected), "output contains "+expected).ToEqual(true)
+	}
+
+	Expect(t, d.cpu.B, "B").ToEqual(byte(1))
+}
+
+// bankedDebugger returns a debugger on an MBC1 ROM calling 0x4002 in bank 1, which switches to bank 2
+// where 0x4002 loops, with symbols for both
+func bankedDebugger(t *testing.T) *Debugger {
+	rom := make([]byte, 0x10000)
+	copy(rom, []byte{
+		0x31, 0xFE, 0xFF, // LD SP $FFFE
+		0x3E, 0x01, // LD A $01
+		0x21, 0x00, 0x20, // LD HL $2000
+		0x77,             // LD [HL] A, ROM bank 1
+		0xCD, 0x00, 0x40, // CALL $4000
+	})
+	rom[0x0147], rom[0x0148] = 0x01, 0x01 // MBC1, 64KB
+	copy(rom[0x4000:], []byte{
+		0x3E, 0x02, // LD A $02
+		0x77, // LD [HL] A, ROM bank 2
+	})
+	copy(rom[0x8000:], []byte{
+		0x3E, 0x02, // LD A $02
+		0x0C,       // INC C
+		0x20, 0xFD, // JR NZ $4002
+	})
+
+	table, err := symbols.Parse(strings.NewReader("00:0009 CallOne\n01:4002 OneSwitch\n02:4002 TwoLoop\n"))
+	Must(t, err, "Expected no error parsing the symbols: %v")
+
+	bus := memory.NewController(rom)
+	d := New(cpu.NewCPU(bus), bus)
+	d.cpu.SetSymbols(table)
+
+	return d
+}
+
+func TestSymbolBreakpoint(t *testing.T) {
+	d := bankedDebugger(t)
+
+	var out strings.Builder
+	script := "break TwoLoop\ncontinue\ndisasm CallOne 1\ndisasm 4003 1\nbt\nquit"
+	Must(t, d.REPL(strings.NewReader(script), &out), "Expected no error from the REPL: %v")
+
+	output := out.String()
+	for _, expected := range []string{
+		"breakpoint at 0x4002 <TwoLoop> (#1)",
+		"breakpoint #1 at 0x4002",
+		"0x4002 <TwoLoop>: inc c",
+		"0x0009 <CallOne>: call $4000",
+		"0x4003 <TwoLoop+$1>: jr nz, TwoLoop",
+		"#0  0x4002 <TwoLoop>\n#1  0x0009 <CallOne> call 0x4000\n",
+	} {
+		Expect(t, strings.Contains(output, expected), "output contains "+expected).ToEqual(true)
+	}
+
+	Expect(t, d.bus.ROMBank(0x4002), "stopped in bank 2, not in bank 1").ToEqual(2)
+}
+
+func TestBankedBreakpoints(t *testing.T) {
+	d := bankedDebugger(t)
+
+	var out strings.Builder
+	script := strings.Join([]string{
+		"break OneSwitch",
+		"break 02:4002",
+		"continue",
+		"continue",
+		"step",
+		"disasm 4002 1",
+		"delete TwoLoop",
+		"break",
+		"disasm 4002 1",
+		"quit",
+	}, "\n")
+	Must(t, d.REPL(strings.NewReader(script), &out), "Expected no error from the REPL: %v")
+
+	output := out.String()
+	for _, expected := range []string{
+		"breakpoint #1 at 0x4002",
+		"breakpoint #2 at 0x4002",
+		"*  0x4002 <TwoLoop>: inc c",
+		"#1: 0x4002 <OneSwitch>, 1 hits\n(gby) ",
+		"   0x4002 <TwoLoop>: inc c",
+	} {
+		Expect(t, strings.Contains(output, expected), "output contains "+expected).ToEqual(true)
+	}
+}
+
+func TestRewind(t *testing.T) {
+	d := newDebugger(
+		0x0C,       // INC C
+		0x20, 0xFD, // JR NZ $0000
+		0x0C,       // INC C
+		0x20, 0xFA, // JR NZ $0000
+	)
+	d.SetRewinder(rewind.New(d.cpu, d.bus, rewind.DEFAULT_BUDGET))
+
+	_, err := d.RunUntilVBlank()
+	Must(t, err, "Expected no error running until VBlank: %v")
+	registers := d.cpu.Registers()
+
+	_, err = d.RunFrames(3)
+	Must(t, err, "Expected no error running frames: %v")
+
+	var out strings.Builder
+	Must(t, d.REPL(strings.NewReader(fmt.Sprintf("rewind %d\n", d.bus.PPU().Frames()-1)), &out), "Expected no error from the REPL: %v")
+	Expect(t, strings.Contains(out.String(), "rewound to frame 1\n"), "rewind output").ToEqual(true)
+	Expect(t, d.bus.PPU().Frames(), "frames").ToEqual(uint64(1))
+	Expect(t, d.cpu.Registers(), "registers").ToEqual(registers)
+}
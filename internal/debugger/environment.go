@@ -0,0 +1,16 @@
+package debugger
+
+import (
+	"github.com/carvhal/gby/internal/cpu"
+	"github.com/carvhal/gby/internal/expr"
+)
+
+// checkCondition checks that condition only uses variables available to a breakpoint, or a watchpoint
+func (d *Debugger) checkCondition(condition *expr.Expression, watchpoint bool) error {
+	env := cpu.Environment{CPU: d.cpu}
+	if watchpoint {
+		env.Value = new(byte)
+	}
+
+	return condition.Check(env)
+}
@@ -0,0 +1,691 @@
+package debugger
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/carvhal/gby/internal/expr"
+	"github.com/carvhal/gby/internal/memory"
+	"github.com/carvhal/gby/internal/savestate"
+)
+
+const (
+	disassemblyLines  = 5  // instructions shown from PC by disasm without a count
+	disassemblyBefore = 2  // instructions shown before PC by disasm without an address, when the history knows them
+	hexdumpLength     = 64 // bytes shown by x without a length
+	hexdumpWidth      = 16
+)
+
+// errQuit ends the REPL
+var errQuit = errors.New("quit")
+
+// command is a REPL command, args excludes the command name
+type command struct {
+	usage       string
+	description string
+	run         func(d *Debugger, out io.Writer, args []string) error
+}
+
+var commands map[string]*command
+
+// aliases maps the short names of the commands to their full name
+var aliases = map[string]string{
+	"s": "step", "n": "next", "c": "continue", "b": "break", "d": "delete",
+	"r": "regs", "l": "disasm", "q": "quit", "h": "help", "bt": "backtrace",
+}
+
+func init() {
+	commands = map[string]*command{
+		"step":      {"step [count]", "run count instructions (1)", stepCommand},
+		"next":      {"next", "run one instruction, running called subroutines until they return", nextCommand},
+		"continue":  {"continue", "run until a breakpoint or Ctrl-C", continueCommand},
+		"finish":    {"finish", "run until the current subroutine returns", finishCommand},
+		"vblank":    {"vblank", "run until the next VBlank", vblankCommand},
+		"frame":     {"frame [count]", "run count frames (1)", frameCommand},
+		"break":     {"break [[bank:]address] [if condition]", "add a breakpoint at address, or anywhere, list the breakpoints without arguments", breakCommand},
+		"delete":    {"delete [bank:]address|#id", "remove the breakpoint at address, or by id", deleteCommand},
+		"watch":     {"watch [start[-end] [r|w|x] [==|!= value|if condition]]", "pause on accesses (w) to a range, list the watchpoints without one", watchCommand},
+		"unwatch":   {"unwatch id", "remove a watchpoint", unwatchCommand},
+		"regs":      {"regs", "show the registers and flags", regsCommand},
+		"backtrace": {"backtrace", "show the calls, RSTs and interrupts returning to PC", backtraceCommand},
+		"rewind":    {"rewind [frames]", "go back to the start of the frame frames (1) before the current one", rewindCommand},
+		"savestate": {"savestate [file]", "save the state of the machine to file", saveStateCommand},
+		"loadstate": {"loadstate [file]", "restore the state of the machine from file", loadStateCommand},
+		"x":         {"x address [length]", "hexdump length bytes (64) from address", hexdumpCommand},
+		"write":     {"write address byte...", "write bytes to memory from address", writeCommand},
+		"disasm":    {"disasm [address] [count]", "disassemble count instructions (5) from address (around PC)", disasmCommand},
+		"quit":      {"quit", "leave the debugger", func(*Debugger, io.Writer, []string) error { return errQuit }},
+		"help":      {"help", "list the commands", helpCommand},
+	}
+}
+
+// REPL reads commands from in until quit or the end of the input, an empty line repeats the last command
+func (d *Debugger) REPL(in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	var last []string
+
+	d.printLocation(out)
+
+	for {
+		fmt.Fprint(out, "(gby) ")
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return scanner.Err()
+		}
+
+		args := strings.Fields(scanner.Text())
+		if len(args) == 0 {
+			args = last
+		}
+		if len(args) == 0 {
+			continue
+		}
+		last = args
+
+		name := args[0]
+		if full, ok := aliases[name]; ok {
+			name = full
+		}
+
+		cmd, ok := commands[name]
+		if !ok {
+			fmt.Fprintf(out, "unknown command %q, try help\n", args[0])
+			continue
+		}
+
+		err := cmd.run(d, out, args[1:])
+		if err == errQuit {
+			return nil
+		}
+		if err != nil {
+			fmt.Fprintf(out, "error: %v\n", err)
+		}
+	}
+}
+
+// printStop prints why execution stopped and where
+func (d *Debugger) printStop(out io.Writer, stop Stop, err error) error {
+	if err != nil {
+		fmt.Fprintf(out, "cpu error: %v\n", err)
+	} else if reason := stop.String(); reason != "" {
+		fmt.Fprintln(out, reason)
+	}
+
+	d.printLocation(out)
+
+	return nil
+}
+
+// printLocation prints the instruction at PC
+func (d *Debugger) printLocation(out io.Writer) {
+	text, _ := d.cpu.Disassemble(d.cpu.PC)
+	fmt.Fprintf(out, "%s: %s\n", d.cpu.FormatAddress(d.cpu.PC), text)
+}
+
+func stepCommand(d *Debugger, out io.Writer, args []string) error {
+	count, err := parseCount(args, 0, 1)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < count; i++ {
+		if err := d.Step(); err != nil {
+			return d.printStop(out, Stop{}, err)
+		}
+	}
+
+	return d.printStop(out, Stop{}, nil)
+}
+
+func nextCommand(d *Debugger, out io.Writer, args []string) error {
+	stop, err := d.Next()
+	return d.printStop(out, stop, err)
+}
+
+func continueCommand(d *Debugger, out io.Writer, args []string) error {
+	stop, err := d.Run(nil)
+	return d.printStop(out, stop, err)
+}
+
+func finishCommand(d *Debugger, out io.Writer, args []string) error {
+	stop, err := d.Finish()
+	return d.printStop(out, stop, err)
+}
+
+func vblankCommand(d *Debugger, out io.Writer, args []string) error {
+	stop, err := d.RunUntilVBlank()
+	return d.printStop(out, stop, err)
+}
+
+func frameCommand(d *Debugger, out io.Writer, args []string) error {
+	count, err := parseCount(args, 0, 1)
+	if err != nil {
+		return err
+	}
+
+	stop, err := d.RunFrames(count)
+	return d.printStop(out, stop, err)
+}
+
+func breakCommand(d *Debugger, out io.Writer, args []string) error {
+	if len(args) == 0 {
+		for _, b := range d.Breakpoints() {
+			location := "anywhere"
+			if !b.Anywhere {
+				location = d.formatAddress(b.Bank, b.Address)
+			}
+
+			condition := ""
+			if b.Condition != nil {
+				condition = fmt.Sprintf(" if %s", b.Condition)
+			}
+
+			fmt.Fprintf(out, "#%d: %s%s, %d hits\n", b.ID, location, condition, b.Hits)
+		}
+		return nil
+	}
+
+	args, condition, err := parseCondition(args)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case len(args) == 0 && condition == nil:
+		return fmt.Errorf("usage: %s", commands["break"].usage)
+	case len(args) == 0:
+		id, err := d.AddBreakpointAnywhere(condition)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "breakpoint anywhere if %s (#%d)\n", condition, id)
+
+		return nil
+	case len(args) > 1:
+		return fmt.Errorf("usage: %s", commands["break"].usage)
+	}
+
+	address, bank, err := d.parseLocation(args[0])
+	if err != nil {
+		return err
+	}
+
+	if err := d.AddBankedBreakpoint(bank, address, condition); err != nil {
+		return err
+	}
+
+	b := d.breakpoints[location{bank, address}]
+	if condition != nil {
+		fmt.Fprintf(out, "breakpoint at %s if %s (#%d)\n", d.formatAddress(bank, address), condition, b.ID)
+	} else {
+		fmt.Fprintf(out, "breakpoint at %s (#%d)\n", d.formatAddress(bank, address), b.ID)
+	}
+
+	return nil
+}
+
+// parseCondition splits the arguments before "if" from the condition expression after it, if any
+func parseCondition(args []string) ([]string, *expr.Expression, error) {
+	for i, arg := range args {
+		if arg != "if" {
+			continue
+		}
+
+		if i == len(args)-1 {
+			return nil, nil, errors.New("missing condition after if")
+		}
+
+		condition, err := expr.Parse(strings.Join(args[i+1:], " "))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid condition, %w", err)
+		}
+
+		return args[:i], condition, nil
+	}
+
+	return args, nil, nil
+}
+
+func deleteCommand(d *Debugger, out io.Writer, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s", commands["delete"].usage)
+	}
+
+	if idText, ok := strings.CutPrefix(args[0], "#"); ok {
+		id, err := strconv.Atoi(idText)
+		if err != nil || !d.RemoveBreakpointID(id) {
+			return fmt.Errorf("no breakpoint %s", args[0])
+		}
+		return nil
+	}
+
+	address, bank, err := d.parseLocation(args[0])
+	if err != nil {
+		return err
+	}
+
+	if !d.RemoveBankedBreakpoint(bank, address) {
+		return fmt.Errorf("no breakpoint at %s", d.formatAddress(bank, address))
+	}
+
+	return nil
+}
+
+func watchCommand(d *Debugger, out io.Writer, args []string) error {
+	if len(args) == 0 {
+		for _, w := range d.bus.Watchpoints() {
+			fmt.Fprintf(out, "%d: 0x%04X-0x%04X %s\n", w.ID, w.Start, w.End, w.Access)
+		}
+		return nil
+	}
+
+	args, expression, err := parseCondition(args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s", commands["watch"].usage)
+	}
+
+	startText, endText, isRange := strings.Cut(args[0], "-")
+	start, err := d.parseAddress(startText)
+	if err != nil {
+		return err
+	}
+
+	end := start
+	if isRange {
+		if end, err = d.parseAddress(endText); err != nil {
+			return err
+		}
+	}
+
+	access, args := memory.ACCESS_WRITE, args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "=") && !strings.HasPrefix(args[0], "!") {
+		if access, err = parseAccess(args[0]); err != nil {
+			return err
+		}
+		args = args[1:]
+	}
+
+	var id int
+	if expression != nil {
+		if len(args) > 0 {
+			return fmt.Errorf("usage: %s", commands["watch"].usage)
+		}
+
+		if id, err = d.AddConditionalWatchpoint(start, end, access, expression); err != nil {
+			return err
+		}
+	} else {
+		condition, err := parseValueCondition(args)
+		if err != nil {
+			return err
+		}
+
+		id = d.AddWatchpoint(start, end, access, condition)
+	}
+	fmt.Fprintf(out, "watchpoint %d on 0x%04X-0x%04X %s\n", id, start, end, access)
+
+	return nil
+}
+
+func unwatchCommand(d *Debugger, out io.Writer, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s", commands["unwatch"].usage)
+	}
+
+	id, err := strconv.Atoi(args[0])
+	if err != nil || !d.RemoveWatchpoint(id) {
+		return fmt.Errorf("no watchpoint %s", args[0])
+	}
+
+	return nil
+}
+
+// parseAccess parses a combination of r, w and x
+func parseAccess(text string) (memory.Access, error) {
+	var access memory.Access
+	for _, kind := range text {
+		switch kind {
+		case 'r':
+			access |= memory.ACCESS_READ
+		case 'w':
+			access |= memory.ACCESS_WRITE
+		case 'x':
+			access |= memory.ACCESS_EXECUTE
+		default:
+			return 0, fmt.Errorf("invalid access %q, expected a combination of r, w and x", text)
+		}
+	}
+
+	return access, nil
+}
+
+// parseValueCondition parses an optional "== value" or "!= value"
+func parseValueCondition(args []string) (func(value byte) bool, error) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+
+	if len(args) != 2 || (args[0] != "==" && args[0] != "!=") {
+		return nil, fmt.Errorf("invalid condition %q, expected == value or != value", strings.Join(args, " "))
+	}
+
+	expected, err := parseNumber(args[1], 8)
+	if err != nil {
+		return nil, err
+	}
+
+	equal := args[0] == "=="
+
+	return func(value byte) bool { return (value == byte(expected)) == equal }, nil
+}
+
+func regsCommand(d *Debugger, out io.Writer, args []string) error {
+	c := d.cpu
+
+	flags := []byte("----")
+	for i, name := range "ZNHC" {
+		if c.F&(0x80>>i) != 0 {
+			flags[i] = byte(name)
+		}
+	}
+
+	fmt.Fprintf(out, "A: %02X  F: %02X  [%s]\n", c.A, c.F, flags)
+	fmt.Fprintf(out, "B: %02X  C: %02X  BC: %04X\n", c.B, c.C, uint16(c.B)<<8|uint16(c.C))
+	fmt.Fprintf(out, "D: %02X  E: %02X  DE: %04X\n", c.D, c.E, uint16(c.D)<<8|uint16(c.E))
+	fmt.Fprintf(out, "H: %02X  L: %02X  HL: %04X\n", c.H, c.L, uint16(c.H)<<8|uint16(c.L))
+	fmt.Fprintf(out, "SP: %04X  PC: %04X\n", c.SP(), c.PC)
+
+	return nil
+}
+
+func backtraceCommand(d *Debugger, out io.Writer, args []string) error {
+	d.cpu.PrintBacktrace(out)
+
+	return nil
+}
+
+func rewindCommand(d *Debugger, out io.Writer, args []string) error {
+	count, err := parseCount(args, 0, 1)
+	if err != nil {
+		return err
+	}
+
+	frame, err := d.Rewind(count)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "rewound to frame %d\n", frame)
+	d.printLocation(out)
+
+	return nil
+}
+
+// stateFile returns the save state file given to a command, or the default one
+func (d *Debugger) stateFile(args []string) (string, error) {
+	if len(args) > 0 {
+		return args[0], nil
+	}
+
+	if d.statePath == "" {
+		return "", errors.New("no save state file")
+	}
+
+	return d.statePath, nil
+}
+
+func saveStateCommand(d *Debugger, out io.Writer, args []string) error {
+	path, err := d.stateFile(args)
+	if err != nil {
+		return err
+	}
+
+	if err := savestate.SaveFile(path, d.cpu, d.bus); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "saved state to %s\n", path)
+
+	return nil
+}
+
+func loadStateCommand(d *Debugger, out io.Writer, args []string) error {
+	path, err := d.stateFile(args)
+	if err != nil {
+		return err
+	}
+
+	if err := savestate.LoadFile(path, d.cpu, d.bus); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "loaded state from %s\n", path)
+	d.printLocation(out)
+
+	return nil
+}
+
+func hexdumpCommand(d *Debugger, out io.Writer, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s", commands["x"].usage)
+	}
+
+	address, err := d.parseAddress(args[0])
+	if err != nil {
+		return err
+	}
+
+	length, err := parseCount(args, 1, hexdumpLength)
+	if err != nil {
+		return err
+	}
+
+	for line := 0; line < length; line += hexdumpWidth {
+		start := address + uint16(line)
+		hex, ascii := strings.Builder{}, strings.Builder{}
+
+		for i := 0; i < hexdumpWidth && line+i < length; i++ {
+			value, err := d.bus.Peek(start+uint16(i), 1)
+			if err != nil {
+				hex.WriteString("?? ")
+				ascii.WriteByte('.')
+				continue
+			}
+
+			fmt.Fprintf(&hex, "%02X ", value[0])
+			if value[0] >= 0x20 && value[0] < 0x7F {
+				ascii.WriteByte(value[0])
+			} else {
+				ascii.WriteByte('.')
+			}
+		}
+
+		fmt.Fprintf(out, "%04X: %-48s|%s|\n", start, hex.String(), ascii.String())
+	}
+
+	return nil
+}
+
+func writeCommand(d *Debugger, out io.Writer, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: %s", commands["write"].usage)
+	}
+
+	address, err := d.parseAddress(args[0])
+	if err != nil {
+		return err
+	}
+
+	values := make([]byte, len(args)-1)
+	for i, arg := range args[1:] {
+		value, err := parseNumber(arg, 8)
+		if err != nil {
+			return err
+		}
+		values[i] = byte(value)
+	}
+
+	if int(address)+len(values) > 0x10000 {
+		return fmt.Errorf("write past the end of the memory map (0x%04X + %d bytes)", address, len(values))
+	}
+
+	for i, value := range values {
+		if err := d.bus.Poke(address+uint16(i), []byte{value}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func disasmCommand(d *Debugger, out io.Writer, args []string) error {
+	address := d.disassemblyStart()
+	if len(args) > 0 {
+		var err error
+		if address, err = d.parseAddress(args[0]); err != nil {
+			return err
+		}
+	}
+
+	count, err := parseCount(args, 1, disassemblyLines)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < count; i++ {
+		text, size := d.cpu.Disassemble(address)
+
+		marker := "  "
+		if address == d.cpu.PC {
+			marker = "=>"
+		} else if len(d.breakpointsAt(address)) > 0 {
+			marker = "* "
+		}
+
+		fmt.Fprintf(out, "%s %s: %s\n", marker, d.cpu.FormatAddress(address), text)
+		address += size
+	}
+
+	return nil
+}
+
+// disassemblyStart returns the address of the instruction disassemblyBefore instructions before PC,
+// walking back through the executed instructions ending where the next one starts, since the bytes
+// before PC cannot be decoded backwards, it stops early when the history does not know the previous one
+func (d *Debugger) disassemblyStart() uint16 {
+	bank := d.cpu.ROMBank(d.cpu.PC)
+	sizes := make(map[uint16]uint16)
+	for _, entry := range d.cpu.History() {
+		if entry.Bank == bank {
+			sizes[entry.Registers.PC] = entry.Size
+		}
+	}
+
+	address := d.cpu.PC
+	for i := 0; i < disassemblyBefore; i++ {
+		found := false
+		for size := uint16(1); size <= 3 && !found; size++ {
+			found = address >= size && sizes[address-size] == size
+			if found {
+				address -= size
+			}
+		}
+		if !found {
+			break
+		}
+	}
+
+	return address
+}
+
+func helpCommand(d *Debugger, out io.Writer, args []string) error {
+	names := []string{
+		"step", "next", "continue", "finish", "vblank", "frame", "break", "delete", "watch", "unwatch", "regs", "backtrace", "rewind", "savestate", "loadstate", "x", "write", "disasm", "quit", "help",
+	}
+
+	for _, name := range names {
+		fmt.Fprintf(out, "  %-42s %s\n", commands[name].usage, commands[name].description)
+	}
+
+	return nil
+}
+
+// parseNumber parses a hexadecimal number ("0x1234", "$1234" or "1234") of up to bits bits
+func parseNumber(text string, bits int) (uint64, error) {
+	digits := strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(text), "0x"), "$")
+
+	value, err := strconv.ParseUint(digits, 16, bits)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q, expected a %d bits hexadecimal number", text, bits)
+	}
+
+	return value, nil
+}
+
+// parseAddress parses a symbol name or a hexadecimal address
+func (d *Debugger) parseAddress(text string) (uint16, error) {
+	address, _, err := d.parseLocation(text)
+
+	return address, err
+}
+
+// parseLocation parses a symbol name or a hexadecimal address prefixed by an optional bank (02:4000),
+// symbols of the switchable ROM bank (0x4000 - 0x7FFF) also return their bank, the bank is -1 otherwise
+func (d *Debugger) parseLocation(text string) (address uint16, bank int, err error) {
+	if symbol, ok := d.cpu.Symbols().Find(text); ok {
+		if symbol.Address >= 0x4000 && symbol.Address <= 0x7FFF {
+			return symbol.Address, symbol.Bank, nil
+		}
+		return symbol.Address, -1, nil
+	}
+
+	bank = -1
+	if bankText, addressText, ok := strings.Cut(text, ":"); ok {
+		value, err := parseNumber(bankText, 16)
+		if err != nil {
+			return 0, -1, fmt.Errorf("invalid bank %q", bankText)
+		}
+		bank, text = int(value), addressText
+	}
+
+	value, err := parseNumber(text, 16)
+	if err != nil {
+		return 0, -1, fmt.Errorf("invalid address %q, expected a symbol or a [bank:]16 bits hexadecimal number", text)
+	}
+
+	return uint16(value), bank, nil
+}
+
+// formatAddress returns address followed by its symbol in bank, -1 for the ROM bank mapped now
+func (d *Debugger) formatAddress(bank int, address uint16) string {
+	if bank < 0 {
+		return d.cpu.FormatAddress(address)
+	}
+
+	if symbol := d.cpu.Symbols().Format(bank, address); symbol != "" {
+		return fmt.Sprintf("0x%04X <%s>", address, symbol)
+	}
+
+	return fmt.Sprintf("0x%04X", address)
+}
+
+// parseCount parses the decimal count at args[index], defaulting to fallback when absent
+func parseCount(args []string, index int, fallback int) (int, error) {
+	if len(args) <= index {
+		return fallback, nil
+	}
+
+	count, err := strconv.Atoi(args[index])
+	if err != nil || count < 1 {
+		return 0, fmt.Errorf("invalid count %q", args[index])
+	}
+
+	return count, nil
+}
@@ -0,0 +1,122 @@
+package disasm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/carvhal/gby/internal/symbols"
+)
+
+const BANK_SIZE = 0x4000
+
+// bankBase returns the address a ROM bank is mapped at, bank 0 is fixed at 0x0000 and the others switched in at 0x4000
+func bankBase(bank int) uint16 {
+	if bank == 0 {
+		return 0x0000
+	}
+
+	return BANK_SIZE
+}
+
+// bankInstructions sweeps the bank linearly, splitting instructions that would hide a label
+func bankInstructions(data []byte, base uint16, labels map[uint16]string) []Instruction {
+	var instructions []Instruction
+
+	for offset := 0; offset < len(data); {
+		address := base + uint16(offset)
+		instruction := DecodeBytes(data[offset:], address)
+
+		for inside := uint16(1); inside < instruction.Size(); inside++ {
+			if _, ok := labels[address+inside]; ok {
+				instruction = Instruction{Address: address, Bytes: data[offset : offset+1]}
+				break
+			}
+		}
+
+		instructions = append(instructions, instruction)
+		offset += int(instruction.Size())
+	}
+
+	return instructions
+}
+
+// bankLabels names the addresses of the bank, with the symbols of the bank, then the targets of the jumps and calls
+func bankLabels(data []byte, bank int, base uint16, table *symbols.Table) map[uint16]string {
+	inBank := func(address uint16) bool {
+		return address >= base && int(address) < int(base)+len(data)
+	}
+
+	labels := make(map[uint16]string)
+	for _, instruction := range bankInstructions(data, base, nil) {
+		target, ok := instruction.Target()
+		if !ok || !inBank(target) {
+			continue
+		}
+
+		// calls name their target first
+		if instruction.Flow() == FLOW_CALL {
+			labels[target] = fmt.Sprintf("Call_%03X_%04X", bank, target)
+		} else if _, ok := labels[target]; !ok {
+			labels[target] = fmt.Sprintf("Jump_%03X_%04X", bank, target)
+		}
+	}
+
+	// the first symbol of an address replaces its generated label
+	named := make(map[uint16]bool)
+	for _, symbol := range table.Bank(bank) {
+		if inBank(symbol.Address) && !named[symbol.Address] {
+			labels[symbol.Address] = symbol.Name
+			named[symbol.Address] = true
+		}
+	}
+
+	return labels
+}
+
+// WriteBank writes the disassembly of a ROM bank as an RGBDS section, with labels at the symbols of table,
+// which can be nil, and at the jump and call targets
+func WriteBank(w io.Writer, rom []byte, bank int, table *symbols.Table) error {
+	start := bank * BANK_SIZE
+	if bank < 0 || start >= len(rom) {
+		return fmt.Errorf("bank %d out of the %d banks of the ROM", bank, (len(rom)+BANK_SIZE-1)/BANK_SIZE)
+	}
+
+	data := rom[start:min(start+BANK_SIZE, len(rom))]
+	base := bankBase(bank)
+	labels := bankLabels(data, bank, base, table)
+
+	out := bufio.NewWriter(w)
+
+	if bank == 0 {
+		fmt.Fprintf(out, "SECTION \"ROM Bank $%03X\", ROM0[$%04X]\n", bank, base)
+	} else {
+		fmt.Fprintf(out, "SECTION \"ROM Bank $%03X\", ROMX[$%04X], BANK[$%X]\n", bank, base, bank)
+	}
+
+	label := func(address uint16) (string, bool) {
+		if name, ok := labels[address]; ok {
+			return name, true
+		}
+
+		// the bank mapped at 0x4000 is only known when disassembling one
+		if address >= BANK_SIZE && address <= 0x7FFF {
+			if bank == 0 {
+				return "", false
+			}
+			return table.Lookup(bank, address)
+		}
+
+		return table.Lookup(0, address)
+	}
+
+	for _, instruction := range bankInstructions(data, base, labels) {
+		if name, ok := labels[instruction.Address]; ok {
+			fmt.Fprintf(out, "\n%s:\n", name)
+		}
+
+		fmt.Fprintf(out, "    %-24s ; $%04X\n", instruction.Format(label), instruction.Address)
+	}
+
+	return out.Flush()
+}
@@ -0,0 +1,94 @@
+package disasm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/carvhal/gby/internal/symbols"
+	. "github.com/carvhal/gby/internal/testutils"
+)
+
+func TestWriteBank(t *testing.T) {
+	rom := make([]byte, 2*BANK_SIZE)
+	copy(rom[0x0100:], []byte{
+		0x00,             // nop
+		0xC3, 0x50, 0x01, // jp $0150
+	})
+	copy(rom[0x0150:], []byte{
+		0xCD, 0x58, 0x01, // call $0158
+		0x18, 0xFB, // jr $0150
+	})
+	copy(rom[0x0158:], []byte{0xC9}) // ret
+	copy(rom[0x4000:], []byte{0x20, 0xFE, 0xD3})
+
+	var out strings.Builder
+	Must(t, WriteBank(&out, rom, 0, nil), "Expected no error writing bank 0: %v")
+
+	output := out.String()
+	for _, expected := range []string{
+		"SECTION \"ROM Bank $000\", ROM0[$0000]",
+		"jp Jump_000_0150",
+		"\nJump_000_0150:\n    call Call_000_0158",
+		"jr Jump_000_0150",
+		"\nCall_000_0158:\n    ret",
+	} {
+		Expect(t, strings.Contains(output, expected), "output contains "+expected).ToEqual(true)
+	}
+
+	out.Reset()
+	Must(t, WriteBank(&out, rom, 1, nil), "Expected no error writing bank 1: %v")
+	for _, expected := range []string{
+		"SECTION \"ROM Bank $001\", ROMX[$4000], BANK[$1]",
+		"\nJump_001_4000:\n    jr nz, Jump_001_4000",
+		"db $D3",
+	} {
+		Expect(t, strings.Contains(out.String(), expected), "output contains "+expected).ToEqual(true)
+	}
+
+	Expect(t, WriteBank(&out, rom, 2, nil) != nil, "bank out of the ROM").ToEqual(true)
+}
+
+func TestLabelInsideInstruction(t *testing.T) {
+	rom := make([]byte, BANK_SIZE)
+	copy(rom, []byte{
+		0x3E, 0xAF, // ld a, $AF
+		0x18, 0xFD, // jr $0001, into the operand of ld
+	})
+
+	var out strings.Builder
+	Must(t, WriteBank(&out, rom, 0, nil), "Expected no error: %v")
+
+	Expect(t, strings.Contains(out.String(), "db $3E"), "ld split into data").ToEqual(true)
+	Expect(t, strings.Contains(out.String(), "Jump_000_0001:\n    xor a, a"), "label on the operand").ToEqual(true)
+}
+
+func TestWriteBankSymbols(t *testing.T) {
+	rom := make([]byte, 2*BANK_SIZE)
+	copy(rom[0x0150:], []byte{
+		0xCD, 0x00, 0x40, // call $4000
+		0xEA, 0x00, 0xC0, // ld [$C000], a
+		0xE0, 0x80, // ldh [$FF80], a
+		0xC3, 0x50, 0x01, // jp $0150
+	})
+	copy(rom[0x4000:], []byte{0xC9})
+
+	table, err := symbols.Parse(strings.NewReader("00:0150 Start\n01:4000 Banked\n00:c000 wX\n00:ff80 hY\n"))
+	Must(t, err, "Expected no error parsing symbols: %v")
+
+	var out strings.Builder
+	Must(t, WriteBank(&out, rom, 0, table), "Expected no error: %v")
+
+	output := out.String()
+	for _, expected := range []string{
+		"\nStart:\n    call $4000",
+		"ld [wX], a",
+		"ldh [hY], a",
+		"jp Start",
+	} {
+		Expect(t, strings.Contains(output, expected), "output contains "+expected).ToEqual(true)
+	}
+
+	out.Reset()
+	Must(t, WriteBank(&out, rom, 1, table), "Expected no error: %v")
+	Expect(t, strings.Contains(out.String(), "\nBanked:\n    ret"), "banked symbol").ToEqual(true)
+}
@@ -0,0 +1,237 @@
+package disasm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/carvhal/gby/internal/common"
+)
+
+/*
+* Instruction templates, the operand placeholders are replaced by the bytes following the opcode
+*
+* n8   | 8 bits immediate            | $2A
+* n16  | 16 bits immediate           | $C000
+* a8   | high page address           | [$FF80]
+* a16  | memory address              | [$C000]
+* e8   | relative jump target        | $0150 or its label
+* j16  | absolute jump / call target | $0150 or its label
+* s8   | signed offset               | -3
+* +s8  | signed offset with its sign | +3, -3
+*
+* opcodes without a template are illegal and shown as data (db $D3)
+*
+ */
+
+// Flow is how an instruction changes the flow of execution
+type Flow byte
+
+const (
+	FLOW_NONE   Flow = iota
+	FLOW_JUMP        // jp, jr
+	FLOW_CALL        // call, rst
+	FLOW_RETURN      // ret, reti
+)
+
+// Instruction is a decoded instruction
+type Instruction struct {
+	Address  uint16
+	Bytes    []byte // opcode, with its 0xCB prefix, and operands
+	template string
+}
+
+// peeker is implemented by memory buses able to read without triggering their watchpoints
+type peeker interface {
+	Peek(address uint16, ammount int) ([]byte, error)
+}
+
+// read reads through Peek when the bus supports it, decoding is not a data access
+func read(bus common.MemoryReadWriter, address uint16, ammount int) ([]byte, error) {
+	if p, ok := bus.(peeker); ok {
+		return p.Peek(address, ammount)
+	}
+
+	return bus.ReadFromAddress(address, ammount)
+}
+
+// Decode decodes the instruction at address
+func Decode(bus common.MemoryReadWriter, address uint16) (Instruction, error) {
+	opcode, err := read(bus, address, 1)
+	if err != nil {
+		return Instruction{}, err
+	}
+
+	bytes := []byte{opcode[0]}
+	size := templateSize(templates[opcode[0]], opcode[0] == 0xCB)
+
+	for i := uint16(1); i < size; i++ {
+		operand, err := read(bus, address+i, 1)
+		if err != nil {
+			return Instruction{}, err
+		}
+		bytes = append(bytes, operand[0])
+	}
+
+	return DecodeBytes(bytes, address), nil
+}
+
+// DecodeBytes decodes the instruction at the start of bytes, located at address,
+// an instruction truncated by the end of bytes is decoded as data
+func DecodeBytes(bytes []byte, address uint16) Instruction {
+	if len(bytes) == 0 {
+		return Instruction{Address: address}
+	}
+
+	prefixed := bytes[0] == 0xCB
+	template := templates[bytes[0]]
+	if prefixed && len(bytes) > 1 {
+		template = cbTemplates[bytes[1]]
+	}
+
+	size := templateSize(template, prefixed)
+	if int(size) > len(bytes) {
+		return Instruction{Address: address, Bytes: bytes[:1]}
+	}
+
+	return Instruction{Address: address, Bytes: bytes[:size], template: template}
+}
+
+// templateSize returns the size of the instructions using template, illegal opcodes are 1 byte of data
+func templateSize(template string, prefixed bool) uint16 {
+	switch {
+	case prefixed:
+		return 2
+	case template == "":
+		return 1
+	case strings.Contains(template, "n16") || strings.Contains(template, "a16") || strings.Contains(template, "j16"):
+		return 3
+	case strings.Contains(template, "n8") || strings.Contains(template, "a8") || strings.Contains(template, "e8") || strings.Contains(template, "s8"):
+		return 2
+	}
+
+	return 1
+}
+
+// Size returns the size of the instruction in bytes
+func (i Instruction) Size() uint16 {
+	return uint16(len(i.Bytes))
+}
+
+// Legal reports whether the bytes are an instruction, illegal opcodes lock up the CPU
+func (i Instruction) Legal() bool {
+	return i.template != ""
+}
+
+// Mnemonic returns the mnemonic of the instruction, db for illegal opcodes
+func (i Instruction) Mnemonic() string {
+	if !i.Legal() {
+		return "db"
+	}
+
+	mnemonic, _, _ := strings.Cut(i.template, " ")
+	return mnemonic
+}
+
+// Flow returns how the instruction changes the flow of execution
+func (i Instruction) Flow() Flow {
+	switch i.Mnemonic() {
+	case "jp", "jr":
+		return FLOW_JUMP
+	case "call", "rst":
+		return FLOW_CALL
+	case "ret", "reti":
+		return FLOW_RETURN
+	}
+
+	return FLOW_NONE
+}
+
+// Conditional reports whether the jump, call or return depends on a flag
+func (i Instruction) Conditional() bool {
+	if i.Flow() == FLOW_NONE {
+		return false
+	}
+
+	_, operands, _ := strings.Cut(i.template, " ")
+	first, _, _ := strings.Cut(operands, ",")
+
+	switch first {
+	case "nz", "z", "nc", "c":
+		return true
+	}
+
+	return false
+}
+
+// Target returns the address a jump or call goes to when it is encoded in the instruction,
+// the vector of rst is part of its opcode and not a target
+func (i Instruction) Target() (uint16, bool) {
+	switch {
+	case strings.Contains(i.template, "e8"):
+		return i.Address + i.Size() + uint16(int8(i.Bytes[1])), true
+	case strings.Contains(i.template, "j16"):
+		return i.n16(), true
+	}
+
+	return 0, false
+}
+
+func (i Instruction) n16() uint16 {
+	return uint16(i.Bytes[2])<<8 | uint16(i.Bytes[1])
+}
+
+func (i Instruction) String() string {
+	return i.Format(nil)
+}
+
+// Format returns the instruction in RGBDS syntax, label names the jump and call targets
+// and the memory addresses it knows
+func (i Instruction) Format(label func(address uint16) (string, bool)) string {
+	if !i.Legal() {
+		if len(i.Bytes) == 0 {
+			return "db"
+		}
+		return fmt.Sprintf("db $%02X", i.Bytes[0])
+	}
+
+	if i.Bytes[0] == 0x10 && i.Bytes[1] == 0x00 {
+		return "stop"
+	}
+
+	name := func(address uint16) string {
+		if label != nil {
+			if name, ok := label(address); ok {
+				return name
+			}
+		}
+		return fmt.Sprintf("$%04X", address)
+	}
+
+	target := ""
+	if address, ok := i.Target(); ok {
+		target = name(address)
+	}
+
+	var n8 byte
+	if len(i.Bytes) > 1 {
+		n8 = i.Bytes[1]
+	}
+
+	var n16 uint16
+	if len(i.Bytes) > 2 {
+		n16 = i.n16()
+	}
+
+	replacer := strings.NewReplacer(
+		"n16", fmt.Sprintf("$%04X", n16),
+		"a16", name(n16),
+		"j16", target,
+		"n8", fmt.Sprintf("$%02X", n8),
+		"a8", name(0xFF00|uint16(n8)),
+		"e8", target,
+		"+s8", fmt.Sprintf("%+d", int8(n8)),
+		"s8", fmt.Sprintf("%d", int8(n8)),
+	)
+
+	return replacer.Replace(i.template)
+}
@@ -0,0 +1,99 @@
+package disasm
+
+import (
+	"testing"
+
+	. "github.com/carvhal/gby/internal/testutils"
+)
+
+type mockMemory []byte
+
+func (m mockMemory) ReadFromAddress(address uint16, ammount int) ([]byte, error) {
+	return m[address : int(address)+ammount], nil
+}
+
+func (m mockMemory) WriteToAddress(address uint16, bytes []byte) error {
+	copy(m[address:], bytes)
+
+	return nil
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		bytes []byte
+		text  string
+	}{
+		{[]byte{0x00}, "nop"},
+		{[]byte{0x01, 0x34, 0x12}, "ld bc, $1234"},
+		{[]byte{0x08, 0x00, 0xC0}, "ld [$C000], sp"},
+		{[]byte{0x10, 0x00}, "stop"},
+		{[]byte{0x18, 0xFE}, "jr $0150"},
+		{[]byte{0x20, 0x05}, "jr nz, $0157"},
+		{[]byte{0x22}, "ld [hl+], a"},
+		{[]byte{0x3A}, "ld a, [hl-]"},
+		{[]byte{0x36, 0x2A}, "ld [hl], $2A"},
+		{[]byte{0x76}, "halt"},
+		{[]byte{0x7E}, "ld a, [hl]"},
+		{[]byte{0x90}, "sub a, b"},
+		{[]byte{0xAF}, "xor a, a"},
+		{[]byte{0xC3, 0x50, 0x01}, "jp $0150"},
+		{[]byte{0xCC, 0x00, 0x40}, "call z, $4000"},
+		{[]byte{0xD9}, "reti"},
+		{[]byte{0xE0, 0x80}, "ldh [$FF80], a"},
+		{[]byte{0xE2}, "ldh [c], a"},
+		{[]byte{0xE8, 0xFD}, "add sp, -3"},
+		{[]byte{0xE9}, "jp hl"},
+		{[]byte{0xF8, 0x02}, "ld hl, sp+2"},
+		{[]byte{0xF8, 0xFE}, "ld hl, sp-2"},
+		{[]byte{0xFA, 0x00, 0xC0}, "ld a, [$C000]"},
+		{[]byte{0xFE, 0x90}, "cp a, $90"},
+		{[]byte{0xFF}, "rst $38"},
+		{[]byte{0xCB, 0x11}, "rl c"},
+		{[]byte{0xCB, 0x37}, "swap a"},
+		{[]byte{0xCB, 0x7C}, "bit 7, h"},
+		{[]byte{0xCB, 0x86}, "res 0, [hl]"},
+		{[]byte{0xCB, 0xFF}, "set 7, a"},
+		{[]byte{0xD3}, "db $D3"},
+		{[]byte{0xC3, 0x50}, "db $C3"},
+	}
+
+	for _, test := range tests {
+		instruction := DecodeBytes(test.bytes, 0x0150)
+		Expect(t, instruction.String(), "text").ToEqual(test.text)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	memory := make(mockMemory, 0x10000)
+	copy(memory[0x0100:], []byte{0x00, 0xC3, 0x50, 0x01, 0xCD, 0x00, 0x20, 0xC9, 0xD3})
+
+	sizes := []uint16{1, 3, 3, 1, 1}
+	flows := []Flow{FLOW_NONE, FLOW_JUMP, FLOW_CALL, FLOW_RETURN, FLOW_NONE}
+
+	address := uint16(0x0100)
+	for i := range sizes {
+		instruction, err := Decode(memory, address)
+		Must(t, err, "Expected no error decoding: %v")
+		Expect(t, instruction.Size(), "size").ToEqual(sizes[i])
+		Expect(t, instruction.Flow(), "flow").ToEqual(flows[i])
+		address += instruction.Size()
+	}
+
+	jump, _ := Decode(memory, 0x0101)
+	target, ok := jump.Target()
+	Expect(t, ok, "jump has a target").ToEqual(true)
+	Expect(t, target, "target").ToEqual(uint16(0x0150))
+
+	label := func(address uint16) (string, bool) { return "Start", address == 0x0150 }
+	Expect(t, jump.Format(label), "labelled").ToEqual("jp Start")
+
+	illegal, _ := Decode(memory, 0x0108)
+	Expect(t, illegal.Legal(), "D3 is illegal").ToEqual(false)
+}
+
+func TestConditional(t *testing.T) {
+	Expect(t, DecodeBytes([]byte{0xD8}, 0).Conditional(), "ret c").ToEqual(true)
+	Expect(t, DecodeBytes([]byte{0xC9}, 0).Conditional(), "ret").ToEqual(false)
+	Expect(t, DecodeBytes([]byte{0xDA, 0, 0}, 0).Conditional(), "jp c").ToEqual(true)
+	Expect(t, DecodeBytes([]byte{0x4F}, 0).Conditional(), "ld c, a").ToEqual(false)
+}
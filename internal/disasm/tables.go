@@ -0,0 +1,143 @@
+package disasm
+
+import "fmt"
+
+// templates and cbTemplates map the opcodes to their instruction template, they are built
+// from the fields of the opcode: xx yyy zzz, with yyy split into pp q
+var templates, cbTemplates [256]string
+
+var (
+	registers     = [8]string{"b", "c", "d", "e", "h", "l", "[hl]", "a"}
+	pairs         = [4]string{"bc", "de", "hl", "sp"}
+	stackPairs    = [4]string{"bc", "de", "hl", "af"}
+	indirectPairs = [4]string{"[bc]", "[de]", "[hl+]", "[hl-]"}
+	conditions    = [4]string{"nz", "z", "nc", "c"}
+	arithmetic    = [8]string{"add", "adc", "sub", "sbc", "and", "xor", "or", "cp"}
+	rotations     = [8]string{"rlc", "rrc", "rl", "rr", "sla", "sra", "swap", "srl"}
+	accumulator   = [8]string{"rlca", "rrca", "rla", "rra", "daa", "cpl", "scf", "ccf"}
+)
+
+func init() {
+	for code := 0; code < 256; code++ {
+		templates[code] = template(byte(code))
+		cbTemplates[code] = cbTemplate(byte(code))
+	}
+}
+
+func template(code byte) string {
+	x, y, z := code>>6, code>>3&7, code&7
+	p, q := y>>1, y&1
+
+	switch x {
+	case 0:
+		switch z {
+		case 0:
+			switch {
+			case y == 0:
+				return "nop"
+			case y == 1:
+				return "ld [a16], sp"
+			case y == 2:
+				return "stop n8"
+			case y == 3:
+				return "jr e8"
+			}
+			return fmt.Sprintf("jr %s, e8", conditions[y-4])
+		case 1:
+			if q == 0 {
+				return fmt.Sprintf("ld %s, n16", pairs[p])
+			}
+			return fmt.Sprintf("add hl, %s", pairs[p])
+		case 2:
+			if q == 0 {
+				return fmt.Sprintf("ld %s, a", indirectPairs[p])
+			}
+			return fmt.Sprintf("ld a, %s", indirectPairs[p])
+		case 3:
+			if q == 0 {
+				return fmt.Sprintf("inc %s", pairs[p])
+			}
+			return fmt.Sprintf("dec %s", pairs[p])
+		case 4:
+			return fmt.Sprintf("inc %s", registers[y])
+		case 5:
+			return fmt.Sprintf("dec %s", registers[y])
+		case 6:
+			return fmt.Sprintf("ld %s, n8", registers[y])
+		}
+		return accumulator[y]
+	case 1:
+		if y == 6 && z == 6 {
+			return "halt"
+		}
+		return fmt.Sprintf("ld %s, %s", registers[y], registers[z])
+	case 2:
+		return fmt.Sprintf("%s a, %s", arithmetic[y], registers[z])
+	}
+
+	switch z {
+	case 0:
+		switch {
+		case y < 4:
+			return fmt.Sprintf("ret %s", conditions[y])
+		case y == 4:
+			return "ldh [a8], a"
+		case y == 5:
+			return "add sp, s8"
+		case y == 6:
+			return "ldh a, [a8]"
+		}
+		return "ld hl, sp+s8"
+	case 1:
+		if q == 0 {
+			return fmt.Sprintf("pop %s", stackPairs[p])
+		}
+		return [4]string{"ret", "reti", "jp hl", "ld sp, hl"}[p]
+	case 2:
+		switch {
+		case y < 4:
+			return fmt.Sprintf("jp %s, j16", conditions[y])
+		case y == 4:
+			return "ldh [c], a"
+		case y == 5:
+			return "ld [a16], a"
+		case y == 6:
+			return "ldh a, [c]"
+		}
+		return "ld a, [a16]"
+	case 3:
+		return [8]string{"jp j16", "", "", "", "", "", "di", "ei"}[y]
+	case 4:
+		if y < 4 {
+			return fmt.Sprintf("call %s, j16", conditions[y])
+		}
+		return ""
+	case 5:
+		if q == 0 {
+			return fmt.Sprintf("push %s", stackPairs[p])
+		}
+		if p == 0 {
+			return "call j16"
+		}
+		return ""
+	case 6:
+		return fmt.Sprintf("%s a, n8", arithmetic[y])
+	}
+
+	return fmt.Sprintf("rst $%02X", y*8)
+}
+
+func cbTemplate(code byte) string {
+	x, y, z := code>>6, code>>3&7, code&7
+
+	switch x {
+	case 0:
+		return fmt.Sprintf("%s %s", rotations[y], registers[z])
+	case 1:
+		return fmt.Sprintf("bit %d, %s", y, registers[z])
+	case 2:
+		return fmt.Sprintf("res %d, %s", y, registers[z])
+	}
+
+	return fmt.Sprintf("set %d, %s", y, registers[z])
+}
@@ -0,0 +1,114 @@
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+/*
+* Expressions
+*
+* operators, by increasing precedence
+*
+* ||
+* &&
+* == != < <= > >=
+* |
+* ^
+* &
+* << >>
+* + -
+* * / %
+* ! - ~ (unary)
+*
+* operands
+*
+* 42, 0x2A, $2A, 0b101010  | numbers
+* A, HL, PC, ZF...         | variables, case insensitive, provided by the environment
+* hit count                | same as the HITS variable
+* [address]                | byte of memory at address
+* (expression)             |
+*
+* comparisons and logical operators are 1 when true and 0 when false, any value but 0 is true
+*
+ */
+
+// Environment provides the values of the variables and the memory an expression reads
+type Environment interface {
+	Variable(name string) (value int, ok bool) // name is uppercase
+	ReadMemory(address uint16) byte
+}
+
+// SyntaxError is a parse error, Position is the byte offset of the error in Text
+type SyntaxError struct {
+	Text     string
+	Position int
+	Message  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("column %d: %s\n  %s\n  %s^", e.Position+1, e.Message, e.Text, strings.Repeat(" ", e.Position))
+}
+
+// ErrDivisionByZero is returned when an expression divides by zero
+var ErrDivisionByZero = errors.New("division by zero")
+
+// Expression is a parsed expression
+type Expression struct {
+	text      string
+	root      node
+	variables []string
+}
+
+// Parse parses text as an expression
+func Parse(text string) (*Expression, error) {
+	tokens, err := tokenize(text)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{text: text, tokens: tokens}
+	root, err := p.parseExpression(0)
+	if err != nil {
+		return nil, err
+	}
+
+	if next := p.peek(); next.kind != tokenEnd {
+		return nil, p.errorAt(next, fmt.Sprintf("expected an operator, got %s", next.describe()))
+	}
+
+	return &Expression{text: text, root: root, variables: p.variables}, nil
+}
+
+func (e *Expression) String() string {
+	return e.text
+}
+
+// Variables returns the names of the variables the expression uses, uppercase
+func (e *Expression) Variables() []string {
+	return e.variables
+}
+
+// Check returns an error naming the first variable the environment does not provide
+func (e *Expression) Check(env Environment) error {
+	for _, name := range e.variables {
+		if _, ok := env.Variable(name); !ok {
+			return fmt.Errorf("unknown variable %s", name)
+		}
+	}
+
+	return nil
+}
+
+// Evaluate returns the value of the expression
+func (e *Expression) Evaluate(env Environment) (int, error) {
+	return e.root.evaluate(env)
+}
+
+// True reports whether the expression evaluates to a value other than 0
+func (e *Expression) True(env Environment) (bool, error) {
+	value, err := e.Evaluate(env)
+
+	return value != 0, err
+}
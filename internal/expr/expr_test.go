@@ -0,0 +1,100 @@
+package expr
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	. "github.com/carvhal/gby/internal/testutils"
+)
+
+type testEnvironment struct {
+	variables map[string]int
+	memory    map[uint16]byte
+}
+
+func (e testEnvironment) Variable(name string) (int, bool) {
+	value, ok := e.variables[name]
+	return value, ok
+}
+
+func (e testEnvironment) ReadMemory(address uint16) byte {
+	return e.memory[address]
+}
+
+func TestEvaluate(t *testing.T) {
+	env := testEnvironment{
+		variables: map[string]int{"PC": 0x1234, "A": 0x20, "HL": 0xC000, "HITS": 5, "ZF": 1},
+		memory:    map[uint16]byte{0xC000: 0xFF, 0xC001: 0x02},
+	}
+
+	tests := []struct {
+		expression string
+		expected   int
+	}{
+		{"PC == 0x1234 && A > 0x10 && [HL] == 0xFF", 1},
+		{"pc == $1234 && a > 16", 1},
+		{"hit count >= 5", 1},
+		{"hit count >= 6", 0},
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"[HL + 1] << 4 | 1", 0x21},
+		{"A & 0b110000 == 0x20", 1},
+		{"!ZF || -1 < 0", 1},
+		{"~0 & 0xFF", 0xFF},
+		{"10 % 4 - 7 / 2", -1},
+	}
+
+	for _, test := range tests {
+		e, err := Parse(test.expression)
+		Must(t, err, "Expected no error parsing "+test.expression+": %v")
+
+		value, err := e.Evaluate(env)
+		Must(t, err, "Expected no error evaluating "+test.expression+": %v")
+		Expect(t, value, test.expression).ToEqual(test.expected)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		position   int
+		message    string
+	}{
+		{"PC == ", 6, "expected a number, a variable, ( or [, got end of expression"},
+		{"A > 0x1G", 4, `invalid number "0x1G"`},
+		{"(A + 1", 6, "expected ), got end of expression"},
+		{"[HL == 1", 8, "expected ], got end of expression"},
+		{"A B", 2, `expected an operator, got "B"`},
+		{"A == @", 5, `unexpected character '@'`},
+		{"&& A", 0, `expected a number, a variable, ( or [, got "&&"`},
+	}
+
+	for _, test := range tests {
+		_, err := Parse(test.expression)
+
+		var syntaxError *SyntaxError
+		Expect(t, errors.As(err, &syntaxError), test.expression+" is a syntax error").ToEqual(true)
+		Expect(t, syntaxError.Position, test.expression+" position").ToEqual(test.position)
+		Expect(t, syntaxError.Message, test.expression+" message").ToEqual(test.message)
+	}
+
+	_, err := Parse("A == ")
+	Expect(t, strings.Contains(err.Error(), "column 6"), "error column").ToEqual(true)
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	env := testEnvironment{variables: map[string]int{"A": 0}}
+
+	e, _ := Parse("B == 1")
+	Expect(t, e.Check(env) != nil, "unknown variable").ToEqual(true)
+	Expect(t, e.Variables(), "variables").ToEqual([]string{"B"})
+
+	e, _ = Parse("1 / A")
+	_, err := e.Evaluate(env)
+	Expect(t, err, "division by zero").ToEqual(ErrDivisionByZero)
+
+	e, _ = Parse("A != 0 && 1 / A")
+	_, err = e.Evaluate(env)
+	Must(t, err, "Expected && to short circuit: %v")
+}
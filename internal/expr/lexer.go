@@ -0,0 +1,140 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type tokenKind byte
+
+const (
+	tokenEnd tokenKind = iota
+	tokenNumber
+	tokenIdentifier
+	tokenOperator
+	tokenOpenParen
+	tokenCloseParen
+	tokenOpenBracket
+	tokenCloseBracket
+)
+
+type token struct {
+	kind     tokenKind
+	text     string
+	value    int
+	position int // byte offset in the expression
+}
+
+func (t token) describe() string {
+	if t.kind == tokenEnd {
+		return "end of expression"
+	}
+
+	return fmt.Sprintf("%q", t.text)
+}
+
+// operators are matched longest first
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "<<", ">>", "<", ">", "+", "-", "*", "/", "%", "&", "|", "^", "!", "~"}
+
+// tokenize splits an expression into tokens, "hit count" is read as the single identifier HITS
+func tokenize(text string) ([]token, error) {
+	var tokens []token
+
+	for i := 0; i < len(text); {
+		c := text[i]
+
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenOpenParen, text: "(", position: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenCloseParen, text: ")", position: i})
+			i++
+		case c == '[':
+			tokens = append(tokens, token{kind: tokenOpenBracket, text: "[", position: i})
+			i++
+		case c == ']':
+			tokens = append(tokens, token{kind: tokenCloseBracket, text: "]", position: i})
+			i++
+		case c == '$' || isDigit(c):
+			end := i + 1
+			for end < len(text) && isIdentifierByte(text[end]) {
+				end++
+			}
+
+			value, err := parseNumber(text[i:end])
+			if err != nil {
+				return nil, &SyntaxError{Text: text, Position: i, Message: err.Error()}
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: text[i:end], value: value, position: i})
+			i = end
+		case isIdentifierByte(c):
+			end := i
+			for end < len(text) && isIdentifierByte(text[end]) {
+				end++
+			}
+
+			name := strings.ToUpper(text[i:end])
+			if name == "HIT" {
+				if rest := strings.TrimLeft(text[end:], " \t"); len(rest) >= 5 && strings.EqualFold(rest[:5], "count") &&
+					(len(rest) == 5 || !isIdentifierByte(rest[5])) {
+					end = len(text) - len(rest) + 5
+					name = "HITS"
+				}
+			}
+
+			tokens = append(tokens, token{kind: tokenIdentifier, text: name, position: i})
+			i = end
+		default:
+			operator := ""
+			for _, candidate := range operators {
+				if strings.HasPrefix(text[i:], candidate) {
+					operator = candidate
+					break
+				}
+			}
+
+			if operator == "" {
+				return nil, &SyntaxError{Text: text, Position: i, Message: fmt.Sprintf("unexpected character %q", c)}
+			}
+
+			tokens = append(tokens, token{kind: tokenOperator, text: operator, position: i})
+			i += len(operator)
+		}
+	}
+
+	return append(tokens, token{kind: tokenEnd, position: len(text)}), nil
+}
+
+// parseNumber parses decimal, hexadecimal ("0x1F", "$1F") and binary ("0b101") numbers
+func parseNumber(text string) (int, error) {
+	lower := strings.ToLower(text)
+	base, digits := 10, lower
+
+	switch {
+	case strings.HasPrefix(lower, "0x"):
+		base, digits = 16, lower[2:]
+	case strings.HasPrefix(lower, "$"):
+		base, digits = 16, lower[1:]
+	case strings.HasPrefix(lower, "0b"):
+		base, digits = 2, lower[2:]
+	}
+
+	value, err := strconv.ParseInt(digits, base, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", text)
+	}
+
+	return int(value), nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentifierByte(c byte) bool {
+	return isDigit(c) || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
@@ -0,0 +1,263 @@
+package expr
+
+import "fmt"
+
+// precedences of the binary operators, higher binds tighter
+var precedences = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3, "!=": 3, "<": 3, "<=": 3, ">": 3, ">=": 3,
+	"|":  4,
+	"^":  5,
+	"&":  6,
+	"<<": 7, ">>": 7,
+	"+": 8, "-": 8,
+	"*": 9, "/": 9, "%": 9,
+}
+
+// parser is a precedence climbing parser over the tokens of an expression
+type parser struct {
+	text      string
+	tokens    []token
+	index     int
+	variables []string
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.index]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.index]
+	if t.kind != tokenEnd {
+		p.index++
+	}
+
+	return t
+}
+
+func (p *parser) errorAt(t token, message string) error {
+	return &SyntaxError{Text: p.text, Position: t.position, Message: message}
+}
+
+// parseExpression parses binary operations whose operators bind tighter than minPrecedence
+func (p *parser) parseExpression(minPrecedence int) (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t := p.peek()
+		precedence, ok := precedences[t.text]
+		if t.kind != tokenOperator || !ok || precedence <= minPrecedence {
+			return left, nil
+		}
+		p.next()
+
+		right, err := p.parseExpression(precedence)
+		if err != nil {
+			return nil, err
+		}
+
+		left = &binaryNode{operator: t.text, left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	t := p.peek()
+	if t.kind == tokenOperator && (t.text == "!" || t.text == "-" || t.text == "~") {
+		p.next()
+
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		return &unaryNode{operator: t.text, operand: operand}, nil
+	}
+
+	return p.parseOperand()
+}
+
+func (p *parser) parseOperand() (node, error) {
+	t := p.next()
+
+	switch t.kind {
+	case tokenNumber:
+		return numberNode(t.value), nil
+	case tokenIdentifier:
+		p.addVariable(t.text)
+		return variableNode(t.text), nil
+	case tokenOpenParen:
+		inner, err := p.parseClosed(tokenCloseParen, ")")
+		if err != nil {
+			return nil, err
+		}
+		return inner, nil
+	case tokenOpenBracket:
+		address, err := p.parseClosed(tokenCloseBracket, "]")
+		if err != nil {
+			return nil, err
+		}
+		return &memoryNode{address: address}, nil
+	}
+
+	return nil, p.errorAt(t, fmt.Sprintf("expected a number, a variable, ( or [, got %s", t.describe()))
+}
+
+// parseClosed parses an expression followed by the closing token
+func (p *parser) parseClosed(closing tokenKind, text string) (node, error) {
+	inner, err := p.parseExpression(0)
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.next(); t.kind != closing {
+		return nil, p.errorAt(t, fmt.Sprintf("expected %s, got %s", text, t.describe()))
+	}
+
+	return inner, nil
+}
+
+func (p *parser) addVariable(name string) {
+	for _, known := range p.variables {
+		if known == name {
+			return
+		}
+	}
+
+	p.variables = append(p.variables, name)
+}
+
+// node is a node of the syntax tree
+type node interface {
+	evaluate(env Environment) (int, error)
+}
+
+type numberNode int
+
+func (n numberNode) evaluate(env Environment) (int, error) {
+	return int(n), nil
+}
+
+type variableNode string
+
+func (n variableNode) evaluate(env Environment) (int, error) {
+	value, ok := env.Variable(string(n))
+	if !ok {
+		return 0, fmt.Errorf("unknown variable %s", string(n))
+	}
+
+	return value, nil
+}
+
+type memoryNode struct {
+	address node
+}
+
+func (n *memoryNode) evaluate(env Environment) (int, error) {
+	address, err := n.address.evaluate(env)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(env.ReadMemory(uint16(address))), nil
+}
+
+type unaryNode struct {
+	operator string
+	operand  node
+}
+
+func (n *unaryNode) evaluate(env Environment) (int, error) {
+	value, err := n.operand.evaluate(env)
+	if err != nil {
+		return 0, err
+	}
+
+	switch n.operator {
+	case "!":
+		return boolean(value == 0), nil
+	case "-":
+		return -value, nil
+	}
+
+	return ^value, nil
+}
+
+type binaryNode struct {
+	operator    string
+	left, right node
+}
+
+func (n *binaryNode) evaluate(env Environment) (int, error) {
+	left, err := n.left.evaluate(env)
+	if err != nil {
+		return 0, err
+	}
+
+	// short circuit, the right side may read memory
+	switch {
+	case n.operator == "&&" && left == 0:
+		return 0, nil
+	case n.operator == "||" && left != 0:
+		return 1, nil
+	}
+
+	right, err := n.right.evaluate(env)
+	if err != nil {
+		return 0, err
+	}
+
+	switch n.operator {
+	case "&&", "||":
+		return boolean(right != 0), nil
+	case "==":
+		return boolean(left == right), nil
+	case "!=":
+		return boolean(left != right), nil
+	case "<":
+		return boolean(left < right), nil
+	case "<=":
+		return boolean(left <= right), nil
+	case ">":
+		return boolean(left > right), nil
+	case ">=":
+		return boolean(left >= right), nil
+	case "|":
+		return left | right, nil
+	case "^":
+		return left ^ right, nil
+	case "&":
+		return left & right, nil
+	case "<<":
+		return left << (right & 31), nil
+	case ">>":
+		return left >> (right & 31), nil
+	case "+":
+		return left + right, nil
+	case "-":
+		return left - right, nil
+	case "*":
+		return left * right, nil
+	case "/", "%":
+		if right == 0 {
+			return 0, ErrDivisionByZero
+		}
+		if n.operator == "/" {
+			return left / right, nil
+		}
+		return left % right, nil
+	}
+
+	return 0, fmt.Errorf("unknown operator %s", n.operator)
+}
+
+func boolean(value bool) int {
+	if value {
+		return 1
+	}
+
+	return 0
+}
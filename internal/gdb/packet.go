@@ -0,0 +1,113 @@
+package gdb
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+/*
+* Remote serial protocol framing
+*
+* $<data>#<checksum>  | packet, checksum is the sum of the data bytes modulo 256 in 2 hex digits
+* +  /  -             | acknowledges / asks to resend the last packet, unless no ack mode was started
+* 0x03                | interrupt, sent by the debugger while the target runs
+*
+* '#', '$', '}' and '*' in the data are escaped as '}' followed by the byte XOR 0x20
+*
+ */
+
+const interruptByte = 0x03
+
+// readPacket reads the next packet, acknowledging it, interrupts received meanwhile are passed to onInterrupt
+func readPacket(r *bufio.Reader, w io.Writer, ack bool, onInterrupt func()) (string, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+
+		switch b {
+		case interruptByte:
+			onInterrupt()
+			continue
+		case '$':
+		default:
+			// acks and line noise
+			continue
+		}
+
+		data, err := r.ReadBytes('#')
+		if err != nil {
+			return "", err
+		}
+		data = data[:len(data)-1]
+
+		checksum := make([]byte, 2)
+		if _, err := io.ReadFull(r, checksum); err != nil {
+			return "", err
+		}
+
+		if ack {
+			var expected byte
+			if _, err := fmt.Sscanf(string(checksum), "%02x", &expected); err != nil || expected != sum(data) {
+				if _, err := w.Write([]byte{'-'}); err != nil {
+					return "", err
+				}
+				continue
+			}
+
+			if _, err := w.Write([]byte{'+'}); err != nil {
+				return "", err
+			}
+		}
+
+		return string(unescape(data)), nil
+	}
+}
+
+// writePacket frames and sends a reply
+func writePacket(w io.Writer, data string) error {
+	escaped := escape([]byte(data))
+	_, err := fmt.Fprintf(w, "$%s#%02x", escaped, sum(escaped))
+
+	return err
+}
+
+func sum(data []byte) byte {
+	var checksum byte
+	for _, b := range data {
+		checksum += b
+	}
+
+	return checksum
+}
+
+func escape(data []byte) []byte {
+	escaped := make([]byte, 0, len(data))
+	for _, b := range data {
+		switch b {
+		case '#', '$', '}', '*':
+			escaped = append(escaped, '}', b^0x20)
+		default:
+			escaped = append(escaped, b)
+		}
+	}
+
+	return escaped
+}
+
+func unescape(data []byte) []byte {
+	unescaped := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		if data[i] == '}' && i+1 < len(data) {
+			i++
+			unescaped = append(unescaped, data[i]^0x20)
+			continue
+		}
+
+		unescaped = append(unescaped, data[i])
+	}
+
+	return unescaped
+}
@@ -0,0 +1,512 @@
+package gdb
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/carvhal/gby/internal/cpu"
+	"github.com/carvhal/gby/internal/debugger"
+	"github.com/carvhal/gby/internal/memory"
+)
+
+/*
+* GDB remote serial protocol server
+*
+* registers, in the order of the g packet, 16 bits little endian each: AF, BC, DE, HL, SP, PC
+*
+* packet           | description
+*
+* ?                | last stop reason
+* g / G            | read / write every register
+* p n / P n=v      | read / write register n
+* m a,l / M a,l:x  | read / write l bytes from a
+* c / s [a]        | continue / single step, from a if given
+* vCont;c / ;s     | same as c / s
+* Z0-1 / z0-1 a,k  | add / remove a software or hardware breakpoint, both are handled by the debugger
+* Z2-4 / z2-4 a,k  | add / remove a write, read or access watchpoint on k bytes from a
+* qXfer:features   | target description
+* D / k            | detach / kill, end the session
+*
+* unsupported packets get an empty reply, as the protocol requires
+*
+ */
+
+const (
+	registerCount = 6
+	packetSize    = 0x4000
+
+	// signals reported in stop replies
+	sigint  = 0x02
+	sigill  = 0x04
+	sigtrap = 0x05
+)
+
+// watchKinds maps the Z packet types of watchpoints to the accesses they watch and the name of their stop reply
+var watchKinds = map[string]struct {
+	access memory.Access
+	reply  string
+}{
+	"2": {memory.ACCESS_WRITE, "watch"},
+	"3": {memory.ACCESS_READ, "rwatch"},
+	"4": {memory.ACCESS_READ | memory.ACCESS_WRITE, "awatch"},
+}
+
+// watchpoint is a watchpoint set by the debugger, the key of the bus watchpoint ID
+type watchpoint struct {
+	kind    string
+	address uint16
+	length  int
+}
+
+// Server exposes the CPU and the bus to a GDB compatible debugger
+type Server struct {
+	cpu         *cpu.CPU
+	bus         *memory.Controller
+	debugger    *debugger.Debugger
+	watchpoints map[watchpoint]int
+	lastStop    string
+}
+
+func NewServer(cpu *cpu.CPU, bus *memory.Controller) *Server {
+	return &Server{
+		cpu:         cpu,
+		bus:         bus,
+		debugger:    debugger.New(cpu, bus),
+		watchpoints: make(map[watchpoint]int),
+		lastStop:    fmt.Sprintf("S%02x", sigtrap),
+	}
+}
+
+// ListenAndServe accepts debugger connections on address (e.g. "localhost:2345"), one session at a time
+func (s *Server) ListenAndServe(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+
+		err = s.Serve(conn)
+		conn.Close()
+
+		if err != nil && err != io.EOF {
+			return err
+		}
+	}
+}
+
+// lockedWriter serializes the acks of the reading goroutine and the replies
+type lockedWriter struct {
+	sync.Mutex
+	w io.Writer
+}
+
+func (l *lockedWriter) Write(data []byte) (int, error) {
+	l.Lock()
+	defer l.Unlock()
+
+	return l.w.Write(data)
+}
+
+// Serve runs a session on conn until the debugger detaches or the connection is closed
+func (s *Server) Serve(conn io.ReadWriter) error {
+	w := &lockedWriter{w: conn}
+	packets, errs := make(chan string), make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+
+	// packets are read while the CPU runs, so the interrupt byte can stop it
+	go func() {
+		r, ack := bufio.NewReader(conn), true
+		for {
+			packet, err := readPacket(r, w, ack, s.debugger.Interrupt)
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			if packet == "QStartNoAckMode" {
+				ack = false
+			}
+
+			select {
+			case packets <- packet:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		var packet string
+		select {
+		case packet = <-packets:
+		case err := <-errs:
+			return err
+		}
+
+		reply, over := s.handle(packet)
+		if err := writePacket(w, reply); err != nil {
+			return err
+		}
+
+		if over {
+			return nil
+		}
+	}
+}
+
+// handle returns the reply to a packet, and whether the session is over
+func (s *Server) handle(packet string) (reply string, done bool) {
+	if packet == "" {
+		return "", false
+	}
+
+	args := packet[1:]
+
+	switch packet[0] {
+	case '?':
+		return s.lastStop, false
+	case 'g':
+		return s.readRegisters(), false
+	case 'G':
+		return s.writeRegisters(args), false
+	case 'p':
+		return s.readRegister(args), false
+	case 'P':
+		return s.writeRegister(args), false
+	case 'm':
+		return s.readMemory(args), false
+	case 'M':
+		return s.writeMemory(args), false
+	case 'c':
+		return s.resume(args, false), false
+	case 's':
+		return s.resume(args, true), false
+	case 'Z', 'z':
+		return s.breakpoint(packet[0] == 'Z', args), false
+	case 'H':
+		return "OK", false
+	case 'D':
+		return "OK", true
+	case 'k':
+		return "OK", true
+	case 'v':
+		return s.handleV(packet), false
+	case 'q', 'Q':
+		return s.handleQuery(packet), false
+	}
+
+	return "", false
+}
+
+func (s *Server) handleV(packet string) string {
+	switch {
+	case packet == "vCont?":
+		return "vCont;c;C;s;S"
+	case strings.HasPrefix(packet, "vCont;"):
+		action := strings.SplitN(packet[len("vCont;"):], ";", 2)[0]
+		return s.resume("", strings.HasPrefix(action, "s") || strings.HasPrefix(action, "S"))
+	}
+
+	return ""
+}
+
+func (s *Server) handleQuery(packet string) string {
+	switch {
+	case strings.HasPrefix(packet, "qSupported"):
+		return fmt.Sprintf("PacketSize=%x;qXfer:features:read+;swbreak+;hwbreak+;QStartNoAckMode+", packetSize)
+	case packet == "QStartNoAckMode":
+		return "OK"
+	case packet == "qAttached":
+		return "1"
+	case packet == "qC":
+		return "QC1"
+	case packet == "qfThreadInfo":
+		return "m1"
+	case packet == "qsThreadInfo":
+		return "l"
+	case strings.HasPrefix(packet, "qXfer:features:read:target.xml:"):
+		return readXfer(targetDescription, packet[len("qXfer:features:read:target.xml:"):])
+	}
+
+	return ""
+}
+
+// readXfer returns the part of document requested by "offset,length"
+func readXfer(document string, args string) string {
+	offset, length, ok := parseAddressLength(args)
+	if !ok {
+		return "E01"
+	}
+
+	if int(offset) >= len(document) {
+		return "l"
+	}
+
+	end := min(int(offset)+length, len(document))
+	if end == len(document) {
+		return "l" + document[offset:end]
+	}
+
+	return "m" + document[offset:end]
+}
+
+// registers returns pointers to the high and low bytes of the register pairs in g packet order, SP and PC are not byte pairs
+func (s *Server) registers() [registerCount][2]*byte {
+	c := s.cpu
+
+	return [registerCount][2]*byte{{&c.A, &c.F}, {&c.B, &c.C}, {&c.D, &c.E}, {&c.H, &c.L}}
+}
+
+func (s *Server) register(n int) uint16 {
+	switch n {
+	case 4:
+		return s.cpu.SP()
+	case 5:
+		return s.cpu.PC
+	}
+
+	pair := s.registers()[n]
+
+	return uint16(*pair[0])<<8 | uint16(*pair[1])
+}
+
+func (s *Server) setRegister(n int, value uint16) {
+	switch n {
+	case 4:
+		s.cpu.SetSP(value)
+	case 5:
+		s.cpu.PC = value
+	default:
+		pair := s.registers()[n]
+		*pair[0], *pair[1] = byte(value>>8), byte(value)
+	}
+}
+
+func (s *Server) readRegisters() string {
+	var reply strings.Builder
+	for n := 0; n < registerCount; n++ {
+		reply.WriteString(encodeRegister(s.register(n)))
+	}
+
+	return reply.String()
+}
+
+func (s *Server) writeRegisters(args string) string {
+	if len(args) != registerCount*4 {
+		return "E01"
+	}
+
+	for n := 0; n < registerCount; n++ {
+		value, ok := decodeRegister(args[n*4 : n*4+4])
+		if !ok {
+			return "E01"
+		}
+		s.setRegister(n, value)
+	}
+
+	return "OK"
+}
+
+func (s *Server) readRegister(args string) string {
+	n, err := strconv.ParseUint(args, 16, 8)
+	if err != nil || n >= registerCount {
+		return "E01"
+	}
+
+	return encodeRegister(s.register(int(n)))
+}
+
+func (s *Server) writeRegister(args string) string {
+	number, encoded, found := strings.Cut(args, "=")
+	n, err := strconv.ParseUint(number, 16, 8)
+	value, ok := decodeRegister(encoded)
+	if !found || err != nil || n >= registerCount || !ok {
+		return "E01"
+	}
+
+	s.setRegister(int(n), value)
+
+	return "OK"
+}
+
+// encodeRegister returns a register value in target byte order (little endian) as hex
+func encodeRegister(value uint16) string {
+	return hex.EncodeToString([]byte{byte(value), byte(value >> 8)})
+}
+
+func decodeRegister(encoded string) (uint16, bool) {
+	data, err := hex.DecodeString(encoded)
+	if err != nil || len(data) != 2 {
+		return 0, false
+	}
+
+	return uint16(data[0]) | uint16(data[1])<<8, true
+}
+
+func (s *Server) readMemory(args string) string {
+	address, length, ok := parseAddressLength(args)
+	if !ok {
+		return "E01"
+	}
+
+	data := make([]byte, 0, length)
+	for i := 0; i < length; i++ {
+		value, err := s.bus.Peek(address+uint16(i), 1)
+		if err != nil {
+			break
+		}
+		data = append(data, value[0])
+	}
+
+	if len(data) == 0 && length > 0 {
+		return "E02"
+	}
+
+	return hex.EncodeToString(data)
+}
+
+func (s *Server) writeMemory(args string) string {
+	target, encoded, found := strings.Cut(args, ":")
+	address, length, ok := parseAddressLength(target)
+	data, err := hex.DecodeString(encoded)
+	if !found || !ok || err != nil || len(data) != length {
+		return "E01"
+	}
+
+	if !writable(address, length) {
+		return "E02"
+	}
+
+	for i, value := range data {
+		if err := s.bus.Poke(address+uint16(i), []byte{value}); err != nil {
+			return "E02"
+		}
+	}
+
+	return "OK"
+}
+
+// writable reports if length bytes at address can be written by M packets, they must stay in one region
+// of the memory map and leave the cartridge ROM alone, where writes would switch banks
+func writable(address uint16, length int) bool {
+	if length == 0 || int(address)+length > 0x10000 {
+		return false
+	}
+
+	region := memory.Region(address)
+	if region != memory.Region(address+uint16(length-1)) {
+		return false
+	}
+
+	switch region {
+	case "cartridge ROM", "echo RAM", "not usable":
+		return false
+	}
+
+	return true
+}
+
+func (s *Server) breakpoint(insert bool, args string) string {
+	fields := strings.SplitN(args, ",", 3)
+	if len(fields) < 3 {
+		return "E01"
+	}
+
+	address, length, ok := parseAddressLength(fields[1] + "," + fields[2])
+	if !ok {
+		return "E01"
+	}
+
+	switch fields[0] {
+	case "0", "1":
+		if insert {
+			s.debugger.AddBreakpoint(address)
+		} else {
+			s.debugger.RemoveBreakpoint(address)
+		}
+	case "2", "3", "4":
+		w := watchpoint{fields[0], address, length}
+		if insert {
+			s.removeWatchpoint(w)
+			end := address + uint16(max(length, 1)-1)
+			s.watchpoints[w] = s.debugger.AddWatchpoint(address, end, watchKinds[w.kind].access, nil)
+		} else {
+			s.removeWatchpoint(w)
+		}
+	default:
+		return ""
+	}
+
+	return "OK"
+}
+
+func (s *Server) removeWatchpoint(w watchpoint) {
+	if id, ok := s.watchpoints[w]; ok {
+		s.debugger.RemoveWatchpoint(id)
+		delete(s.watchpoints, w)
+	}
+}
+
+// watchReply returns the stop reply name of a bus watchpoint
+func (s *Server) watchReply(id int) string {
+	for w, watchID := range s.watchpoints {
+		if watchID == id {
+			return watchKinds[w.kind].reply
+		}
+	}
+
+	return "watch"
+}
+
+// resume continues or steps from the address in args, if any, and returns the stop reply
+func (s *Server) resume(args string, step bool) string {
+	if args != "" {
+		address, err := strconv.ParseUint(args, 16, 16)
+		if err != nil {
+			return "E01"
+		}
+		s.cpu.PC = uint16(address)
+	}
+
+	stop, err := s.debugger.Run(func() bool { return step })
+
+	switch {
+	case err != nil:
+		s.lastStop = fmt.Sprintf("S%02x", sigill)
+	case stop.Reason == debugger.STOP_WATCHPOINT:
+		s.lastStop = fmt.Sprintf("T%02x%s:%04x;", sigtrap, s.watchReply(stop.Access.Watchpoint), stop.Access.Address)
+	case stop.Reason == debugger.STOP_BREAKPOINT:
+		s.lastStop = fmt.Sprintf("T%02xswbreak:;", sigtrap)
+	case stop.Reason == debugger.STOP_INTERRUPT:
+		s.lastStop = fmt.Sprintf("S%02x", sigint)
+	default:
+		s.lastStop = fmt.Sprintf("S%02x", sigtrap)
+	}
+
+	return s.lastStop
+}
+
+// parseAddressLength parses "address,length" in hex
+func parseAddressLength(args string) (address uint16, length int, ok bool) {
+	a, l, found := strings.Cut(args, ",")
+	parsedAddress, err1 := strconv.ParseUint(a, 16, 16)
+	parsedLength, err2 := strconv.ParseUint(l, 16, 16)
+	if !found || err1 != nil || err2 != nil {
+		return 0, 0, false
+	}
+
+	return uint16(parsedAddress), int(parsedLength), true
+}
@@ -0,0 +1,121 @@
+package gdb
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/carvhal/gby/internal/cpu"
+	"github.com/carvhal/gby/internal/memory"
+	. "github.com/carvhal/gby/internal/testutils"
+)
+
+// client is the debugger side of a session
+type client struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// startSession serves a ROM starting with program and returns a client connected to it
+func startSession(t *testing.T, program ...byte) (*client, *Server) {
+	rom := make([]byte, 0x8000)
+	copy(rom, program)
+
+	bus := memory.NewController(rom)
+	server := NewServer(cpu.NewCPU(bus), bus)
+
+	serverConn, clientConn := net.Pipe()
+	go server.Serve(serverConn)
+	t.Cleanup(func() { clientConn.Close() })
+
+	return &client{conn: clientConn, r: bufio.NewReader(clientConn)}, server
+}
+
+// send sends a packet and returns the reply
+func (c *client) send(t *testing.T, packet string) string {
+	Must(t, writePacket(c.conn, packet), "Expected no error sending the packet: %v")
+
+	ack, err := c.r.ReadByte()
+	Must(t, err, "Expected no error reading the ack: %v")
+	Expect(t, ack, "ack of "+packet).ToEqual(byte('+'))
+
+	reply, err := readPacket(c.r, discard{}, false, func() {})
+	Must(t, err, "Expected no error reading the reply: %v")
+
+	return reply
+}
+
+type discard struct{}
+
+func (discard) Write(data []byte) (int, error) {
+	return len(data), nil
+}
+
+func TestRegistersAndMemory(t *testing.T) {
+	c, server := startSession(t)
+
+	Expect(t, c.send(t, "P1=3412"), "write BC").ToEqual("OK")
+	Expect(t, server.cpu.B, "B").ToEqual(byte(0x12))
+	Expect(t, c.send(t, "p1"), "read BC").ToEqual("3412")
+
+	server.cpu.A, server.cpu.F = 0x01, 0xB0
+	Expect(t, c.send(t, "g"), "registers").ToEqual("b001" + "3412" + "0000" + "0000" + "0000" + "0000")
+
+	Expect(t, c.send(t, "Mc000,3:0a0b0c"), "write memory").ToEqual("OK")
+	Expect(t, c.send(t, "mc000,3"), "read memory").ToEqual("0a0b0c")
+	Expect(t, c.send(t, "mfea0,1"), "unreadable memory").ToEqual("E02")
+
+	Expect(t, c.send(t, "M2000,1:02"), "write to the cartridge registers").ToEqual("E02")
+	Expect(t, c.send(t, "M9ffe,4:01020304"), "write across VRAM and cartridge RAM").ToEqual("E02")
+	Expect(t, c.send(t, "Mfe9f,2:0102"), "write across OAM and the unusable region").ToEqual("E02")
+	Expect(t, c.send(t, "Mfffe,2:0102"), "write across HRAM and IE").ToEqual("E02")
+	Expect(t, c.send(t, "Mffff,2:0102"), "write past the end of the memory map").ToEqual("E02")
+	Expect(t, c.send(t, "Mffff,0:"), "empty write").ToEqual("E02")
+	Expect(t, c.send(t, "Mffff,1:1f"), "write to IE").ToEqual("OK")
+	Expect(t, c.send(t, "mffff,1"), "read IE").ToEqual("1f")
+
+	Expect(t, c.send(t, "qXfer:features:read:target.xml:0,5"), "target description").ToEqual("m<?xml")
+	Expect(t, c.send(t, "vMustReplyEmpty"), "unsupported packet").ToEqual("")
+}
+
+func TestBreakpointsAndStepping(t *testing.T) {
+	c, server := startSession(t,
+		0x06, 0x03, // LD B $03
+		0x05,       // DEC B
+		0x20, 0xFD, // JR NZ $0002
+		0x3E, 0x42, // LD A $42
+		0xE0, 0x80, // LDH ($FF80), A
+		0x20, 0xFE, // JR NZ $0009
+	)
+
+	Expect(t, c.send(t, "s"), "step").ToEqual("S05")
+	Expect(t, server.cpu.PC, "PC after a step").ToEqual(uint16(0x0002))
+
+	Expect(t, c.send(t, "Z0,5,1"), "breakpoint").ToEqual("OK")
+	Expect(t, c.send(t, "c"), "continue to the breakpoint").ToEqual("T05swbreak:;")
+	Expect(t, server.cpu.PC, "PC at the breakpoint").ToEqual(uint16(0x0005))
+	Expect(t, c.send(t, "z0,5,1"), "remove the breakpoint").ToEqual("OK")
+
+	Expect(t, c.send(t, "Z2,ff80,1"), "watchpoint").ToEqual("OK")
+	Expect(t, c.send(t, "c"), "continue to the write").ToEqual(fmt.Sprintf("T05watch:%04x;", 0xFF80))
+	Expect(t, server.cpu.PC, "PC after the write").ToEqual(uint16(0x0009))
+	Expect(t, c.send(t, "?"), "last stop").ToEqual("T05watch:ff80;")
+
+	Expect(t, c.send(t, "D"), "detach").ToEqual("OK")
+}
+
+func TestReadWatchpoint(t *testing.T) {
+	c, server := startSession(t,
+		0x11, 0x00, 0xC0, // LD DE $C000
+		0x1A,       // LD A [DE]
+		0x20, 0xFE, // JR NZ $0004
+	)
+
+	Expect(t, c.send(t, "Z3,c000,1"), "read watchpoint").ToEqual("OK")
+	Expect(t, c.send(t, "c"), "continue to the read").ToEqual("T05rwatch:c000;")
+	Expect(t, server.cpu.PC, "PC after the read").ToEqual(uint16(0x0004))
+
+	Expect(t, c.send(t, "z3,c000,1"), "remove the watchpoint").ToEqual("OK")
+	Expect(t, len(server.bus.Watchpoints()), "bus watchpoints").ToEqual(0)
+}
@@ -0,0 +1,24 @@
+package gdb
+
+// targetDescription describes the SM83 registers, GDB has no SM83 architecture so it is announced
+// as the z80 family it derives from, with only the registers the SM83 has
+const targetDescription = `<?xml version="1.0"?>
+<!DOCTYPE target SYSTEM "gdb-target.dtd">
+<target version="1.0">
+  <architecture>z80</architecture>
+  <feature name="org.gnu.gdb.z80.cpu">
+    <flags id="af_flags" size="2">
+      <field name="C" start="4" end="4"/>
+      <field name="H" start="5" end="5"/>
+      <field name="N" start="6" end="6"/>
+      <field name="Z" start="7" end="7"/>
+    </flags>
+    <reg name="af" bitsize="16" type="af_flags" regnum="0"/>
+    <reg name="bc" bitsize="16" type="uint16"/>
+    <reg name="de" bitsize="16" type="data_ptr"/>
+    <reg name="hl" bitsize="16" type="data_ptr"/>
+    <reg name="sp" bitsize="16" type="data_ptr"/>
+    <reg name="pc" bitsize="16" type="code_ptr"/>
+  </feature>
+</target>
+`
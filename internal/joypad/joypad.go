@@ -0,0 +1,139 @@
+package joypad
+
+// P1 is the joypad register, bits 4 and 5 select the directions / buttons group, bits 0-3 report them (0 = pressed)
+const P1 uint16 = 0xFF00
+
+// Button is one of the 8 Game Boy keys, the first 4 are read through P1 when bit 4 is cleared, the others when bit 5 is
+type Button byte
+
+const (
+	RIGHT Button = iota
+	LEFT
+	UP
+	DOWN
+	A
+	B
+	SELECT
+	START
+)
+
+const (
+	selectDirections byte = 0x10
+	selectButtons    byte = 0x20
+
+	maxPlayers = 4
+)
+
+// Joypad holds the state of the keys of up to 4 players (SGB multiplayer) and the P1 register
+type Joypad struct {
+	selection        byte
+	pressed          [maxPlayers]byte // bitmask of pressed buttons for each player, indexed by Button
+	players          int
+	currentPlayer    int
+	interruptRequest func()
+}
+
+func New() *Joypad {
+	return &Joypad{selection: 0x30, players: 1}
+}
+
+// OnInterrupt registers a function called when a key press requests the joypad interrupt
+func (j *Joypad) OnInterrupt(listener func()) {
+	j.interruptRequest = listener
+}
+
+// Press presses a key of the given player (0 - 3), other players are ignored
+func (j *Joypad) Press(player int, button Button) {
+	if !validPlayer(player) {
+		return
+	}
+
+	mask := byte(1) << button
+	wasPressed := j.pressed[player]&mask != 0
+	j.pressed[player] |= mask
+
+	if !wasPressed && player == j.currentPlayer && j.selected(button) && j.interruptRequest != nil {
+		j.interruptRequest()
+	}
+}
+
+// Release releases a key of the given player (0 - 3), other players are ignored
+func (j *Joypad) Release(player int, button Button) {
+	if !validPlayer(player) {
+		return
+	}
+
+	j.pressed[player] &^= byte(1) << button
+}
+
+// Pressed returns the bitmask of pressed keys of a player, indexed by Button, none for players other than 0 - 3
+func (j *Joypad) Pressed(player int) byte {
+	if !validPlayer(player) {
+		return 0
+	}
+
+	return j.pressed[player]
+}
+
+// SetPressed replaces the whole key state of a player with a bitmask indexed by Button
+func (j *Joypad) SetPressed(player int, pressed byte) {
+	for button := RIGHT; button <= START; button++ {
+		if pressed&(1<<button) != 0 {
+			j.Press(player, button)
+		} else {
+			j.Release(player, button)
+		}
+	}
+}
+
+// validPlayer reports if player is one of the 4 controllers
+func validPlayer(player int) bool {
+	return player >= 0 && player < maxPlayers
+}
+
+// SetPlayers sets the number of connected controllers (1, 2 or 4), as requested by the SGB MLT_REQ command
+func (j *Joypad) SetPlayers(players int) {
+	j.players = players
+	j.currentPlayer = 0
+}
+
+// selected reports if the group of a key is currently selected through P1
+func (j *Joypad) selected(button Button) bool {
+	if button < A {
+		return j.selection&selectDirections == 0
+	}
+
+	return j.selection&selectButtons == 0
+}
+
+// Read returns the value of P1 for the current player
+func (j *Joypad) Read() byte {
+	value := 0xC0 | j.selection | 0x0F
+	pressed := j.pressed[j.currentPlayer]
+
+	// with multiplayer enabled and no group selected the lower nibble reports the current controller
+	if j.players > 1 && j.selection == 0x30 {
+		return value &^ byte(j.currentPlayer)
+	}
+
+	if j.selection&selectDirections == 0 {
+		value &^= pressed & 0x0F
+	}
+
+	if j.selection&selectButtons == 0 {
+		value &^= pressed >> 4
+	}
+
+	return value
+}
+
+// Write selects the group of keys reported by P1, in multiplayer mode
+// deselecting the buttons group switches to the next controller
+func (j *Joypad) Write(value byte) {
+	previous := j.selection
+	j.selection = value & 0x30
+
+	if j.players > 1 && previous&selectButtons == 0 && j.selection&selectButtons != 0 {
+		j.currentPlayer = (j.currentPlayer + 1) % j.players
+	}
+}
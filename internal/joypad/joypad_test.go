@@ -0,0 +1,22 @@
+package joypad
+
+import (
+	"testing"
+
+	. "github.com/carvhal/gby/internal/testutils"
+)
+
+func TestInvalidPlayer(t *testing.T) {
+	j := New()
+
+	for _, player := range []int{-1, maxPlayers} {
+		j.Press(player, START)
+		j.Release(player, START)
+		j.SetPressed(player, 0xFF)
+
+		Expect(t, j.Pressed(player), "Expected no key pressed for an invalid player").ToEqual(byte(0))
+	}
+
+	j.Write(0x10)
+	Expect(t, j.Read(), "Expected the keys of player 0 left alone").ToEqual(byte(0xDF))
+}
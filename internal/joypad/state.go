@@ -0,0 +1,34 @@
+package joypad
+
+import (
+	"fmt"
+
+	"github.com/carvhal/gby/internal/common"
+)
+
+// SaveState returns the P1 selection, the pressed keys and the SGB multiplayer state
+func (j *Joypad) SaveState() []byte {
+	var state common.StateEncoder
+	state.Byte(j.selection)
+	state.Bytes(j.pressed[:])
+	state.Int(j.players)
+	state.Int(j.currentPlayer)
+
+	return state.Data
+}
+
+// LoadState restores a state returned by SaveState
+func (j *Joypad) LoadState(data []byte) error {
+	state := common.StateDecoder{Data: data}
+	j.selection = state.Byte()
+	state.Bytes(j.pressed[:])
+	j.players = state.Int()
+	j.currentPlayer = state.Int()
+
+	if j.players < 1 || j.players > maxPlayers || j.currentPlayer < 0 || j.currentPlayer >= j.players {
+		j.players, j.currentPlayer = 1, 0
+		return fmt.Errorf("joypad: invalid player %d of %d in save state", j.currentPlayer, j.players)
+	}
+
+	return state.Err("joypad")
+}
@@ -0,0 +1,66 @@
+package machine
+
+import (
+	"image"
+
+	"github.com/carvhal/gby/internal/cpu"
+	"github.com/carvhal/gby/internal/memory"
+)
+
+const (
+	CPU_CLOCK        = 4194304 // CPU cycles per second at normal speed
+	CYCLES_PER_FRAME = 70224   // CPU cycles of a frame at normal speed
+)
+
+// RunFrame runs the machine until the PPU enters VBlank, or for the cycles of a frame while the LCD is off,
+// it returns the CPU cycles run, DMA stalls included
+func RunFrame(c *cpu.CPU, bus *memory.Controller) (int, error) {
+	cycles, _, err := RunFrameUntil(c, bus, nil)
+	return cycles, err
+}
+
+// RunFrameUntil is RunFrame stopping before an instruction when stop returns true, it reports whether it did
+func RunFrameUntil(c *cpu.CPU, bus *memory.Controller, stop func() bool) (int, bool, error) {
+	frames := bus.PPU().Frames()
+
+	budget := CYCLES_PER_FRAME
+	if bus.DoubleSpeed() {
+		budget *= 2
+	}
+
+	elapsed := 0
+	for elapsed < budget && bus.PPU().Frames() == frames {
+		if stop != nil && stop() {
+			return elapsed, true, nil
+		}
+
+		cycles, err := c.Tick()
+		if err != nil {
+			return elapsed, false, err
+		}
+
+		elapsed += cycles + bus.Step(cycles)
+	}
+
+	return elapsed, false, nil
+}
+
+// SkipBoot sets the registers the boot ROM leaves the CPU with, so the cartridge runs from its entry point (0x0100)
+func SkipBoot(c *cpu.CPU, bus *memory.Controller) {
+	c.A, c.F, c.B, c.C, c.D, c.E, c.H, c.L = 0x01, 0xB0, 0x00, 0x13, 0x00, 0xD8, 0x01, 0x4D
+	if bus.PPU().CGB() {
+		c.A, c.F, c.B, c.C, c.D, c.E, c.H, c.L = 0x11, 0x80, 0x00, 0x00, 0xFF, 0x56, 0x00, 0x0D
+	}
+
+	c.SetSP(0xFFFE)
+	c.PC = 0x0100
+}
+
+// Screen returns the last frame displayed, with the border in SGB mode
+func Screen(bus *memory.Controller) image.Image {
+	if bus.SGB() != nil {
+		return bus.SGB().Framebuffer()
+	}
+
+	return bus.PPU().Framebuffer()
+}
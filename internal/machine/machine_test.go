@@ -0,0 +1,38 @@
+package machine
+
+import (
+	"testing"
+
+	"github.com/carvhal/gby/internal/cpu"
+	"github.com/carvhal/gby/internal/memory"
+	. "github.com/carvhal/gby/internal/testutils"
+	"github.com/carvhal/gby/internal/testutils/testmachine"
+)
+
+func newMachine(program ...byte) (*cpu.CPU, *memory.Controller) {
+	return testmachine.New(testmachine.ROM(0x0000, program...))
+}
+
+func TestRunFrame(t *testing.T) {
+	c, bus := newMachine(0x20, 0xFE) // JR NZ $0000
+
+	for i := 0; i < 3; i++ {
+		_, err := RunFrame(c, bus)
+		Must(t, err, "Expected no error running a frame: %v")
+	}
+	Expect(t, bus.PPU().Frames(), "frames").ToEqual(uint64(3))
+
+	c, bus = newMachine(
+		0xAF,       // XOR A, A
+		0xE0, 0x40, // LDH [$FF40], A
+		0x0C,       // INC C
+		0x20, 0xFD, // JR NZ $0003
+		0x0C,       // INC C
+		0x20, 0xFA, // JR NZ $0003
+	)
+
+	cycles, err := RunFrame(c, bus)
+	Must(t, err, "Expected no error running a frame with the LCD off: %v")
+	Expect(t, cycles >= CYCLES_PER_FRAME, "frame with the LCD off lasts a frame of cycles").ToEqual(true)
+	Expect(t, bus.PPU().Frames(), "frames").ToEqual(uint64(0))
+}
@@ -0,0 +1,30 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/carvhal/gby/internal/cartridge"
+	. "github.com/carvhal/gby/internal/testutils"
+)
+
+func TestMBC7Selection(t *testing.T) {
+	rom := make([]byte, 0x10000)
+	rom[0x0147] = cartridge.MBC7_SENSOR
+	for bank := 0; bank < 4; bank++ {
+		rom[bank*0x4000+0x10] = byte(bank)
+	}
+
+	c := NewController(rom)
+	Expect(t, isMBC7(c.Mapper()), "Expected the MBC7 to be selected by the header").ToEqual(true)
+
+	Must(t, c.WriteToAddress(0x2000, []byte{0x03}), "Expected no error switching ROM bank: %v")
+
+	bytes, err := c.ReadFromAddress(0x4010, 1)
+	Must(t, err, "Expected no error reading switchable ROM: %v")
+	Expect(t, bytes[0], "Expected the switched bank to be mapped at 0x4000").ToEqual(byte(3))
+}
+
+func isMBC7(mapper cartridge.Mapper) bool {
+	_, ok := mapper.(*cartridge.MBC7)
+	return ok
+}
@@ -0,0 +1,44 @@
+package memory
+
+import "fmt"
+
+// BusError is an access to an address the bus does not map
+type BusError struct {
+	Address uint16
+	Access  Access // ACCESS_READ or ACCESS_WRITE
+	Region  string // region of the memory map of Address
+}
+
+func (e *BusError) Error() string {
+	return fmt.Sprintf("illegal %s at 0x%04X (%s)", e.Access, e.Address, e.Region)
+}
+
+// Region returns the name of the region of the memory map address is in
+func Region(address uint16) string {
+	switch {
+	case address <= 0x7FFF:
+		return "cartridge ROM"
+	case address <= 0x9FFF:
+		return "VRAM"
+	case address <= 0xBFFF:
+		return "cartridge RAM"
+	case address <= 0xDFFF:
+		return "work RAM"
+	case address <= 0xFDFF:
+		return "echo RAM"
+	case address <= 0xFE9F:
+		return "OAM"
+	case address <= 0xFEFF:
+		return "not usable"
+	case address <= 0xFF7F:
+		return "I/O registers"
+	case address <= 0xFFFE:
+		return "HRAM"
+	}
+
+	return "interrupt enable"
+}
+
+func busError(access Access, address uint16) error {
+	return &BusError{Address: address, Access: access, Region: Region(address)}
+}
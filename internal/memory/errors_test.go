@@ -0,0 +1,21 @@
+package memory
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/carvhal/gby/internal/testutils"
+)
+
+func TestBusError(t *testing.T) {
+	c := NewController(make([]byte, 0x8000))
+
+	_, err := c.ReadFromAddress(0xFEA0, 1)
+
+	var busError *BusError
+	Expect(t, errors.As(err, &busError), "error is a BusError").ToEqual(true)
+	Expect(t, busError.Address, "address").ToEqual(uint16(0xFEA0))
+	Expect(t, busError.Access, "access").ToEqual(ACCESS_READ)
+	Expect(t, busError.Region, "region").ToEqual("not usable")
+	Expect(t, err.Error(), "message").ToEqual("illegal read at 0xFEA0 (not usable)")
+}
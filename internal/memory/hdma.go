@@ -0,0 +1,120 @@
+package memory
+
+import "github.com/carvhal/gby/internal/ppu"
+
+// CGB VRAM DMA registers
+const (
+	HDMA1 uint16 = 0xFF51 // source, high byte
+	HDMA2 uint16 = 0xFF52 // source, low byte (lower 4 bits ignored)
+	HDMA3 uint16 = 0xFF53 // destination, high byte (upper 3 bits ignored)
+	HDMA4 uint16 = 0xFF54 // destination, low byte (lower 4 bits ignored)
+	HDMA5 uint16 = 0xFF55 // length / mode / start
+)
+
+const (
+	hdmaBlockSize = 16
+	hdmaBlockDots = 32 // a block takes 8 µs, the same number of dots in both speed modes
+)
+
+// hdma holds the state of the CGB VRAM DMA, used for both general purpose (GDMA) and HBlank (HDMA) transfers
+type hdma struct {
+	source      uint16
+	destination uint16 // relative to 0x8000
+	blocks      byte   // remaining 16 byte blocks minus one, as exposed in HDMA5
+	active      bool   // an HBlank transfer is in progress
+	finished    bool   // the last transfer completed, HDMA5 reads 0xFF
+}
+
+// readHDMA returns the value of a VRAM DMA register
+// HDMA1-HDMA4 are write only, HDMA5 reports the remaining length and whether an HBlank transfer is active
+func (c *Controller) readHDMA(address uint16) byte {
+	if address != HDMA5 {
+		return 0xFF
+	}
+
+	switch {
+	case c.hdma.active:
+		return c.hdma.blocks
+	case c.hdma.finished:
+		return 0xFF
+	}
+
+	// cancelled HBlank transfer
+	return 0x80 | c.hdma.blocks
+}
+
+// writeHDMA writes to a VRAM DMA register, writing HDMA5 starts or cancels a transfer
+func (c *Controller) writeHDMA(address uint16, value byte) {
+	switch address {
+	case HDMA1:
+		c.hdma.source = uint16(value)<<8 | c.hdma.source&0x00FF
+	case HDMA2:
+		c.hdma.source = c.hdma.source&0xFF00 | uint16(value&0xF0)
+	case HDMA3:
+		c.hdma.destination = uint16(value&0x1F)<<8 | c.hdma.destination&0x00FF
+	case HDMA4:
+		c.hdma.destination = c.hdma.destination&0xFF00 | uint16(value&0xF0)
+	case HDMA5:
+		c.startHDMA(value)
+	}
+}
+
+// startHDMA starts a general purpose or HBlank transfer, or cancels the active HBlank transfer
+func (c *Controller) startHDMA(value byte) {
+	hblank := value&0x80 != 0
+
+	if c.hdma.active && !hblank {
+		c.hdma.active = false
+		return
+	}
+
+	c.hdma.blocks = value & 0x7F
+	c.hdma.finished = false
+
+	if !hblank {
+		// general purpose DMA copies everything at once while the CPU is halted
+		for !c.hdma.finished {
+			c.transferHDMABlock()
+		}
+		return
+	}
+
+	c.hdma.active = true
+
+	// a transfer started during HBlank (or with the LCD off) copies its first block right away
+	if c.ppu.Mode() == ppu.HBLANK {
+		c.transferHDMABlock()
+	}
+}
+
+// onHBlank copies one block of the active HBlank transfer
+func (c *Controller) onHBlank() {
+	if c.hdma.active {
+		c.transferHDMABlock()
+	}
+}
+
+// transferHDMABlock copies 16 bytes to VRAM and halts the CPU for the duration of the copy
+func (c *Controller) transferHDMABlock() {
+	for i := uint16(0); i < hdmaBlockSize; i++ {
+		var value byte = 0xFF
+		if bytes, err := c.ReadFromAddress(c.hdma.source+i, 1); err == nil {
+			value = bytes[0]
+		}
+
+		c.ppu.WriteVRAM((c.hdma.destination+i)&0x1FFF, value)
+	}
+
+	c.hdma.source += hdmaBlockSize
+	c.hdma.destination = (c.hdma.destination + hdmaBlockSize) & 0x1FFF
+	c.stall += c.toCPUCycles(hdmaBlockDots)
+
+	if c.hdma.blocks == 0 || c.hdma.destination == 0 {
+		c.hdma.blocks = 0x7F
+		c.hdma.active = false
+		c.hdma.finished = true
+		return
+	}
+
+	c.hdma.blocks--
+}
@@ -0,0 +1,90 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/carvhal/gby/internal/ppu"
+	. "github.com/carvhal/gby/internal/testutils"
+)
+
+// cgbController returns a controller for a CGB cartridge with 0x100 bytes of work RAM counting from 0 as DMA source
+func cgbController(t *testing.T) *Controller {
+	rom := make([]byte, 0x8000)
+	rom[0x0143] = 0x80
+
+	c := NewController(rom)
+
+	for i := 0; i < 0x100; i++ {
+		Must(t, c.WriteToAddress(0xC000+uint16(i), []byte{byte(i)}), "Expected no error writing WRAM: %v")
+	}
+
+	// source 0xC000, destination 0x8000
+	c.WriteToAddress(HDMA1, []byte{0xC0, 0x00, 0x00, 0x00})
+
+	return c
+}
+
+func readVRAM(t *testing.T, c *Controller, address uint16) byte {
+	bytes, err := c.ReadFromAddress(address, 1)
+	Must(t, err, "Expected no error reading VRAM: %v")
+
+	return bytes[0]
+}
+
+func TestGeneralPurposeDMA(t *testing.T) {
+	tests := []struct {
+		name        string
+		doubleSpeed bool
+		stall       int
+	}{
+		{name: "normal speed", stall: 2 * hdmaBlockDots},
+		{name: "double speed", doubleSpeed: true, stall: 4 * hdmaBlockDots},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := cgbController(t)
+			c.doubleSpeed = test.doubleSpeed
+
+			// 2 blocks
+			c.WriteToAddress(HDMA5, []byte{0x01})
+
+			Expect(t, readVRAM(t, c, 0x8000), "first byte").ToEqual(byte(0x00))
+			Expect(t, readVRAM(t, c, 0x801F), "last byte").ToEqual(byte(0x1F))
+			Expect(t, readVRAM(t, c, 0x8020), "past the transfer").ToEqual(byte(0x00))
+
+			hdma5, _ := c.ReadFromAddress(HDMA5, 1)
+			Expect(t, hdma5[0], "HDMA5").ToEqual(byte(0xFF))
+			Expect(t, c.Step(0), "stalled cycles").ToEqual(test.stall)
+		})
+	}
+}
+
+func TestHBlankDMA(t *testing.T) {
+	c := cgbController(t)
+
+	// 3 blocks, the PPU is on line 0 OAM scan so nothing is copied yet
+	c.WriteToAddress(HDMA5, []byte{0x82})
+
+	hdma5, _ := c.ReadFromAddress(HDMA5, 1)
+	Expect(t, hdma5[0], "HDMA5 while active").ToEqual(byte(0x02))
+	Expect(t, readVRAM(t, c, 0x8001), "before HBlank").ToEqual(byte(0x00))
+
+	// run until the first HBlank
+	c.Step(80 + 172)
+
+	Expect(t, readVRAM(t, c, 0x800F), "first block").ToEqual(byte(0x0F))
+	Expect(t, readVRAM(t, c, 0x8010), "second block").ToEqual(byte(0x00))
+	Expect(t, c.ppu.Mode(), "mode").ToEqual(ppu.HBLANK)
+
+	hdma5, _ = c.ReadFromAddress(HDMA5, 1)
+	Expect(t, hdma5[0], "HDMA5 after one block").ToEqual(byte(0x01))
+
+	// cancel the transfer
+	c.WriteToAddress(HDMA5, []byte{0x00})
+	c.Step(456)
+
+	hdma5, _ = c.ReadFromAddress(HDMA5, 1)
+	Expect(t, hdma5[0], "HDMA5 after cancelling").ToEqual(byte(0x81))
+	Expect(t, readVRAM(t, c, 0x8010), "no transfer after cancelling").ToEqual(byte(0x00))
+}
@@ -0,0 +1,46 @@
+package memory
+
+import "math/bits"
+
+// interrupt registers, bits: 0 VBlank, 1 STAT, 2 timer, 3 serial, 4 joypad
+const (
+	IF uint16 = 0xFF0F
+	IE uint16 = 0xFFFF
+)
+
+const (
+	VBLANK_INTERRUPT byte = iota
+	STAT_INTERRUPT
+	TIMER_INTERRUPT
+	SERIAL_INTERRUPT
+	JOYPAD_INTERRUPT
+)
+
+// requestInterrupt sets the bit of an interrupt in IF
+func (c *Controller) requestInterrupt(interrupt byte) {
+	c.interruptFlag |= 1 << interrupt
+}
+
+// onPPUInterrupt handles the interrupts requested by the PPU, entering VBlank also completes an SGB frame
+func (c *Controller) onPPUInterrupt(interrupt byte) {
+	c.requestInterrupt(interrupt)
+
+	if interrupt == VBLANK_INTERRUPT && c.sgb != nil {
+		c.sgb.Frame(c.ppu.Shades())
+	}
+}
+
+// PendingInterrupt returns the highest priority interrupt both requested (IF) and enabled (IE)
+func (c *Controller) PendingInterrupt() (byte, bool) {
+	pending := c.interruptFlag & c.interruptEnable & 0x1F
+	if pending == 0 {
+		return 0, false
+	}
+
+	return byte(bits.TrailingZeros8(pending)), true
+}
+
+// AcknowledgeInterrupt clears the request of an interrupt dispatched by the CPU
+func (c *Controller) AcknowledgeInterrupt(interrupt byte) {
+	c.interruptFlag &^= 1 << interrupt
+}
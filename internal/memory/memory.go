@@ -1,7 +1,12 @@
 package memory
 
 import (
-	"fmt"
+	"hash/crc32"
+
+	"github.com/carvhal/gby/internal/cartridge"
+	"github.com/carvhal/gby/internal/joypad"
+	"github.com/carvhal/gby/internal/ppu"
+	"github.com/carvhal/gby/internal/sgb"
 )
 
 /*
@@ -23,22 +28,117 @@ import (
 *
  */
 
+// clocked is implemented by cartridges with hardware running on the CPU clock (camera captures, timers...)
+type clocked interface {
+	Step(cycles int)
+}
+
 // Controller is a struct that represents the memory controller/bus
 // it implements the MemoryReadWriter interface
 type Controller struct {
-	cartridge []byte
-	ram       []byte
-	vram      []byte
-	hram      []byte
+	mapper           cartridge.Mapper
+	checksum         uint32 // CRC32 of the ROM
+	ram              []byte
+	hram             []byte
+	ppu              *ppu.PPU
+	joypad           *joypad.Joypad
+	sgb              *sgb.SGB // nil unless SGB mode is enabled
+	cgb              bool
+	interruptFlag    byte
+	interruptEnable  byte
+	hdma             hdma
+	doubleSpeed      bool
+	speedSwitchArmed bool
+	stall            int // CPU cycles the CPU must stay halted for, because of DMA transfers
+	serial           Serial
+	watchpoints      []*Watchpoint
+	nextWatchpoint   int
+	pc               uint16       // address of the instruction being executed, reported by Execute
+	pause            *AccessEvent // watchpoint hit asking to pause, until TakePause
 }
 
 func NewController(game []byte) *Controller {
-	return &Controller{
-		cartridge: game,
-		vram:      make([]byte, 1024*8),
-		ram:       make([]byte, 1024*8),
-		hram:      make([]byte, 127),
+	cgb := isCGB(game)
+
+	c := &Controller{
+		mapper:   cartridge.New(game),
+		checksum: crc32.ChecksumIEEE(game),
+		ram:      make([]byte, 1024*8),
+		hram:     make([]byte, 127),
+		ppu:      ppu.NewPPU(cgb),
+		joypad:   joypad.New(),
+		cgb:      cgb,
+		hdma:     hdma{blocks: 0x7F, finished: true},
+	}
+
+	c.ppu.OnHBlank(c.onHBlank)
+	c.ppu.OnInterrupt(c.onPPUInterrupt)
+	c.joypad.OnInterrupt(func() { c.requestInterrupt(JOYPAD_INTERRUPT) })
+
+	return c
+}
+
+// EnableSGB switches the bus to Super Game Boy mode, decoding the command packets sent through P1
+// it is ignored for CGB cartridges, which always run in CGB mode
+func (c *Controller) EnableSGB() {
+	if !c.cgb {
+		c.sgb = sgb.New(c.joypad)
+	}
+}
+
+// SGB returns the Super Game Boy, nil unless SGB mode is enabled
+func (c *Controller) SGB() *sgb.SGB {
+	return c.sgb
+}
+
+// Joypad returns the joypad attached to the bus
+func (c *Controller) Joypad() *joypad.Joypad {
+	return c.joypad
+}
+
+// ButtonPressed reports if a button of a group selected through P1 is pressed, which wakes the CPU up from STOP
+func (c *Controller) ButtonPressed() bool {
+	value := c.joypad.Read()
+	return value&0x30 != 0x30 && value&0x0F != 0x0F
+}
+
+// Mapper returns the mapper of the cartridge plugged to the bus
+func (c *Controller) Mapper() cartridge.Mapper {
+	return c.mapper
+}
+
+// SetMapper replaces the mapper detected from the ROM, to force a banking scheme
+func (c *Controller) SetMapper(mapper cartridge.Mapper) {
+	c.mapper = mapper
+}
+
+// ROMChecksum returns the CRC32 of the ROM the bus was created with
+func (c *Controller) ROMChecksum() uint32 {
+	return c.checksum
+}
+
+// ROMBank returns the ROM bank mapped at address (0x0000 - 0x7FFF), mappers that cannot tell are assumed
+// to map bank 0 then bank 1, the other addresses are in bank 0
+func (c *Controller) ROMBank(address uint16) int {
+	if address > 0x7FFF {
+		return 0
+	}
+
+	if banked, ok := c.mapper.(cartridge.Banked); ok {
+		return banked.ROMBank(address)
 	}
+
+	return int(address) / 0x4000
+}
+
+// PPU returns the picture processing unit attached to the bus
+func (c *Controller) PPU() *ppu.PPU {
+	return c.ppu
+}
+
+// isCGB checks the CGB flag of the cartridge header (0x0143)
+func isCGB(game []byte) bool {
+	return len(game) > 0x0143 && game[0x0143]&0x80 != 0
 }
 
 func toRAMSpace(address uint16) uint16 {
@@ -53,64 +153,187 @@ func toHRAMSpace(address uint16) uint16 {
 	return address - 0xFF80
 }
 
+func toOAMSpace(address uint16) uint16 {
+	return address - 0xFE00
+}
+
+// readIO reads the I/O register at address
+func (c *Controller) readIO(address uint16) (byte, error) {
+	if value, ok := c.ppu.ReadRegister(address); ok {
+		return value, nil
+	}
+
+	switch {
+	case address == joypad.P1:
+		return c.joypad.Read(), nil
+	case address == SB:
+		return c.serial.data, nil
+	case address == SC:
+		return c.readSC(), nil
+	case address == IF:
+		return 0xE0 | c.interruptFlag, nil
+	case c.cgb && address == KEY1:
+		return c.readKEY1(), nil
+	case c.cgb && address >= HDMA1 && address <= HDMA5:
+		return c.readHDMA(address), nil
+	}
+
+	return 0, busError(ACCESS_READ, address)
+}
+
+// writeIO writes to the I/O register at address, unhandled registers are ignored
+func (c *Controller) writeIO(address uint16, value byte) {
+	if c.ppu.WriteRegister(address, value) {
+		return
+	}
+
+	switch {
+	case address == joypad.P1:
+		c.joypad.Write(value)
+		if c.sgb != nil {
+			c.sgb.WriteP1(value)
+		}
+	case address == SB:
+		c.serial.data = value
+	case address == SC:
+		c.writeSC(value)
+	case address == IF:
+		c.interruptFlag = value & 0x1F
+	case c.cgb && address == KEY1:
+		c.speedSwitchArmed = value&0x01 != 0
+	case c.cgb && address >= HDMA1 && address <= HDMA5:
+		c.writeHDMA(address, value)
+	}
+}
+
 func (c *Controller) ReadFromAddress(address uint16, ammount int) ([]byte, error) {
+	result, err := c.Peek(address, ammount)
+	if err == nil && len(c.watchpoints) > 0 {
+		c.checkWatchpoints(ACCESS_READ, address, result)
+	}
+
+	return result, err
+}
+
+func (c *Controller) WriteToAddress(address uint16, bytes []byte) error {
+	if len(c.watchpoints) > 0 {
+		c.checkWatchpoints(ACCESS_WRITE, address, bytes)
+	}
+
+	return c.Poke(address, bytes)
+}
+
+// Peek reads memory like the CPU does, without triggering watchpoints
+func (c *Controller) Peek(address uint16, ammount int) ([]byte, error) {
+	result := make([]byte, ammount)
+	for i := range result {
+		value, err := c.peekByte(address + uint16(i))
+		if err != nil {
+			return nil, err
+		}
+		result[i] = value
+	}
+
+	return result, nil
+}
+
+// Poke writes memory like the CPU does, without triggering watchpoints.
+// Nothing is written when a byte falls outside the memory map
+func (c *Controller) Poke(address uint16, bytes []byte) error {
+	for i := range bytes {
+		if isEchoRAM(address + uint16(i)) {
+			return busError(ACCESS_WRITE, address+uint16(i))
+		}
+	}
+
+	for i, value := range bytes {
+		c.pokeByte(address+uint16(i), value)
+	}
+
+	return nil
+}
+
+func isEchoRAM(address uint16) bool {
+	return address >= 0xE000 && address <= 0xFDFF
+}
+
+func (c *Controller) peekByte(address uint16) (byte, error) {
 	switch {
 
-	// cartridge
-	case address <= 0x3FFF:
-		return c.cartridge[address : address+uint16(ammount)], nil
+	// cartridge ROM
+	case address <= 0x7FFF:
+		return c.mapper.ReadROM(address), nil
+
+	// cartridge RAM
+	case address >= 0xA000 && address <= 0xBFFF:
+		return c.mapper.ReadRAM(address), nil
 
 	// VRAM
 	case address >= 0x8000 && address <= 0x9FFF:
-		mappedAddress := toVRAMSpace(address)
-		return c.vram[mappedAddress : mappedAddress+uint16(ammount)], nil
+		return c.ppu.ReadVRAM(toVRAMSpace(address)), nil
 
 	// work RAM
 	case address >= 0xC000 && address <= 0xDFFF:
-		mappedAddress := toRAMSpace(address)
-		return c.ram[mappedAddress : mappedAddress+uint16(ammount)], nil
+		return c.ram[toRAMSpace(address)], nil
 
 	// HRAM
 	case address >= 0xFF80 && address <= 0xFFFE:
-		mappedAddress := toHRAMSpace(address)
-		return c.hram[mappedAddress : mappedAddress+uint16(ammount)], nil
+		return c.hram[toHRAMSpace(address)], nil
+
+	// interrupt enable
+	case address == IE:
+		return c.interruptEnable, nil
+
+	// OAM
+	case address >= 0xFE00 && address <= 0xFE9F:
+		return c.ppu.ReadOAM(toOAMSpace(address)), nil
+
+	// IO
+	case address >= 0xFF00 && address <= 0xFF7F:
+		return c.readIO(address)
 
 	}
 
-	return nil, fmt.Errorf("Illegal read at 0x%X", address)
+	return 0, busError(ACCESS_READ, address)
 }
 
-func (c *Controller) WriteToAddress(address uint16, bytes []byte) error {
-
+// pokeByte writes a byte, address is never in echo RAM
+func (c *Controller) pokeByte(address uint16, value byte) {
 	switch {
 
-	// cartridge
-	case address <= 0x3FFF:
-		return fmt.Errorf("write to ROM (index 0x%X)", address)
+	// cartridge registers
+	case address <= 0x7FFF:
+		c.mapper.WriteRegister(address, value)
+
+	// cartridge RAM
+	case address >= 0xA000 && address <= 0xBFFF:
+		c.mapper.WriteRAM(address, value)
 
 	// VRAM
 	case address >= 0x8000 && address <= 0x9FFF:
-		mappedAddress := toVRAMSpace(address)
-		copy(c.vram[mappedAddress:], bytes)
-		return nil
+		c.ppu.WriteVRAM(toVRAMSpace(address), value)
 
 	// work RAM
 	case address >= 0xC000 && address <= 0xDFFF:
-		mappedAddress := toRAMSpace(address)
-		copy(c.ram[mappedAddress:], bytes)
-		return nil
+		c.ram[toRAMSpace(address)] = value
 
 	// HRAM
 	case address >= 0xFF80 && address <= 0xFFFE:
-		mappedAddress := toHRAMSpace(address)
-		copy(c.hram[mappedAddress:], bytes)
-		return nil
+		c.hram[toHRAMSpace(address)] = value
+
+	// interrupt enable
+	case address == IE:
+		c.interruptEnable = value
+
+	// OAM
+	case address >= 0xFE00 && address <= 0xFE9F:
+		c.ppu.WriteOAM(toOAMSpace(address), value)
 
 	// IO
-	case address >= 0xFE00 && address <= 0xFF7F:
-		// TODO
-		return nil
-	}
+	case address >= 0xFF00 && address <= 0xFF7F:
+		c.writeIO(address, value)
 
-	return fmt.Errorf("Illegal write at 0x%X", address)
+	// not usable, writes are ignored
+	case address >= 0xFEA0 && address <= 0xFEFF:
+	}
 }
@@ -0,0 +1,44 @@
+package memory
+
+import (
+	"testing"
+
+	. "github.com/carvhal/gby/internal/testutils"
+)
+
+func TestAccessAcrossRegions(t *testing.T) {
+	tests := []struct {
+		address uint16
+		bytes   []byte
+	}{
+		{0xDFFF, []byte{0x01, 0x02}}, // work RAM, then echo RAM
+		{0xFE9F, []byte{0x01, 0x02}}, // OAM, then not usable
+		{0xFFFE, []byte{0x01, 0x02}}, // HRAM, then interrupt enable
+		{0xFFFF, []byte{0x01, 0x02}}, // interrupt enable, then cartridge ROM
+		{0x9FFF, []byte{0x01, 0x02}}, // VRAM, then cartridge RAM
+		{0xFFFF, []byte{}},
+	}
+
+	for _, test := range tests {
+		c := NewController(make([]byte, 0x8000))
+
+		c.Poke(test.address, test.bytes)
+		c.Peek(test.address, len(test.bytes)+1)
+	}
+
+	c := NewController(make([]byte, 0x8000))
+
+	Expect(t, c.Poke(0xDFFF, []byte{0x01, 0x02}) != nil, "Expected an error writing into echo RAM").ToEqual(true)
+	bytes, err := c.Peek(0xDFFF, 1)
+	Must(t, err, "Expected no error reading work RAM: %v")
+	Expect(t, bytes[0], "Expected nothing written by a rejected write").ToEqual(byte(0x00))
+
+	Must(t, c.Poke(0xFFFE, []byte{0x01, 0x02}), "Expected no error writing HRAM and IE: %v")
+	bytes, err = c.Peek(0xFFFE, 2)
+	Must(t, err, "Expected no error reading HRAM and IE: %v")
+	Expect(t, bytes, "Expected the write to reach both HRAM and IE").ToEqual([]byte{0x01, 0x02})
+
+	Must(t, c.Poke(0xFE9F, []byte{0x01, 0x02}), "Expected no error writing OAM and the unusable region: %v")
+	_, err = c.Peek(0xFE9F, 2)
+	Expect(t, err != nil, "Expected an error reading the unusable region").ToEqual(true)
+}
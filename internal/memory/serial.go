@@ -0,0 +1,79 @@
+package memory
+
+// serial registers, SC bit 7 starts a transfer, bit 0 selects the internal clock and bit 1 the CGB fast clock
+const (
+	SB uint16 = 0xFF01
+	SC uint16 = 0xFF02
+)
+
+// CPU cycles to shift the 8 bits of SB out with the internal clock, 8192 Hz or 262144 Hz with the CGB fast clock
+const (
+	SERIAL_TRANSFER_CYCLES      = 4096
+	SERIAL_FAST_TRANSFER_CYCLES = 128
+)
+
+// Serial is the link port, nothing is ever plugged in so the bits received are all 1
+type Serial struct {
+	data     byte // SB
+	control  byte // SC
+	cycles   int  // CPU cycles left before the transfer in progress completes
+	listener func(value byte)
+}
+
+// Serial returns the link port, which saves its own state
+func (c *Controller) Serial() *Serial {
+	return &c.serial
+}
+
+// OnSerial registers a function called with every byte sent through the link port
+func (c *Controller) OnSerial(listener func(value byte)) {
+	c.serial.listener = listener
+}
+
+// readSC returns SC with its unused bits set
+func (c *Controller) readSC() byte {
+	if c.cgb {
+		return c.serial.control | 0x7C
+	}
+
+	return c.serial.control | 0x7E
+}
+
+// writeSC starts a transfer when bit 7 is set with the internal clock, transfers on an external clock wait forever
+func (c *Controller) writeSC(value byte) {
+	c.serial.control = value & 0x81
+	if c.cgb {
+		c.serial.control = value & 0x83
+	}
+
+	c.serial.cycles = 0
+	if value&0x81 != 0x81 {
+		return
+	}
+
+	c.serial.cycles = SERIAL_TRANSFER_CYCLES
+	if c.cgb && value&0x02 != 0 {
+		c.serial.cycles = SERIAL_FAST_TRANSFER_CYCLES
+	}
+}
+
+// stepSerial advances the transfer in progress by the CPU cycles executed, the clock follows the CPU speed
+func (c *Controller) stepSerial(cycles int) {
+	if c.serial.cycles <= 0 {
+		return
+	}
+
+	if c.serial.cycles -= cycles; c.serial.cycles > 0 {
+		return
+	}
+
+	sent := c.serial.data
+	c.serial.data = 0xFF
+	c.serial.control &^= 0x80
+	c.serial.cycles = 0
+	c.requestInterrupt(SERIAL_INTERRUPT)
+
+	if c.serial.listener != nil {
+		c.serial.listener(sent)
+	}
+}
@@ -0,0 +1,46 @@
+package memory
+
+import (
+	"testing"
+
+	. "github.com/carvhal/gby/internal/testutils"
+)
+
+func TestSerialTransfer(t *testing.T) {
+	c := NewController(make([]byte, 0x8000))
+
+	var sent []byte
+	c.OnSerial(func(value byte) { sent = append(sent, value) })
+
+	Must(t, c.WriteToAddress(SB, []byte{'P', 0x81}), "Expected no error starting a transfer: %v")
+
+	c.Step(SERIAL_TRANSFER_CYCLES - 4)
+	Expect(t, len(sent), "bytes sent before the end of the transfer").ToEqual(0)
+
+	c.Step(4)
+	Expect(t, sent, "bytes sent").ToEqual([]byte{'P'})
+
+	registers, err := c.ReadFromAddress(SB, 2)
+	Must(t, err, "Expected no error reading the serial registers: %v")
+	Expect(t, registers, "SB receives 0xFF, SC transfer bit cleared").ToEqual([]byte{0xFF, 0x7F})
+	Expect(t, c.interruptFlag&(1<<SERIAL_INTERRUPT) != 0, "serial interrupt requested").ToEqual(true)
+
+	// an external clock never ticks without a link partner
+	Must(t, c.WriteToAddress(SC, []byte{0x80}), "Expected no error starting a transfer: %v")
+	c.Step(2 * SERIAL_TRANSFER_CYCLES)
+	Expect(t, len(sent), "bytes sent with the external clock").ToEqual(1)
+}
+
+func TestSerialState(t *testing.T) {
+	c := NewController(make([]byte, 0x8000))
+	Must(t, c.WriteToAddress(SB, []byte{'P', 0x81}), "Expected no error starting a transfer: %v")
+	c.Step(SERIAL_TRANSFER_CYCLES / 2)
+
+	restored := NewController(make([]byte, 0x8000))
+	Must(t, restored.Serial().LoadState(c.Serial().SaveState()), "Expected no error loading the serial state: %v")
+
+	var sent []byte
+	restored.OnSerial(func(value byte) { sent = append(sent, value) })
+	restored.Step(SERIAL_TRANSFER_CYCLES / 2)
+	Expect(t, sent, "transfer completed after loading").ToEqual([]byte{'P'})
+}
@@ -0,0 +1,78 @@
+package memory
+
+// KEY1 is the CGB speed switch register, bit 0 arms the switch and bit 7 reports the current speed
+const KEY1 uint16 = 0xFF4D
+
+// readKEY1 returns the current speed and whether a switch is armed
+func (c *Controller) readKEY1() byte {
+	value := byte(0x7E)
+
+	if c.doubleSpeed {
+		value |= 0x80
+	}
+
+	if c.speedSwitchArmed {
+		value |= 0x01
+	}
+
+	return value
+}
+
+// SwitchSpeed toggles between normal and double speed if a switch was armed through KEY1,
+// it is meant to be called by the CPU when executing STOP and reports if the speed changed
+func (c *Controller) SwitchSpeed() bool {
+	if !c.speedSwitchArmed {
+		return false
+	}
+
+	c.speedSwitchArmed = false
+	c.doubleSpeed = !c.doubleSpeed
+
+	return true
+}
+
+// DoubleSpeed reports if the CGB is running in double speed mode
+func (c *Controller) DoubleSpeed() bool {
+	return c.doubleSpeed
+}
+
+// toCPUCycles converts dots into CPU clock cycles, the CPU runs twice as many cycles per dot in double speed
+func (c *Controller) toCPUCycles(dots int) int {
+	if c.doubleSpeed {
+		return dots * 2
+	}
+
+	return dots
+}
+
+// toDots converts CPU clock cycles into dots
+func (c *Controller) toDots(cycles int) int {
+	if c.doubleSpeed {
+		return cycles / 2
+	}
+
+	return cycles
+}
+
+// Step advances the devices attached to the bus by the CPU clock cycles just executed
+// it returns the extra CPU cycles the CPU was halted for by DMA transfers
+func (c *Controller) Step(cycles int) (stalled int) {
+	c.ppu.Step(c.toDots(cycles))
+
+	if clock, ok := c.mapper.(clocked); ok {
+		clock.Step(cycles)
+	}
+
+	c.stepSerial(cycles)
+
+	// the devices keep running while the CPU is halted, which may start new HBlank transfers
+	for c.stall > 0 {
+		pending := c.stall
+		c.stall = 0
+		stalled += pending
+
+		c.ppu.Step(c.toDots(pending))
+	}
+
+	return stalled
+}
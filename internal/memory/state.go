@@ -0,0 +1,62 @@
+package memory
+
+import "github.com/carvhal/gby/internal/common"
+
+// SaveState returns work RAM, HRAM, the interrupt, VRAM DMA and speed registers, for save states of the whole machine,
+// the devices attached to the bus save their own state
+func (c *Controller) SaveState() []byte {
+	var state common.StateEncoder
+	state.Bytes(c.ram)
+	state.Bytes(c.hram)
+	state.Byte(c.interruptFlag)
+	state.Byte(c.interruptEnable)
+	state.Uint16(c.hdma.source)
+	state.Uint16(c.hdma.destination)
+	state.Byte(c.hdma.blocks)
+	state.Bool(c.hdma.active)
+	state.Bool(c.hdma.finished)
+	state.Bool(c.doubleSpeed)
+	state.Bool(c.speedSwitchArmed)
+	state.Int(c.stall)
+
+	return state.Data
+}
+
+// LoadState restores a state returned by SaveState
+func (c *Controller) LoadState(data []byte) error {
+	state := common.StateDecoder{Data: data}
+	state.Bytes(c.ram)
+	state.Bytes(c.hram)
+	c.interruptFlag = state.Byte()
+	c.interruptEnable = state.Byte()
+	c.hdma.source = state.Uint16()
+	c.hdma.destination = state.Uint16()
+	c.hdma.blocks = state.Byte()
+	c.hdma.active = state.Bool()
+	c.hdma.finished = state.Bool()
+	c.doubleSpeed = state.Bool()
+	c.speedSwitchArmed = state.Bool()
+	c.stall = state.Int()
+
+	return state.Err("bus")
+}
+
+// SaveState returns SB, SC and the transfer in progress
+func (s *Serial) SaveState() []byte {
+	var state common.StateEncoder
+	state.Byte(s.data)
+	state.Byte(s.control)
+	state.Int(s.cycles)
+
+	return state.Data
+}
+
+// LoadState restores a state returned by SaveState
+func (s *Serial) LoadState(data []byte) error {
+	state := common.StateDecoder{Data: data}
+	s.data = state.Byte()
+	s.control = state.Byte()
+	s.cycles = state.Int()
+
+	return state.Err("serial")
+}
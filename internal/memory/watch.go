@@ -0,0 +1,144 @@
+package memory
+
+import "fmt"
+
+// Access is a kind of memory access, kinds can be combined to watch several of them
+type Access byte
+
+const (
+	ACCESS_READ Access = 1 << iota
+	ACCESS_WRITE
+	ACCESS_EXECUTE
+)
+
+func (a Access) String() string {
+	switch a {
+	case ACCESS_READ:
+		return "read"
+	case ACCESS_WRITE:
+		return "write"
+	case ACCESS_EXECUTE:
+		return "execute"
+	}
+
+	names := ""
+	for _, kind := range []Access{ACCESS_READ, ACCESS_WRITE, ACCESS_EXECUTE} {
+		if a&kind != 0 {
+			names += kind.String()[:1]
+		}
+	}
+
+	return names
+}
+
+// AccessEvent is an access that hit a watchpoint
+type AccessEvent struct {
+	Watchpoint int    // id of the watchpoint
+	Access     Access // a single kind
+	Address    uint16
+	Value      byte   // value read, written, or opcode executed
+	PC         uint16 // address of the instruction responsible for the access
+}
+
+func (e AccessEvent) String() string {
+	return fmt.Sprintf("%s of 0x%02X at 0x%04X by the instruction at 0x%04X", e.Access, e.Value, e.Address, e.PC)
+}
+
+// Watchpoint watches the accesses of a kind to a range of addresses
+type Watchpoint struct {
+	ID         int
+	Start, End uint16 // inclusive range
+	Access     Access
+	Condition  func(value byte) bool        // optional, the watchpoint only fires when it returns true
+	Callback   func(event AccessEvent) bool // optional, returns whether to pause, without one the watchpoint always pauses
+}
+
+// AddWatchpoint starts watching, the ID of the watchpoint is assigned and returned
+func (c *Controller) AddWatchpoint(w Watchpoint) int {
+	c.nextWatchpoint++
+	w.ID = c.nextWatchpoint
+	c.watchpoints = append(c.watchpoints, &w)
+
+	return w.ID
+}
+
+// RemoveWatchpoint stops watching, it reports whether the watchpoint existed
+func (c *Controller) RemoveWatchpoint(id int) bool {
+	for i, w := range c.watchpoints {
+		if w.ID == id {
+			c.watchpoints = append(c.watchpoints[:i], c.watchpoints[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// Watchpoints returns the active watchpoints
+func (c *Controller) Watchpoints() []Watchpoint {
+	watchpoints := make([]Watchpoint, len(c.watchpoints))
+	for i, w := range c.watchpoints {
+		watchpoints[i] = *w
+	}
+
+	return watchpoints
+}
+
+// Execute is called by the CPU before fetching the instruction at address,
+// it attributes the following accesses to the instruction
+func (c *Controller) Execute(address uint16) {
+	c.pc = address
+}
+
+// WatchExecute fires the execute watchpoints of the instruction at address, it is called before the instruction runs
+// so a pause stops on it, not after it
+func (c *Controller) WatchExecute(address uint16) {
+	if len(c.watchpoints) == 0 {
+		return
+	}
+
+	c.pc = address
+	opcode, err := c.Peek(address, 1)
+	if err == nil {
+		c.checkWatchpoints(ACCESS_EXECUTE, address, opcode)
+	}
+}
+
+// InstructionPC returns the address of the instruction being executed, as reported by Execute
+func (c *Controller) InstructionPC() uint16 {
+	return c.pc
+}
+
+// TakePause returns the access that asked to pause emulation since the last call, if any
+func (c *Controller) TakePause() (AccessEvent, bool) {
+	if c.pause == nil {
+		return AccessEvent{}, false
+	}
+
+	event := *c.pause
+	c.pause = nil
+
+	return event, true
+}
+
+// checkWatchpoints fires the watchpoints of an access of the values from address
+func (c *Controller) checkWatchpoints(access Access, address uint16, values []byte) {
+	for i, value := range values {
+		current := address + uint16(i)
+
+		for _, w := range c.watchpoints {
+			if w.Access&access == 0 || current < w.Start || current > w.End {
+				continue
+			}
+
+			if w.Condition != nil && !w.Condition(value) {
+				continue
+			}
+
+			event := AccessEvent{Watchpoint: w.ID, Access: access, Address: current, Value: value, PC: c.pc}
+			if (w.Callback == nil || w.Callback(event)) && c.pause == nil {
+				c.pause = &event
+			}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package memory
+
+import (
+	"testing"
+
+	. "github.com/carvhal/gby/internal/testutils"
+)
+
+func TestWatchpoints(t *testing.T) {
+	c := NewController(make([]byte, 0x8000))
+
+	var events []AccessEvent
+	record := func(event AccessEvent) bool {
+		events = append(events, event)
+		return false
+	}
+
+	writes := c.AddWatchpoint(Watchpoint{Start: 0xC000, End: 0xC0FF, Access: ACCESS_WRITE, Callback: record})
+	c.AddWatchpoint(Watchpoint{
+		Start: 0xC010, End: 0xC010, Access: ACCESS_READ,
+		Condition: func(value byte) bool { return value == 0x42 },
+	})
+
+	c.Execute(0x0150)
+	Must(t, c.WriteToAddress(0xC00F, []byte{0x01, 0x42}), "Expected no error writing: %v")
+	Must(t, c.WriteToAddress(0xC100, []byte{0x01}), "Expected no error writing: %v")
+
+	Expect(t, events, "writes in the range").ToEqual([]AccessEvent{
+		{Watchpoint: writes, Access: ACCESS_WRITE, Address: 0xC00F, Value: 0x01, PC: 0x0150},
+		{Watchpoint: writes, Access: ACCESS_WRITE, Address: 0xC010, Value: 0x42, PC: 0x0150},
+	})
+
+	_, paused := c.TakePause()
+	Expect(t, paused, "the callback did not ask to pause").ToEqual(false)
+
+	_, err := c.Peek(0xC010, 1)
+	Must(t, err, "Expected no error peeking: %v")
+	_, paused = c.TakePause()
+	Expect(t, paused, "peeking does not fire watchpoints").ToEqual(false)
+
+	c.Execute(0x0160)
+	_, err = c.ReadFromAddress(0xC010, 1)
+	Must(t, err, "Expected no error reading: %v")
+
+	event, paused := c.TakePause()
+	Expect(t, paused, "read matching the condition").ToEqual(true)
+	Expect(t, event.PC, "PC of the read").ToEqual(uint16(0x0160))
+
+	Expect(t, c.RemoveWatchpoint(writes), "removed").ToEqual(true)
+	Expect(t, len(c.Watchpoints()), "watchpoints left").ToEqual(1)
+}
+
+func TestExecuteWatchpoint(t *testing.T) {
+	c := NewController(make([]byte, 0x8000))
+	c.AddWatchpoint(Watchpoint{Start: 0x0100, End: 0x0100, Access: ACCESS_EXECUTE})
+
+	c.WatchExecute(0x00FF)
+	_, paused := c.TakePause()
+	Expect(t, paused, "other address").ToEqual(false)
+
+	c.WatchExecute(0x0100)
+	event, paused := c.TakePause()
+	Expect(t, paused, "watched address").ToEqual(true)
+	Expect(t, event.Access, "access").ToEqual(ACCESS_EXECUTE)
+	Expect(t, event.PC, "PC of the instruction").ToEqual(uint16(0x0100))
+
+	c.Execute(0x0100)
+	_, paused = c.TakePause()
+	Expect(t, paused, "running the instruction does not fire again").ToEqual(false)
+}
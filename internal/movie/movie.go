@@ -0,0 +1,273 @@
+package movie
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+* Movie file
+*
+* gby-movie 1
+* emulator 0.1.0
+* rom 1A2B3C4D
+* model dmg
+* boot skip
+* rtc 2024-01-01T00:00:00Z
+* frames
+* ........
+* ....A...
+* ....A... 0F1E2D3C
+*
+* the header gives the version of the emulator recording, the CRC32 of the ROM, the model (dmg, cgb or sgb),
+* how the machine boots (skip: without boot ROM) and the time the cartridge clock starts at,
+* then every line is a frame: the keys held during the frame, in the order RLUDABsS (right, left, up, down,
+* A, B, select, start) with . for a released key, optionally followed by the CRC32 of the frame displayed at its end
+*
+* text after # is ignored
+*
+ */
+
+// FORMAT_VERSION is the version of the movie format written, movies of newer formats are refused
+const FORMAT_VERSION = 1
+
+const magic = "gby-movie"
+
+// keyNames are the letters of the keys in the order of joypad.Button
+const keyNames = "RLUDABsS"
+
+// Model is the machine a movie runs on
+type Model string
+
+const (
+	MODEL_DMG Model = "dmg"
+	MODEL_CGB Model = "cgb"
+	MODEL_SGB Model = "sgb"
+)
+
+// BOOT_SKIP starts the machine without boot ROM, the only boot option supported
+const BOOT_SKIP = "skip"
+
+// Frame is the input of a frame and the hash of the frame displayed at its end
+type Frame struct {
+	Keys          byte // bitmask of the keys held, indexed by joypad.Button
+	Checkpoint    uint32
+	HasCheckpoint bool
+}
+
+// Movie is the input of every frame of a run and what it takes to replay it
+type Movie struct {
+	Emulator    string
+	ROMChecksum uint32
+	Model       Model
+	Boot        string
+	RTCStart    time.Time
+	Frames      []Frame
+}
+
+func formatKeys(keys byte) string {
+	text := []byte(keyNames)
+	for i := range text {
+		if keys&(1<<i) == 0 {
+			text[i] = '.'
+		}
+	}
+
+	return string(text)
+}
+
+func parseKeys(text string) (byte, error) {
+	if len(text) != len(keyNames) {
+		return 0, fmt.Errorf("expected %d keys, got %q", len(keyNames), text)
+	}
+
+	var keys byte
+	for i := range text {
+		switch text[i] {
+		case keyNames[i]:
+			keys |= 1 << i
+		case '.':
+		default:
+			return 0, fmt.Errorf("invalid key %q at %d, expected %q or .", text[i], i+1, keyNames[i])
+		}
+	}
+
+	return keys, nil
+}
+
+// Write writes the movie in the text format
+func (m *Movie) Write(w io.Writer) error {
+	out := bufio.NewWriter(w)
+
+	fmt.Fprintf(out, "%s %d\n", magic, FORMAT_VERSION)
+	fmt.Fprintf(out, "emulator %s\n", m.Emulator)
+	fmt.Fprintf(out, "rom %08X\n", m.ROMChecksum)
+	fmt.Fprintf(out, "model %s\n", m.Model)
+	fmt.Fprintf(out, "boot %s\n", m.Boot)
+	fmt.Fprintf(out, "rtc %s\n", m.RTCStart.UTC().Format(time.RFC3339))
+	fmt.Fprintln(out, "frames")
+
+	for _, frame := range m.Frames {
+		if frame.HasCheckpoint {
+			fmt.Fprintf(out, "%s %08X\n", formatKeys(frame.Keys), frame.Checkpoint)
+		} else {
+			fmt.Fprintln(out, formatKeys(frame.Keys))
+		}
+	}
+
+	return out.Flush()
+}
+
+// Parse reads a movie in the text format
+func Parse(r io.Reader) (*Movie, error) {
+	m := &Movie{}
+	inFrames := false
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if inFrames {
+			frame, err := parseFrame(fields)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			m.Frames = append(m.Frames, frame)
+			continue
+		}
+
+		if err := m.parseHeader(fields, seen); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		inFrames = fields[0] == "frames"
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, field := range []string{magic, "rom", "model", "boot", "rtc", "frames"} {
+		if !seen[field] {
+			return nil, fmt.Errorf("missing %s", field)
+		}
+	}
+
+	return m, nil
+}
+
+// parseHeader reads a line of the header
+func (m *Movie) parseHeader(fields []string, seen map[string]bool) error {
+	name := fields[0]
+	if len(seen) == 0 && name != magic {
+		return errors.New("not a movie")
+	}
+
+	if name == "frames" {
+		seen[name] = true
+		return nil
+	}
+
+	if len(fields) != 2 {
+		return fmt.Errorf("expected %s <value>", name)
+	}
+	value := fields[1]
+
+	switch name {
+	case magic:
+		version, err := strconv.Atoi(value)
+		if err != nil || version > FORMAT_VERSION {
+			return fmt.Errorf("unsupported movie format %q", value)
+		}
+	case "emulator":
+		m.Emulator = value
+	case "rom":
+		checksum, err := strconv.ParseUint(value, 16, 32)
+		if err != nil {
+			return fmt.Errorf("invalid ROM CRC32 %q", value)
+		}
+		m.ROMChecksum = uint32(checksum)
+	case "model":
+		m.Model = Model(value)
+		if m.Model != MODEL_DMG && m.Model != MODEL_CGB && m.Model != MODEL_SGB {
+			return fmt.Errorf("unknown model %q", value)
+		}
+	case "boot":
+		m.Boot = value
+	case "rtc":
+		start, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return fmt.Errorf("invalid RTC start time %q", value)
+		}
+		m.RTCStart = start
+	default:
+		return fmt.Errorf("unknown header field %q", name)
+	}
+
+	seen[name] = true
+
+	return nil
+}
+
+func parseFrame(fields []string) (Frame, error) {
+	if len(fields) > 2 {
+		return Frame{}, errors.New("expected keys [checkpoint]")
+	}
+
+	keys, err := parseKeys(fields[0])
+	if err != nil {
+		return Frame{}, err
+	}
+
+	frame := Frame{Keys: keys}
+	if len(fields) == 2 {
+		checkpoint, err := strconv.ParseUint(fields[1], 16, 32)
+		if err != nil {
+			return Frame{}, fmt.Errorf("invalid checkpoint %q", fields[1])
+		}
+		frame.Checkpoint, frame.HasCheckpoint = uint32(checkpoint), true
+	}
+
+	return frame, nil
+}
+
+// Load reads the movie file at path
+func Load(path string) (*Movie, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	m, err := Parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return m, nil
+}
+
+// Save writes the movie to the file at path
+func (m *Movie) Save(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := m.Write(file); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
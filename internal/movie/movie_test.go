@@ -0,0 +1,140 @@
+package movie
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/carvhal/gby/internal/cartridge"
+	"github.com/carvhal/gby/internal/cpu"
+	"github.com/carvhal/gby/internal/joypad"
+	"github.com/carvhal/gby/internal/memory"
+	"github.com/carvhal/gby/internal/ppu"
+	. "github.com/carvhal/gby/internal/testutils"
+	"github.com/carvhal/gby/internal/testutils/testmachine"
+)
+
+// testROM copies the buttons read from P1 to the first row of tile 0, displayed all over the screen
+func testROM() []byte {
+	return testmachine.ROM(0x0000,
+		0x31, 0xFE, 0xFF, // LD SP, $FFFE
+		0x3E, 0x10, // LD A, $10
+		0xE0, 0x00, // LDH [$FF00], A
+		0x11, 0x00, 0xFF, // LD DE, $FF00
+		0x21, 0x00, 0x80, // LD HL, $8000
+		0x1A,       // LD A, [DE]
+		0x77,       // LD [HL], A
+		0x0C,       // INC C
+		0x20, 0xFB, // JR NZ, $000D
+		0xC7, // RST $00
+	)
+}
+
+func newMachine() (*cpu.CPU, *memory.Controller) {
+	return testmachine.New(testROM())
+}
+
+func record(t *testing.T) *Movie {
+	c, bus := newMachine()
+	session := Record(c, bus, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	session.SetCheckpointInterval(1)
+
+	for frame := 0; frame < 10; frame++ {
+		if frame == 3 {
+			bus.Joypad().Press(0, joypad.A)
+		}
+		if frame == 6 {
+			bus.Joypad().Release(0, joypad.A)
+		}
+
+		Must(t, session.RunFrame(), "Expected no error recording: %v")
+	}
+
+	return session.Movie()
+}
+
+func TestFormat(t *testing.T) {
+	m := record(t)
+	Expect(t, len(m.Frames), "frames").ToEqual(10)
+	Expect(t, formatKeys(m.Frames[3].Keys), "keys").ToEqual("....A...")
+
+	var text strings.Builder
+	Must(t, m.Write(&text), "Expected no error writing: %v")
+
+	parsed, err := Parse(strings.NewReader(text.String()))
+	Must(t, err, "Expected no error parsing: %v")
+	Expect(t, parsed, "movie").ToEqual(m)
+
+	_, err = Parse(strings.NewReader("gby-movie 1\nrom 00000000\nmodel dmg\nboot skip\nrtc 2024-01-01T00:00:00Z\nframes\n..X.....\n"))
+	Expect(t, err != nil, "invalid keys").ToEqual(true)
+}
+
+func TestPlayback(t *testing.T) {
+	m := record(t)
+	Expect(t, m.Frames[3].Checkpoint != m.Frames[2].Checkpoint, "input changes the frame").ToEqual(true)
+
+	c, bus := newMachine()
+	session, err := Play(c, bus, m, true)
+	Must(t, err, "Expected no error starting the playback: %v")
+
+	for i := 0; i < 10; i++ {
+		Must(t, session.RunFrame(), "Expected the playback to match: %v")
+	}
+	Expect(t, session.RunFrame(), "end").ToEqual(ErrEnd)
+
+	c, bus = newMachine()
+	bus.PPU().SetDMGPalette(ppu.DMGPalettes["green"])
+	session, err = Play(c, bus, m, true)
+	Must(t, err, "Expected no error starting the playback: %v")
+
+	for i := 0; i < 10; i++ {
+		Must(t, session.RunFrame(), "Expected the playback with another palette to match: %v")
+	}
+
+	m.Frames[4].Keys = 0
+	c, bus = newMachine()
+	session, _ = Play(c, bus, m, true)
+
+	for err = nil; err == nil; {
+		err = session.RunFrame()
+	}
+
+	var diverged *DivergenceError
+	Expect(t, errors.As(err, &diverged), "divergence").ToEqual(true)
+	Expect(t, diverged.Frame, "frame").ToEqual(4)
+}
+
+// clockMapper is a cartridge without banking exposing the clock set by the session
+type clockMapper struct {
+	*cartridge.ROM
+	now func() time.Time
+}
+
+func (m *clockMapper) SetClock(now func() time.Time) {
+	m.now = now
+}
+
+func TestClockDoubleSpeed(t *testing.T) {
+	rom := testmachine.ROM(0x0000,
+		0x3E, 0x01, // LD A, $01
+		0xE0, 0x4D, // LDH [$FF4D], A
+		0x10, 0x00, // STOP, switching to double speed
+		0x20, 0xFE, // JR NZ, $0006
+	)
+	rom[0x0143] = 0x80 // CGB
+
+	c, bus := testmachine.New(rom)
+	mapper := &clockMapper{ROM: cartridge.NewROM(rom)}
+	bus.SetMapper(mapper)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	session := Record(c, bus, start)
+	for frame := 0; frame < 60; frame++ {
+		Must(t, session.RunFrame(), "Expected no error recording: %v")
+	}
+
+	Expect(t, bus.DoubleSpeed(), "double speed").ToEqual(true)
+	elapsed := mapper.now().Sub(start)
+	Expect(t, elapsed > 950*time.Millisecond && elapsed < 1050*time.Millisecond, "a second in 60 frames, got "+elapsed.String()).ToEqual(true)
+}
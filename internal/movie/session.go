@@ -0,0 +1,179 @@
+package movie
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"time"
+
+	"github.com/carvhal/gby/internal/common"
+	"github.com/carvhal/gby/internal/cpu"
+	"github.com/carvhal/gby/internal/machine"
+	"github.com/carvhal/gby/internal/memory"
+)
+
+// DEFAULT_CHECKPOINT_INTERVAL is the number of frames between two checkpoints recorded
+const DEFAULT_CHECKPOINT_INTERVAL = 60
+
+// ErrEnd is returned by RunFrame once every frame of the movie played back ran
+var ErrEnd = errors.New("end of the movie")
+
+// DivergenceError is a frame displayed differently than when the movie was recorded
+type DivergenceError struct {
+	Frame    int
+	Expected uint32
+	Got      uint32
+}
+
+func (e *DivergenceError) Error() string {
+	return fmt.Sprintf("frame %d diverged from the movie: hash %08X, recorded %08X", e.Frame, e.Got, e.Expected)
+}
+
+// clockSetter is implemented by the cartridges with a real time clock
+type clockSetter interface {
+	SetClock(now func() time.Time)
+}
+
+// Session runs the machine frame by frame, recording the input of the joypad or playing a movie back,
+// the machine must just have been created, without battery save
+type Session struct {
+	cpu                *cpu.CPU
+	bus                *memory.Controller
+	movie              *Movie
+	playing            bool
+	verify             bool
+	frame              int
+	cycles             uint64 // cycles run, counted at normal speed so the clock runs at the same pace in double speed
+	checkpointInterval int
+}
+
+// MachineModel returns the model the bus emulates
+func MachineModel(bus *memory.Controller) Model {
+	switch {
+	case bus.SGB() != nil:
+		return MODEL_SGB
+	case bus.PPU().CGB():
+		return MODEL_CGB
+	}
+
+	return MODEL_DMG
+}
+
+// FrameHash returns the CRC32 of the last frame displayed, DMG frames are hashed by shade so that the hash
+// does not depend on the palette they are displayed with, CGB frames by the colors of the game
+func FrameHash(bus *memory.Controller) uint32 {
+	if !bus.PPU().CGB() {
+		return crc32.ChecksumIEEE(bus.PPU().Shades())
+	}
+
+	return crc32.ChecksumIEEE(bus.PPU().Framebuffer().Pix)
+}
+
+// Record starts recording the input of player 1 into a movie, the cartridge clock starts at rtcStart
+func Record(c *cpu.CPU, bus *memory.Controller, rtcStart time.Time) *Session {
+	s := &Session{
+		cpu: c,
+		bus: bus,
+		movie: &Movie{
+			Emulator:    common.VERSION,
+			ROMChecksum: bus.ROMChecksum(),
+			Model:       MachineModel(bus),
+			Boot:        BOOT_SKIP,
+			RTCStart:    rtcStart,
+		},
+		checkpointInterval: DEFAULT_CHECKPOINT_INTERVAL,
+	}
+	s.setClock()
+
+	return s
+}
+
+// Play starts playing a movie back, switching the machine to SGB mode for SGB movies, with verify
+// RunFrame fails with a DivergenceError when a frame does not match its checkpoint
+func Play(c *cpu.CPU, bus *memory.Controller, movie *Movie, verify bool) (*Session, error) {
+	if movie.ROMChecksum != bus.ROMChecksum() {
+		return nil, fmt.Errorf("movie recorded with the ROM of CRC32 %08X, running %08X", movie.ROMChecksum, bus.ROMChecksum())
+	}
+
+	if movie.Boot != BOOT_SKIP {
+		return nil, fmt.Errorf("unsupported boot option %q", movie.Boot)
+	}
+
+	if movie.Model == MODEL_SGB {
+		bus.EnableSGB()
+	}
+
+	if model := MachineModel(bus); model != movie.Model {
+		return nil, fmt.Errorf("movie recorded on %s, the ROM runs on %s", movie.Model, model)
+	}
+
+	s := &Session{cpu: c, bus: bus, movie: movie, playing: true, verify: verify}
+	s.setClock()
+
+	return s, nil
+}
+
+// setClock drives the cartridge clock by the cycles run, from the start time of the movie
+func (s *Session) setClock() {
+	if clock, ok := s.bus.Mapper().(clockSetter); ok {
+		clock.SetClock(func() time.Time {
+			seconds, rest := s.cycles/machine.CPU_CLOCK, s.cycles%machine.CPU_CLOCK
+			return s.movie.RTCStart.Add(time.Duration(seconds)*time.Second + time.Duration(rest)*time.Second/machine.CPU_CLOCK)
+		})
+	}
+}
+
+// SetCheckpointInterval sets the number of frames between two checkpoints recorded, 0 records none
+func (s *Session) SetCheckpointInterval(interval int) {
+	s.checkpointInterval = interval
+}
+
+// Movie returns the movie recorded or played back
+func (s *Session) Movie() *Movie {
+	return s.movie
+}
+
+// Frame returns the number of frames run
+func (s *Session) Frame() int {
+	return s.frame
+}
+
+// RunFrame runs a frame of the machine with machine.RunFrame, with the keys of the frame when playing back
+func (s *Session) RunFrame() error {
+	if s.playing {
+		if s.frame >= len(s.movie.Frames) {
+			return ErrEnd
+		}
+		s.bus.Joypad().SetPressed(0, s.movie.Frames[s.frame].Keys)
+	}
+
+	keys := s.bus.Joypad().Pressed(0)
+
+	cycles, err := machine.RunFrame(s.cpu, s.bus)
+	if s.bus.DoubleSpeed() {
+		cycles /= 2
+	}
+	s.cycles += uint64(cycles)
+	if err != nil {
+		return err
+	}
+
+	hash := FrameHash(s.bus)
+	frame := s.frame
+	s.frame++
+
+	if !s.playing {
+		recorded := Frame{Keys: keys}
+		if s.checkpointInterval > 0 && s.frame%s.checkpointInterval == 0 {
+			recorded.Checkpoint, recorded.HasCheckpoint = hash, true
+		}
+		s.movie.Frames = append(s.movie.Frames, recorded)
+		return nil
+	}
+
+	if recorded := s.movie.Frames[frame]; s.verify && recorded.HasCheckpoint && recorded.Checkpoint != hash {
+		return &DivergenceError{Frame: frame, Expected: recorded.Checkpoint, Got: hash}
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package ppu
+
+import "image/color"
+
+// colorPalettes holds the 64 bytes of CGB palette memory (8 palettes of 4 RGB555 colors)
+// together with its specification register, implementing BCPS/BCPD and OCPS/OCPD
+type colorPalettes struct {
+	data          [64]byte
+	index         byte // bits 0-5 of the specification register
+	autoIncrement bool // bit 7 of the specification register
+}
+
+// readSpec returns the specification register (BCPS / OCPS), bit 6 always reads as set
+func (p *colorPalettes) readSpec() byte {
+	value := p.index | 0x40
+
+	if p.autoIncrement {
+		value |= 0x80
+	}
+
+	return value
+}
+
+// writeSpec sets the index and the auto increment flag
+func (p *colorPalettes) writeSpec(value byte) {
+	p.index = value & 0x3F
+	p.autoIncrement = value&0x80 != 0
+}
+
+// readData returns the byte of palette memory pointed by the specification register (BCPD / OCPD)
+// reads never increment the index
+func (p *colorPalettes) readData() byte {
+	return p.data[p.index]
+}
+
+// writeData writes to the palette memory pointed by the specification register (BCPD / OCPD)
+// and increments the index if auto increment is set
+func (p *colorPalettes) writeData(value byte) {
+	p.data[p.index] = value
+
+	if p.autoIncrement {
+		p.index = (p.index + 1) & 0x3F
+	}
+}
+
+// color returns the color number colorID of the given palette as RGBA
+func (p *colorPalettes) color(palette, colorID byte) color.RGBA {
+	offset := (palette&0x07)*8 + (colorID&0x03)*2
+	rgb555 := uint16(p.data[offset]) | uint16(p.data[offset+1])<<8
+
+	return RGB555ToRGBA(rgb555)
+}
+
+// RGB555ToRGBA converts a little endian RGB555 color (0bbbbbgggggrrrrr) to 8-bit per channel RGBA
+func RGB555ToRGBA(rgb555 uint16) color.RGBA {
+	return color.RGBA{
+		R: scale5Bit(byte(rgb555 & 0x1F)),
+		G: scale5Bit(byte((rgb555 >> 5) & 0x1F)),
+		B: scale5Bit(byte((rgb555 >> 10) & 0x1F)),
+		A: 0xFF,
+	}
+}
+
+// scale5Bit scales a 5-bit channel to 8 bits, so that 0x1F maps to 0xFF
+func scale5Bit(value byte) byte {
+	return value<<3 | value>>2
+}
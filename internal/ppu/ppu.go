@@ -0,0 +1,398 @@
+package ppu
+
+import (
+	"image"
+	"image/color"
+)
+
+/*
+* Timing
+*
+* a scanline takes 456 dots, 154 scanlines make a frame
+*
+* mode | dots      | description
+*
+* 2    | 80        | OAM scan
+* 3    | 172       | drawing pixels
+* 0    | remaining | HBlank
+* 1    | 10 lines  | VBlank (lines 144 - 153)
+*
+ */
+
+const (
+	ScreenWidth  = 160
+	ScreenHeight = 144
+
+	dotsPerLine  = 456
+	linesTotal   = 154
+	oamScanDots  = 80
+	drawingDots  = 172
+	vramBankSize = 0x2000
+	oamSize      = 0xA0
+)
+
+// Mode is the current state of the PPU as reported by the 2 lower bits of STAT
+type Mode byte
+
+const (
+	HBLANK Mode = iota
+	VBLANK
+	OAM_SCAN
+	DRAWING
+)
+
+// LCDC bits
+const (
+	lcdcPriority      byte = 1 << iota // DMG: BG and window enable, CGB: BG and window master priority
+	lcdcObjEnable                      // objects enable
+	lcdcObjSize                        // 0: 8x8, 1: 8x16
+	lcdcBGTileMap                      // 0: 0x9800, 1: 0x9C00
+	lcdcTileData                       // 0: 0x8800 (signed), 1: 0x8000 (unsigned)
+	lcdcWindowEnable                   // window enable
+	lcdcWindowTileMap                  // 0: 0x9800, 1: 0x9C00
+	lcdcEnable                         // LCD and PPU enable
+)
+
+// register addresses handled by the PPU
+const (
+	LCDC uint16 = 0xFF40
+	STAT uint16 = 0xFF41
+	SCY  uint16 = 0xFF42
+	SCX  uint16 = 0xFF43
+	LY   uint16 = 0xFF44
+	LYC  uint16 = 0xFF45
+	BGP  uint16 = 0xFF47
+	OBP0 uint16 = 0xFF48
+	OBP1 uint16 = 0xFF49
+	WY   uint16 = 0xFF4A
+	WX   uint16 = 0xFF4B
+	VBK  uint16 = 0xFF4F
+	BCPS uint16 = 0xFF68
+	BCPD uint16 = 0xFF69
+	OCPS uint16 = 0xFF6A
+	OCPD uint16 = 0xFF6B
+)
+
+// DMGPalette are the colors used to display the 4 DMG shades, from white to black
+type DMGPalette [4]color.RGBA
+
+// DMGPalettes are the palettes available to display DMG games, by name
+var DMGPalettes = map[string]DMGPalette{
+	"grey": {
+		{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF},
+		{R: 0xAA, G: 0xAA, B: 0xAA, A: 0xFF},
+		{R: 0x55, G: 0x55, B: 0x55, A: 0xFF},
+		{R: 0x00, G: 0x00, B: 0x00, A: 0xFF},
+	},
+	// the green tinted LCD of the original Game Boy
+	"green": {
+		{R: 0x9B, G: 0xBC, B: 0x0F, A: 0xFF},
+		{R: 0x8B, G: 0xAC, B: 0x0F, A: 0xFF},
+		{R: 0x30, G: 0x62, B: 0x30, A: 0xFF},
+		{R: 0x0F, G: 0x38, B: 0x0F, A: 0xFF},
+	},
+	// the Game Boy Pocket LCD
+	"pocket": {
+		{R: 0xC4, G: 0xCF, B: 0xA1, A: 0xFF},
+		{R: 0x8B, G: 0x95, B: 0x6D, A: 0xFF},
+		{R: 0x4D, G: 0x53, B: 0x3C, A: 0xFF},
+		{R: 0x1F, G: 0x1F, B: 0x1F, A: 0xFF},
+	},
+}
+
+// DEFAULT_DMG_PALETTE is the name of the palette DMG games are displayed with unless told otherwise
+const DEFAULT_DMG_PALETTE = "grey"
+
+// PPU is the picture processing unit, it owns VRAM, OAM and the LCD registers
+// and renders scanlines into an RGB framebuffer
+type PPU struct {
+	cgb bool
+
+	vram     [2][vramBankSize]byte // bank 1 is only accessible in CGB mode
+	vramBank byte
+	oam      [oamSize]byte
+
+	lcdc, stat       byte
+	scy, scx         byte
+	ly, lyc          byte
+	bgp, obp0, obp1  byte
+	wy, wx           byte
+	windowLine       byte // internal window line counter
+	bgPalettes       colorPalettes
+	objPalettes      colorPalettes
+	dots             int
+	frames           uint64
+	framebuffer      *image.RGBA
+	shades           [ScreenWidth * ScreenHeight]byte // DMG shade (0-3) of every pixel after palette mapping
+	dmgPalette       DMGPalette
+	hblankListener   func()
+	interruptRequest func(interrupt byte)
+}
+
+func NewPPU(cgb bool) *PPU {
+	return &PPU{
+		cgb:         cgb,
+		lcdc:        0x91,
+		stat:        byte(OAM_SCAN),
+		bgp:         0xFC,
+		dmgPalette:  DMGPalettes[DEFAULT_DMG_PALETTE],
+		framebuffer: image.NewRGBA(image.Rect(0, 0, ScreenWidth, ScreenHeight)),
+	}
+}
+
+// CGB reports if the PPU is running in CGB mode
+func (p *PPU) CGB() bool {
+	return p.cgb
+}
+
+// SetDMGPalette sets the colors DMG games are displayed with, from the next line drawn
+func (p *PPU) SetDMGPalette(palette DMGPalette) {
+	p.dmgPalette = palette
+}
+
+// Framebuffer returns the last rendered frame
+func (p *PPU) Framebuffer() *image.RGBA {
+	return p.framebuffer
+}
+
+// Shades returns the DMG shade (0-3) of every pixel of the last rendered frame, row by row
+func (p *PPU) Shades() []byte {
+	return p.shades[:]
+}
+
+// Frames returns the number of frames completed (VBlank periods entered) since power on
+func (p *PPU) Frames() uint64 {
+	return p.frames
+}
+
+// Mode returns the current PPU mode
+func (p *PPU) Mode() Mode {
+	return Mode(p.stat & 0x03)
+}
+
+// LY returns the current scanline
+func (p *PPU) LY() byte {
+	return p.ly
+}
+
+// OnHBlank registers a function called every time the PPU enters HBlank on a visible line
+func (p *PPU) OnHBlank(listener func()) {
+	p.hblankListener = listener
+}
+
+// OnInterrupt registers a function called with the IF bit (0: VBlank, 1: STAT) the PPU requests
+func (p *PPU) OnInterrupt(listener func(interrupt byte)) {
+	p.interruptRequest = listener
+}
+
+// Step advances the PPU by the given number of dots (clock cycles)
+func (p *PPU) Step(dots int) {
+	if p.lcdc&lcdcEnable == 0 {
+		return
+	}
+
+	for ; dots > 0; dots-- {
+		p.dots++
+
+		switch {
+		case p.ly >= ScreenHeight:
+			// VBlank, nothing to do until the end of the line
+		case p.dots == oamScanDots:
+			p.setMode(DRAWING)
+		case p.dots == oamScanDots+drawingDots:
+			p.renderLine()
+			p.setMode(HBLANK)
+
+			if p.hblankListener != nil {
+				p.hblankListener()
+			}
+		}
+
+		if p.dots == dotsPerLine {
+			p.dots = 0
+			p.nextLine()
+		}
+	}
+}
+
+// nextLine moves the PPU to the next scanline, entering VBlank or starting a new frame as needed
+func (p *PPU) nextLine() {
+	p.ly = (p.ly + 1) % linesTotal
+	p.compareLY()
+
+	switch {
+	case p.ly == ScreenHeight:
+		p.frames++
+		p.setMode(VBLANK)
+		p.requestInterrupt(0)
+	case p.ly == 0:
+		p.windowLine = 0
+		p.setMode(OAM_SCAN)
+	case p.ly < ScreenHeight:
+		p.setMode(OAM_SCAN)
+	}
+}
+
+// setMode updates the mode in STAT and requests a STAT interrupt if the mode's source is enabled
+func (p *PPU) setMode(m Mode) {
+	p.stat = p.stat&^0x03 | byte(m)
+
+	if m != DRAWING && p.stat&(1<<(3+m)) != 0 {
+		p.requestInterrupt(1)
+	}
+}
+
+// compareLY updates the LYC == LY flag and requests a STAT interrupt if enabled
+func (p *PPU) compareLY() {
+	if p.ly != p.lyc {
+		p.stat &^= 0x04
+		return
+	}
+
+	p.stat |= 0x04
+
+	if p.stat&0x40 != 0 {
+		p.requestInterrupt(1)
+	}
+}
+
+func (p *PPU) requestInterrupt(interrupt byte) {
+	if p.interruptRequest != nil {
+		p.interruptRequest(interrupt)
+	}
+}
+
+// ReadVRAM reads from the currently selected VRAM bank, address is relative to 0x8000
+func (p *PPU) ReadVRAM(address uint16) byte {
+	return p.vram[p.vramBank][address]
+}
+
+// WriteVRAM writes to the currently selected VRAM bank, address is relative to 0x8000
+func (p *PPU) WriteVRAM(address uint16, value byte) {
+	p.vram[p.vramBank][address] = value
+}
+
+// ReadOAM reads from OAM, address is relative to 0xFE00
+func (p *PPU) ReadOAM(address uint16) byte {
+	return p.oam[address]
+}
+
+// WriteOAM writes to OAM, address is relative to 0xFE00
+func (p *PPU) WriteOAM(address uint16, value byte) {
+	p.oam[address] = value
+}
+
+// ReadRegister returns the value of the LCD register at address, ok is false if the register is not handled by the PPU
+func (p *PPU) ReadRegister(address uint16) (value byte, ok bool) {
+	switch address {
+	case LCDC:
+		return p.lcdc, true
+	case STAT:
+		return p.stat | 0x80, true
+	case SCY:
+		return p.scy, true
+	case SCX:
+		return p.scx, true
+	case LY:
+		return p.ly, true
+	case LYC:
+		return p.lyc, true
+	case BGP:
+		return p.bgp, true
+	case OBP0:
+		return p.obp0, true
+	case OBP1:
+		return p.obp1, true
+	case WY:
+		return p.wy, true
+	case WX:
+		return p.wx, true
+	}
+
+	if !p.cgb {
+		return 0, false
+	}
+
+	switch address {
+	case VBK:
+		return 0xFE | p.vramBank, true
+	case BCPS:
+		return p.bgPalettes.readSpec(), true
+	case BCPD:
+		return p.bgPalettes.readData(), true
+	case OCPS:
+		return p.objPalettes.readSpec(), true
+	case OCPD:
+		return p.objPalettes.readData(), true
+	}
+
+	return 0, false
+}
+
+// WriteRegister writes to the LCD register at address, ok is false if the register is not handled by the PPU
+func (p *PPU) WriteRegister(address uint16, value byte) (ok bool) {
+	switch address {
+	case LCDC:
+		p.writeLCDC(value)
+	case STAT:
+		// mode and LYC == LY flag are read only
+		p.stat = p.stat&0x07 | value&0x78
+	case SCY:
+		p.scy = value
+	case SCX:
+		p.scx = value
+	case LY:
+		// read only
+	case LYC:
+		p.lyc = value
+		p.compareLY()
+	case BGP:
+		p.bgp = value
+	case OBP0:
+		p.obp0 = value
+	case OBP1:
+		p.obp1 = value
+	case WY:
+		p.wy = value
+	case WX:
+		p.wx = value
+	default:
+		return p.cgb && p.writeCGBRegister(address, value)
+	}
+
+	return true
+}
+
+func (p *PPU) writeCGBRegister(address uint16, value byte) bool {
+	switch address {
+	case VBK:
+		p.vramBank = value & 0x01
+	case BCPS:
+		p.bgPalettes.writeSpec(value)
+	case BCPD:
+		p.bgPalettes.writeData(value)
+	case OCPS:
+		p.objPalettes.writeSpec(value)
+	case OCPD:
+		p.objPalettes.writeData(value)
+	default:
+		return false
+	}
+
+	return true
+}
+
+// writeLCDC writes to LCDC, turning the LCD off resets LY and the mode
+func (p *PPU) writeLCDC(value byte) {
+	wasEnabled := p.lcdc&lcdcEnable != 0
+	p.lcdc = value
+
+	switch {
+	case wasEnabled && value&lcdcEnable == 0:
+		p.ly, p.dots, p.windowLine = 0, 0, 0
+		p.stat &^= 0x03
+	case !wasEnabled && value&lcdcEnable != 0:
+		p.compareLY()
+		p.setMode(OAM_SCAN)
+	}
+}
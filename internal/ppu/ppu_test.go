@@ -0,0 +1,170 @@
+package ppu
+
+import (
+	"image/color"
+	"testing"
+
+	. "github.com/carvhal/gby/internal/testutils"
+)
+
+var (
+	red   = color.RGBA{R: 0xFF, A: 0xFF}
+	green = color.RGBA{G: 0xFF, A: 0xFF}
+	blue  = color.RGBA{B: 0xFF, A: 0xFF}
+	black = color.RGBA{A: 0xFF}
+)
+
+// writePalette writes the 4 RGB555 colors of a palette through the specification / data registers
+func writePalette(p *PPU, spec, data uint16, palette byte, colors [4]uint16) {
+	p.WriteRegister(spec, 0x80|palette*8)
+	for _, c := range colors {
+		p.WriteRegister(data, byte(c))
+		p.WriteRegister(data, byte(c>>8))
+	}
+}
+
+// writeTile fills every row of a tile in the given VRAM bank with the color index colorID
+func writeTile(p *PPU, bank byte, tile uint16, colorID byte) {
+	for row := uint16(0); row < 8; row++ {
+		var lo, hi byte
+		if colorID&1 != 0 {
+			lo = 0xFF
+		}
+		if colorID&2 != 0 {
+			hi = 0xFF
+		}
+		p.vram[bank][tile*16+row*2] = lo
+		p.vram[bank][tile*16+row*2+1] = hi
+	}
+}
+
+// renderFirstLine runs the PPU until line 0 has been drawn
+func renderFirstLine(p *PPU) {
+	p.Step(oamScanDots + drawingDots)
+}
+
+func TestColorPalettes(t *testing.T) {
+	p := NewPPU(true)
+
+	p.WriteRegister(BCPS, 0x80|0x3F)
+	p.WriteRegister(BCPD, 0x12)
+	p.WriteRegister(BCPD, 0x34)
+
+	spec, _ := p.ReadRegister(BCPS)
+	Expect(t, spec, "BCPS wraps around after auto increment").ToEqual(byte(0xC1))
+	Expect(t, p.bgPalettes.data[0x3F], "last palette byte").ToEqual(byte(0x12))
+	Expect(t, p.bgPalettes.data[0x00], "first palette byte").ToEqual(byte(0x34))
+
+	p.WriteRegister(OCPS, 0x05)
+	p.WriteRegister(OCPD, 0xAB)
+	p.WriteRegister(OCPD, 0xCD)
+
+	data, _ := p.ReadRegister(OCPD)
+	spec, _ = p.ReadRegister(OCPS)
+	Expect(t, spec, "OCPS without auto increment").ToEqual(byte(0x45))
+	Expect(t, data, "OCPD").ToEqual(byte(0xCD))
+
+	Expect(t, RGB555ToRGBA(0x7FFF), "white").ToEqual(color.RGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF})
+	Expect(t, RGB555ToRGBA(0x03E0), "green").ToEqual(green)
+}
+
+func TestCGBRegistersInDMGMode(t *testing.T) {
+	p := NewPPU(false)
+
+	_, ok := p.ReadRegister(BCPS)
+	Expect(t, ok, "BCPS is not handled in DMG mode").ToEqual(false)
+	Expect(t, p.WriteRegister(VBK, 1), "VBK is not handled in DMG mode").ToEqual(false)
+}
+
+func TestBGAttributes(t *testing.T) {
+	tests := []struct {
+		name     string
+		attrs    byte
+		expected [2]color.RGBA // pixel 0 and pixel 7 of the first line
+	}{
+		{name: "palette 0, bank 0", attrs: 0x00, expected: [2]color.RGBA{red, red}},
+		{name: "palette 1", attrs: 0x01, expected: [2]color.RGBA{blue, blue}},
+		{name: "bank 1", attrs: attrBank, expected: [2]color.RGBA{green, black}},
+		{name: "bank 1, X flip", attrs: attrBank | attrXFlip, expected: [2]color.RGBA{black, green}},
+		{name: "bank 1, Y flip", attrs: attrBank | attrYFlip, expected: [2]color.RGBA{black, black}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := NewPPU(true)
+			p.WriteRegister(LCDC, 0x91)
+
+			writePalette(p, BCPS, BCPD, 0, [4]uint16{0x0000, 0x001F, 0x03E0, 0x7C00})
+			writePalette(p, BCPS, BCPD, 1, [4]uint16{0x0000, 0x7C00, 0x7C00, 0x7C00})
+
+			// bank 0 tile 0 is color 1, bank 1 tile 0 has a single color 2 pixel on the top left corner
+			writeTile(p, 0, 0, 1)
+			p.vram[1][1] = 0x80
+
+			p.vram[1][0x1800] = test.attrs
+
+			renderFirstLine(p)
+
+			Expect(t, p.Framebuffer().RGBAAt(0, 0), "pixel 0").ToEqual(test.expected[0])
+			Expect(t, p.Framebuffer().RGBAAt(7, 0), "pixel 7").ToEqual(test.expected[1])
+		})
+	}
+}
+
+func TestObjectPriority(t *testing.T) {
+	tests := []struct {
+		name     string
+		lcdc     byte
+		bgAttrs  byte
+		objAttrs byte
+		expected color.RGBA
+	}{
+		{name: "object on top", lcdc: 0x93, expected: green},
+		{name: "BG attribute priority", lcdc: 0x93, bgAttrs: attrPriority, expected: red},
+		{name: "OAM priority", lcdc: 0x93, objAttrs: attrPriority, expected: red},
+		{name: "master priority overrides BG attribute", lcdc: 0x92, bgAttrs: attrPriority, expected: green},
+		{name: "master priority overrides OAM", lcdc: 0x92, objAttrs: attrPriority, expected: green},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := NewPPU(true)
+			p.WriteRegister(LCDC, test.lcdc)
+
+			writePalette(p, BCPS, BCPD, 0, [4]uint16{0x0000, 0x001F, 0x001F, 0x001F})
+			writePalette(p, OCPS, OCPD, 0, [4]uint16{0x0000, 0x03E0, 0x03E0, 0x03E0})
+
+			writeTile(p, 0, 0, 1)
+			writeTile(p, 0, 1, 1)
+			p.vram[1][0x1800] = test.bgAttrs
+
+			p.oam[0], p.oam[1], p.oam[2], p.oam[3] = 16, 8, 1, test.objAttrs
+
+			renderFirstLine(p)
+
+			Expect(t, p.Framebuffer().RGBAAt(0, 0), "pixel 0").ToEqual(test.expected)
+		})
+	}
+}
+
+func TestTiming(t *testing.T) {
+	p := NewPPU(false)
+	vblanks := 0
+	p.OnInterrupt(func(interrupt byte) {
+		if interrupt == 0 {
+			vblanks++
+		}
+	})
+
+	p.Step(dotsPerLine * ScreenHeight)
+
+	Expect(t, p.LY(), "LY").ToEqual(byte(ScreenHeight))
+	Expect(t, p.Mode(), "mode").ToEqual(VBLANK)
+	Expect(t, vblanks, "VBlank interrupts").ToEqual(1)
+
+	p.Step(dotsPerLine * (linesTotal - ScreenHeight))
+
+	Expect(t, p.LY(), "LY").ToEqual(byte(0))
+	Expect(t, p.Mode(), "mode").ToEqual(OAM_SCAN)
+	Expect(t, p.Frames(), "frames").ToEqual(uint64(1))
+}
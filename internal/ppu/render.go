@@ -0,0 +1,250 @@
+package ppu
+
+import "image/color"
+
+// CGB BG map attributes (stored in VRAM bank 1) and OAM attributes
+const (
+	attrPalette  byte = 0x07 // CGB palette number
+	attrBank     byte = 0x08 // CGB tile VRAM bank
+	attrDMGPal   byte = 0x10 // DMG object palette (OBP0 / OBP1)
+	attrXFlip    byte = 0x20
+	attrYFlip    byte = 0x40
+	attrPriority byte = 0x80 // BG over object
+)
+
+const maxObjectsPerLine = 10
+
+// bgPixel holds what the background / window layer left on a pixel, needed to resolve object priority
+type bgPixel struct {
+	colorID  byte // color index before palette mapping
+	priority bool // CGB BG map attribute priority bit
+}
+
+// object is an OAM entry selected for the current line
+type object struct {
+	y, x  int
+	tile  byte
+	attrs byte
+}
+
+// renderLine draws the current scanline into the framebuffer
+func (p *PPU) renderLine() {
+	var line [ScreenWidth]bgPixel
+
+	p.renderBackground(&line)
+	p.renderObjects(&line)
+}
+
+// renderBackground draws the background and the window for the current line
+func (p *PPU) renderBackground(line *[ScreenWidth]bgPixel) {
+	// in DMG mode LCDC bit 0 turns off the background and the window, in CGB mode it only affects priority
+	if !p.cgb && p.lcdc&lcdcPriority == 0 {
+		for x := range line {
+			p.setDMGPixel(x, p.bgp, 0)
+		}
+		return
+	}
+
+	windowX := int(p.wx) - 7
+	windowVisible := p.lcdc&lcdcWindowEnable != 0 && p.ly >= p.wy && windowX < ScreenWidth
+
+	for x := 0; x < ScreenWidth; x++ {
+		var mapBase uint16 = 0x1800
+		var mapX, mapY byte
+
+		if windowVisible && x >= windowX {
+			if p.lcdc&lcdcWindowTileMap != 0 {
+				mapBase = 0x1C00
+			}
+			mapX, mapY = byte(x-windowX), p.windowLine
+		} else {
+			if p.lcdc&lcdcBGTileMap != 0 {
+				mapBase = 0x1C00
+			}
+			mapX, mapY = byte(x)+p.scx, p.ly+p.scy
+		}
+
+		mapAddress := mapBase + uint16(mapY/8)*32 + uint16(mapX/8)
+		tile := p.vram[0][mapAddress]
+
+		var attrs byte
+		if p.cgb {
+			attrs = p.vram[1][mapAddress]
+		}
+
+		row, column := mapY%8, mapX%8
+		if attrs&attrYFlip != 0 {
+			row = 7 - row
+		}
+		if attrs&attrXFlip != 0 {
+			column = 7 - column
+		}
+
+		colorID := p.tilePixel(p.bgTileAddress(tile), (attrs&attrBank)>>3, row, column)
+		line[x] = bgPixel{colorID: colorID, priority: attrs&attrPriority != 0}
+
+		if p.cgb {
+			p.setPixel(x, p.bgPalettes.color(attrs&attrPalette, colorID))
+		} else {
+			p.setDMGPixel(x, p.bgp, colorID)
+		}
+	}
+
+	if windowVisible {
+		p.windowLine++
+	}
+}
+
+// renderObjects draws the objects of the current line on top of the background according to priority
+func (p *PPU) renderObjects(line *[ScreenWidth]bgPixel) {
+	if p.lcdc&lcdcObjEnable == 0 {
+		return
+	}
+
+	height := 8
+	if p.lcdc&lcdcObjSize != 0 {
+		height = 16
+	}
+
+	objects := p.selectObjects(height)
+
+	for x := 0; x < ScreenWidth; x++ {
+		for _, obj := range p.objectsAt(objects, x) {
+			row, column := int(p.ly)-obj.y, x-obj.x
+			if obj.attrs&attrYFlip != 0 {
+				row = height - 1 - row
+			}
+			if obj.attrs&attrXFlip != 0 {
+				column = 7 - column
+			}
+
+			tile := obj.tile
+			if height == 16 {
+				tile &= 0xFE
+			}
+
+			bank := byte(0)
+			if p.cgb {
+				bank = (obj.attrs & attrBank) >> 3
+			}
+
+			colorID := p.tilePixel(uint16(tile)*16, bank, byte(row), byte(column))
+			if colorID == 0 {
+				// transparent, an object behind may still be visible
+				continue
+			}
+
+			if p.objectVisible(obj, line[x]) {
+				p.drawObjectPixel(x, obj, colorID)
+			}
+			break
+		}
+	}
+}
+
+// selectObjects returns up to 10 objects overlapping the current line, in OAM order
+func (p *PPU) selectObjects(height int) []object {
+	objects := make([]object, 0, maxObjectsPerLine)
+
+	for i := 0; i < oamSize && len(objects) < maxObjectsPerLine; i += 4 {
+		y := int(p.oam[i]) - 16
+		if int(p.ly) < y || int(p.ly) >= y+height {
+			continue
+		}
+
+		objects = append(objects, object{
+			y:     y,
+			x:     int(p.oam[i+1]) - 8,
+			tile:  p.oam[i+2],
+			attrs: p.oam[i+3],
+		})
+	}
+
+	return objects
+}
+
+// objectsAt returns the objects covering column x sorted by drawing priority:
+// OAM order in CGB mode, lowest X coordinate first (then OAM order) in DMG mode
+func (p *PPU) objectsAt(objects []object, x int) []object {
+	var covering []object
+
+	for _, obj := range objects {
+		if x < obj.x || x >= obj.x+8 {
+			continue
+		}
+
+		position := len(covering)
+		if !p.cgb {
+			for position > 0 && covering[position-1].x > obj.x {
+				position--
+			}
+		}
+
+		covering = append(covering, object{})
+		copy(covering[position+1:], covering[position:])
+		covering[position] = obj
+	}
+
+	return covering
+}
+
+// objectVisible resolves BG to OBJ priority for a non transparent object pixel
+func (p *PPU) objectVisible(obj object, bg bgPixel) bool {
+	if bg.colorID == 0 {
+		return true
+	}
+
+	if p.cgb {
+		// LCDC bit 0 cleared is the master priority: objects are always on top
+		if p.lcdc&lcdcPriority == 0 {
+			return true
+		}
+
+		return !bg.priority && obj.attrs&attrPriority == 0
+	}
+
+	return obj.attrs&attrPriority == 0
+}
+
+// drawObjectPixel maps an object color index through its palette and draws it
+func (p *PPU) drawObjectPixel(x int, obj object, colorID byte) {
+	switch {
+	case p.cgb:
+		p.setPixel(x, p.objPalettes.color(obj.attrs&attrPalette, colorID))
+	case obj.attrs&attrDMGPal != 0:
+		p.setDMGPixel(x, p.obp1, colorID)
+	default:
+		p.setDMGPixel(x, p.obp0, colorID)
+	}
+}
+
+// bgTileAddress returns the address (relative to 0x8000) of a background / window tile according to LCDC bit 4
+func (p *PPU) bgTileAddress(tile byte) uint16 {
+	if p.lcdc&lcdcTileData != 0 {
+		return uint16(tile) * 16
+	}
+
+	return uint16(0x1000 + int(int8(tile))*16)
+}
+
+// tilePixel returns the color index of a pixel of the tile at address in the given VRAM bank
+func (p *PPU) tilePixel(address uint16, bank byte, row, column byte) byte {
+	lo := p.vram[bank][address+uint16(row)*2]
+	hi := p.vram[bank][address+uint16(row)*2+1]
+	bit := 7 - column
+
+	return (hi>>bit&1)<<1 | lo>>bit&1
+}
+
+// setDMGPixel maps a color index through a DMG palette register, records the resulting shade and draws it
+func (p *PPU) setDMGPixel(x int, palette, colorID byte) {
+	shade := (palette >> (colorID * 2)) & 0x03
+	p.shades[int(p.ly)*ScreenWidth+x] = shade
+
+	p.setPixel(x, p.dmgPalette[shade])
+}
+
+// setPixel writes a color to the framebuffer on the current line
+func (p *PPU) setPixel(x int, c color.RGBA) {
+	p.framebuffer.SetRGBA(x, int(p.ly), c)
+}
@@ -0,0 +1,56 @@
+package ppu
+
+import "github.com/carvhal/gby/internal/common"
+
+// SaveState returns VRAM, OAM, the LCD registers and the last frame, for save states of the whole machine
+func (p *PPU) SaveState() []byte {
+	var state common.StateEncoder
+	state.Bytes(p.vram[0][:])
+	state.Bytes(p.vram[1][:])
+	state.Byte(p.vramBank)
+	state.Bytes(p.oam[:])
+	state.Bytes([]byte{p.lcdc, p.stat, p.scy, p.scx, p.ly, p.lyc, p.bgp, p.obp0, p.obp1, p.wy, p.wx, p.windowLine})
+	p.bgPalettes.saveState(&state)
+	p.objPalettes.saveState(&state)
+	state.Int(p.dots)
+	state.Uint64(p.frames)
+	state.Bytes(p.framebuffer.Pix)
+	state.Bytes(p.shades[:])
+
+	return state.Data
+}
+
+// LoadState restores a state returned by SaveState
+func (p *PPU) LoadState(data []byte) error {
+	state := common.StateDecoder{Data: data}
+	state.Bytes(p.vram[0][:])
+	state.Bytes(p.vram[1][:])
+	p.vramBank = state.Byte()
+	state.Bytes(p.oam[:])
+
+	var registers [12]byte
+	state.Bytes(registers[:])
+	p.lcdc, p.stat, p.scy, p.scx, p.ly, p.lyc = registers[0], registers[1], registers[2], registers[3], registers[4], registers[5]
+	p.bgp, p.obp0, p.obp1, p.wy, p.wx, p.windowLine = registers[6], registers[7], registers[8], registers[9], registers[10], registers[11]
+
+	p.bgPalettes.loadState(&state)
+	p.objPalettes.loadState(&state)
+	p.dots = state.Int()
+	p.frames = state.Uint64()
+	state.Bytes(p.framebuffer.Pix)
+	state.Bytes(p.shades[:])
+
+	return state.Err("ppu")
+}
+
+func (p *colorPalettes) saveState(state *common.StateEncoder) {
+	state.Bytes(p.data[:])
+	state.Byte(p.index)
+	state.Bool(p.autoIncrement)
+}
+
+func (p *colorPalettes) loadState(state *common.StateDecoder) {
+	state.Bytes(p.data[:])
+	p.index = state.Byte()
+	p.autoIncrement = state.Bool()
+}
@@ -0,0 +1,147 @@
+package rewind
+
+import "errors"
+
+// DEFAULT_KEYFRAME_INTERVAL is the number of snapshots between two keyframes
+const DEFAULT_KEYFRAME_INTERVAL = 60
+
+// snapshot is a state stored as a delta against the keyframe before it, keyframes are deltas against nothing
+type snapshot struct {
+	frame    uint64
+	keyframe bool
+	delta    []byte
+}
+
+// Buffer keeps the snapshots of the last frames within a memory budget, the oldest keyframe and the snapshots
+// depending on it are dropped first, the snapshots of the newest keyframe are always kept
+type Buffer struct {
+	budget    int
+	interval  int
+	snapshots []snapshot
+	size      int    // bytes used by the deltas
+	keyframe  []byte // state of the newest keyframe
+}
+
+// NewBuffer returns a buffer keeping budget bytes of snapshots
+func NewBuffer(budget int) *Buffer {
+	return &Buffer{budget: budget, interval: DEFAULT_KEYFRAME_INTERVAL}
+}
+
+// SetKeyframeInterval sets the number of snapshots between two keyframes, shorter intervals make rewinding
+// cheaper and the snapshots bigger
+func (b *Buffer) SetKeyframeInterval(interval int) {
+	b.interval = max(interval, 1)
+}
+
+// Len returns the number of snapshots kept
+func (b *Buffer) Len() int {
+	return len(b.snapshots)
+}
+
+// Size returns the number of bytes used by the snapshots
+func (b *Buffer) Size() int {
+	return b.size
+}
+
+// Oldest returns the frame of the oldest snapshot kept
+func (b *Buffer) Oldest() (uint64, bool) {
+	if len(b.snapshots) == 0 {
+		return 0, false
+	}
+
+	return b.snapshots[0].frame, true
+}
+
+// Newest returns the frame of the newest snapshot
+func (b *Buffer) Newest() (uint64, bool) {
+	if len(b.snapshots) == 0 {
+		return 0, false
+	}
+
+	return b.snapshots[len(b.snapshots)-1].frame, true
+}
+
+// Push adds the state of a frame, frames must increase
+func (b *Buffer) Push(frame uint64, state []byte) {
+	s := snapshot{frame: frame}
+
+	if b.keyframe == nil || b.sinceKeyframe() >= b.interval {
+		s.keyframe = true
+		s.delta = encodeDelta(nil, state)
+		b.keyframe = append([]byte(nil), state...)
+	} else {
+		s.delta = encodeDelta(b.keyframe, state)
+	}
+
+	b.snapshots = append(b.snapshots, s)
+	b.size += len(s.delta)
+
+	b.evict()
+}
+
+// sinceKeyframe returns the number of snapshots after the newest keyframe, itself included
+func (b *Buffer) sinceKeyframe() int {
+	for i := len(b.snapshots) - 1; i >= 0; i-- {
+		if b.snapshots[i].keyframe {
+			return len(b.snapshots) - i
+		}
+	}
+
+	return len(b.snapshots)
+}
+
+// evict drops the oldest keyframes with their snapshots until the buffer fits its budget
+func (b *Buffer) evict() {
+	for b.size > b.budget {
+		next := 1
+		for next < len(b.snapshots) && !b.snapshots[next].keyframe {
+			next++
+		}
+
+		if next == len(b.snapshots) {
+			return
+		}
+
+		for _, s := range b.snapshots[:next] {
+			b.size -= len(s.delta)
+		}
+		b.snapshots = b.snapshots[next:]
+	}
+}
+
+// Seek returns the newest state at or before frame and its frame, the snapshots after it are dropped
+func (b *Buffer) Seek(frame uint64) (uint64, []byte, error) {
+	i := len(b.snapshots) - 1
+	for i >= 0 && b.snapshots[i].frame > frame {
+		i--
+	}
+
+	if i < 0 {
+		return 0, nil, errors.New("no snapshot that old")
+	}
+
+	k := i
+	for !b.snapshots[k].keyframe {
+		k--
+	}
+
+	keyframe, err := applyDelta(nil, b.snapshots[k].delta)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	state := keyframe
+	if k != i {
+		if state, err = applyDelta(keyframe, b.snapshots[i].delta); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	for _, s := range b.snapshots[i+1:] {
+		b.size -= len(s.delta)
+	}
+	b.snapshots = b.snapshots[:i+1]
+	b.keyframe = keyframe
+
+	return b.snapshots[i].frame, state, nil
+}
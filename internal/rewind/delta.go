@@ -0,0 +1,91 @@
+package rewind
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+/*
+* Delta encoding
+*
+* a delta is the XOR of a state with its base, where most bytes did not change and XOR to zero,
+* the zeros are stored as runs
+*
+* uvarint length of the state
+* then until the end of the state:
+* uvarint number of unchanged bytes
+* uvarint number n of changed bytes
+* n bytes of XOR
+*
+* states longer than their base are XORed with zeros past the end of the base
+*
+ */
+
+var errCorruptDelta = errors.New("corrupt rewind delta")
+
+// encodeDelta returns the delta of state against base, a nil base stores the state run length encoded
+func encodeDelta(base, state []byte) []byte {
+	delta := binary.AppendUvarint(nil, uint64(len(state)))
+
+	xor := func(i int) byte {
+		if i < len(base) {
+			return state[i] ^ base[i]
+		}
+		return state[i]
+	}
+
+	for i := 0; i < len(state); {
+		start := i
+		for i < len(state) && xor(i) == 0 {
+			i++
+		}
+		delta = binary.AppendUvarint(delta, uint64(i-start))
+
+		start = i
+		for i < len(state) && xor(i) != 0 {
+			i++
+		}
+		delta = binary.AppendUvarint(delta, uint64(i-start))
+
+		for j := start; j < i; j++ {
+			delta = append(delta, xor(j))
+		}
+	}
+
+	return delta
+}
+
+// applyDelta returns the state a delta was made of against base
+func applyDelta(base, delta []byte) ([]byte, error) {
+	length, n := binary.Uvarint(delta)
+	if n <= 0 || length > 1<<32 {
+		return nil, errCorruptDelta
+	}
+	delta = delta[n:]
+
+	state := make([]byte, length)
+	copy(state, base)
+
+	for i := 0; i < len(state); {
+		unchanged, n := binary.Uvarint(delta)
+		if n <= 0 {
+			return nil, errCorruptDelta
+		}
+		delta = delta[n:]
+
+		changed, n := binary.Uvarint(delta)
+		if n <= 0 || unchanged+changed == 0 || uint64(len(delta)-n) < changed || uint64(len(state)-i) < unchanged+changed {
+			return nil, errCorruptDelta
+		}
+		delta = delta[n:]
+
+		i += int(unchanged)
+		for _, value := range delta[:changed] {
+			state[i] ^= value
+			i++
+		}
+		delta = delta[changed:]
+	}
+
+	return state, nil
+}
@@ -0,0 +1,65 @@
+package rewind
+
+import (
+	"fmt"
+
+	"github.com/carvhal/gby/internal/cpu"
+	"github.com/carvhal/gby/internal/memory"
+	"github.com/carvhal/gby/internal/savestate"
+)
+
+// DEFAULT_BUDGET is the memory used by the snapshots of a Rewinder by default, in bytes
+const DEFAULT_BUDGET = 64 << 20
+
+// Rewinder snapshots the machine at the start of every frame, to go back in time
+type Rewinder struct {
+	cpu    *cpu.CPU
+	bus    *memory.Controller
+	buffer *Buffer
+}
+
+// New returns a Rewinder keeping budget bytes of snapshots of the machine
+func New(c *cpu.CPU, bus *memory.Controller, budget int) *Rewinder {
+	return &Rewinder{cpu: c, bus: bus, buffer: NewBuffer(budget)}
+}
+
+// Buffer returns the snapshots of the Rewinder
+func (r *Rewinder) Buffer() *Buffer {
+	return r.buffer
+}
+
+// Capture snapshots the machine when a frame started since the last snapshot, it is meant to be called
+// after every instruction
+func (r *Rewinder) Capture() {
+	frame := r.bus.PPU().Frames()
+	if newest, ok := r.buffer.Newest(); ok && newest >= frame {
+		return
+	}
+
+	r.buffer.Push(frame, savestate.Encode(r.cpu, r.bus))
+}
+
+// Rewind restores the machine to the start of the frame count frames before the current one,
+// or to the oldest snapshot kept, it returns the frame restored
+func (r *Rewinder) Rewind(count int) (uint64, error) {
+	frame := r.bus.PPU().Frames()
+	target := uint64(0)
+	if uint64(count) < frame {
+		target = frame - uint64(count)
+	}
+
+	if oldest, ok := r.buffer.Oldest(); ok && target < oldest {
+		target = oldest
+	}
+
+	frame, state, err := r.buffer.Seek(target)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := savestate.Decode(state, r.cpu, r.bus); err != nil {
+		return 0, fmt.Errorf("rewind to frame %d: %w", frame, err)
+	}
+
+	return frame, nil
+}
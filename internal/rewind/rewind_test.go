@@ -0,0 +1,85 @@
+package rewind
+
+import (
+	"testing"
+
+	. "github.com/carvhal/gby/internal/testutils"
+)
+
+func TestDelta(t *testing.T) {
+	base := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	states := [][]byte{
+		{1, 2, 3, 4, 5, 6, 7, 8},
+		{1, 2, 0xFF, 4, 5, 6, 7, 0},
+		{9, 9},
+		{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+		{},
+	}
+
+	for _, state := range states {
+		delta := encodeDelta(base, state)
+		decoded, err := applyDelta(base, delta)
+		Must(t, err, "Expected no error applying the delta: %v")
+		Expect(t, decoded, "state").ToEqual(state)
+	}
+
+	unchanged := encodeDelta(base, base)
+	Expect(t, len(unchanged) < len(base), "unchanged state compressed").ToEqual(true)
+
+	_, err := applyDelta(base, []byte{0x08, 0x00, 0x00})
+	Expect(t, err, "corrupt delta").ToEqual(errCorruptDelta)
+}
+
+func state(frame int) []byte {
+	s := make([]byte, 1024)
+	s[0] = byte(frame)
+	s[512] = byte(frame * 3)
+
+	return s
+}
+
+func TestBuffer(t *testing.T) {
+	b := NewBuffer(1 << 20)
+	b.SetKeyframeInterval(10)
+
+	for frame := 1; frame <= 35; frame++ {
+		b.Push(uint64(frame), state(frame))
+	}
+
+	frame, s, err := b.Seek(20)
+	Must(t, err, "Expected no error seeking: %v")
+	Expect(t, frame, "frame").ToEqual(uint64(20))
+	Expect(t, s, "state").ToEqual(state(20))
+	Expect(t, b.Len(), "snapshots after the frame dropped").ToEqual(20)
+
+	b.Push(21, state(42))
+	_, s, err = b.Seek(21)
+	Must(t, err, "Expected no error seeking: %v")
+	Expect(t, s, "state pushed after seeking").ToEqual(state(42))
+
+	_, _, err = b.Seek(0)
+	Expect(t, err != nil, "no snapshot before the first frame").ToEqual(true)
+}
+
+func TestBufferBudget(t *testing.T) {
+	b := NewBuffer(0)
+	b.SetKeyframeInterval(10)
+	keyframe := len(encodeDelta(nil, state(1)))
+	b.budget = 3 * 10 * keyframe
+
+	for frame := 1; frame <= 100; frame++ {
+		b.Push(uint64(frame), state(frame))
+	}
+
+	Expect(t, b.Size() <= b.budget, "size within the budget").ToEqual(true)
+
+	oldest, _ := b.Oldest()
+	Expect(t, (oldest-1)%10, "oldest snapshot is a keyframe").ToEqual(uint64(0))
+
+	newest, _ := b.Newest()
+	Expect(t, newest, "newest").ToEqual(uint64(100))
+
+	_, s, err := b.Seek(oldest)
+	Must(t, err, "Expected no error seeking: %v")
+	Expect(t, s, "oldest state").ToEqual(state(int(oldest)))
+}
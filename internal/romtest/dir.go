@@ -0,0 +1,17 @@
+package romtest
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Dir returns the directory of a suite of test ROMs, in the directory named by GBY_TEST_ROMS
+// or testroms at the root of the repository
+func Dir(suite string) string {
+	if root := os.Getenv("GBY_TEST_ROMS"); root != "" {
+		return filepath.Join(root, suite)
+	}
+
+	// go test runs in the directory of the package
+	return filepath.Join("..", "..", "testroms", suite)
+}
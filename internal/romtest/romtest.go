@@ -0,0 +1,287 @@
+package romtest
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/carvhal/gby/internal/cpu"
+	"github.com/carvhal/gby/internal/machine"
+	"github.com/carvhal/gby/internal/memory"
+	"github.com/carvhal/gby/internal/ppu"
+)
+
+// DEFAULT_FRAMES is the number of frames a test ROM runs at most, unless told otherwise
+const DEFAULT_FRAMES = 600
+
+// Condition tells whether a test ROM finished, it is checked before every instruction
+type Condition func(c *cpu.CPU, bus *memory.Controller) bool
+
+// LDBB stops on LD B, B, the breakpoint ending dmg-acid2, cgb-acid2 and the mealybug tearoom tests
+func LDBB(c *cpu.CPU, bus *memory.Controller) bool {
+	opcode, err := bus.Peek(c.PC, 1)
+	return err == nil && opcode[0] == 0x40
+}
+
+// InfiniteLoop stops on a JR jumping to itself, where many test ROMs wait once done
+// the bytes are peeked one at a time, the instruction may straddle two memory regions
+func InfiniteLoop(c *cpu.CPU, bus *memory.Controller) bool {
+	opcode, err := bus.Peek(c.PC, 1)
+	if err != nil || opcode[0] != 0x18 {
+		return false
+	}
+
+	offset, err := bus.Peek(c.PC+1, 1)
+	return err == nil && offset[0] == 0xFE
+}
+
+// Options configures how the test ROMs run
+type Options struct {
+	Frames     int         // frames run at most, DEFAULT_FRAMES when 0
+	Stop       []Condition // conditions ending the test before Frames, LDBB and InfiniteLoop when nil
+	Palette    string      // DMG palette, ppu.DEFAULT_DMG_PALETTE when empty
+	References string      // directory of the reference PNGs, the directory of the ROMs when empty
+}
+
+func (o Options) frames() int {
+	if o.Frames == 0 {
+		return DEFAULT_FRAMES
+	}
+
+	return o.Frames
+}
+
+func (o Options) stop() []Condition {
+	if o.Stop == nil {
+		return []Condition{LDBB, InfiniteLoop}
+	}
+
+	return o.Stop
+}
+
+// Result is the outcome of a test ROM
+type Result struct {
+	ROM       string
+	Frames    int  // frames run
+	Stopped   bool // a stop condition was met before the last frame
+	Screen    image.Image
+	Reference string // path of the reference PNG
+	Diff      int    // pixels differing from the reference
+	Err       error  // the ROM failed to run or has no reference
+}
+
+// Passed reports whether the screen matched the reference
+func (r Result) Passed() bool {
+	return r.Err == nil && r.Diff == 0
+}
+
+// Status returns pass, or why the test failed
+func (r Result) Status() string {
+	switch {
+	case errors.Is(r.Err, os.ErrNotExist):
+		return "no reference"
+	case r.Err != nil:
+		return fmt.Sprintf("error: %v", r.Err)
+	case r.Diff != 0:
+		return fmt.Sprintf("FAIL (%d pixels)", r.Diff)
+	}
+
+	return "pass"
+}
+
+// Run runs a ROM from its entry point until a stop condition or the last frame, it returns the screen displayed
+func Run(rom []byte, options Options) Result {
+	bus := memory.NewController(rom)
+	c := cpu.NewCPU(bus)
+	machine.SkipBoot(c, bus)
+
+	palette, ok := ppu.DMGPalettes[options.Palette]
+	if options.Palette == "" {
+		palette, ok = ppu.DMGPalettes[ppu.DEFAULT_DMG_PALETTE], true
+	}
+	if !ok {
+		return Result{Err: fmt.Errorf("unknown palette %q", options.Palette)}
+	}
+	bus.PPU().SetDMGPalette(palette)
+
+	stop := func() bool {
+		for _, condition := range options.stop() {
+			if condition(c, bus) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var result Result
+	for result.Frames < options.frames() && !result.Stopped {
+		_, stopped, err := machine.RunFrameUntil(c, bus, stop)
+		if err != nil {
+			result.Err = fmt.Errorf("%w at PC %s", err, c.FormatAddress(c.PC))
+			break
+		}
+
+		result.Stopped = stopped
+		if !stopped {
+			result.Frames++
+		}
+	}
+
+	result.Screen = machine.Screen(bus)
+
+	return result
+}
+
+// ReferencePath returns the path of the reference PNG of a ROM, named after it
+func ReferencePath(romPath string, options Options) string {
+	name := strings.TrimSuffix(filepath.Base(romPath), filepath.Ext(romPath)) + ".png"
+
+	if options.References != "" {
+		return filepath.Join(options.References, name)
+	}
+
+	return filepath.Join(filepath.Dir(romPath), name)
+}
+
+// RunFile runs the ROM at path and compares its screen with its reference
+func RunFile(path string, options Options) Result {
+	rom, err := os.ReadFile(path)
+	if err != nil {
+		return Result{ROM: path, Err: err}
+	}
+
+	result := Run(rom, options)
+	result.ROM = path
+	result.Reference = ReferencePath(path, options)
+
+	if result.Err != nil {
+		return result
+	}
+
+	reference, err := LoadPNG(result.Reference)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	result.Diff = Compare(result.Screen, reference)
+
+	return result
+}
+
+// ROMs returns the ROMs (.gb, .gbc) of a directory, sorted
+func ROMs(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var roms []string
+	for _, entry := range entries {
+		extension := strings.ToLower(filepath.Ext(entry.Name()))
+		if !entry.IsDir() && (extension == ".gb" || extension == ".gbc") {
+			roms = append(roms, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Strings(roms)
+
+	return roms, nil
+}
+
+// RunDirectory runs the ROMs of a directory
+func RunDirectory(dir string, options Options) ([]Result, error) {
+	roms, err := ROMs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, 0, len(roms))
+	for _, rom := range roms {
+		results = append(results, RunFile(rom, options))
+	}
+
+	return results, nil
+}
+
+// LoadPNG reads the PNG file at path
+func LoadPNG(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	img, err := png.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return img, nil
+}
+
+// WritePNG writes img to a PNG file at path
+func WritePNG(path string, img image.Image) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// Compare returns the number of pixels that differ between two images, all of them when the sizes differ
+func Compare(a, b image.Image) int {
+	boundsA, boundsB := a.Bounds(), b.Bounds()
+	if boundsA.Dx() != boundsB.Dx() || boundsA.Dy() != boundsB.Dy() {
+		return max(boundsA.Dx()*boundsA.Dy(), boundsB.Dx()*boundsB.Dy())
+	}
+
+	diff := 0
+	for y := 0; y < boundsA.Dy(); y++ {
+		for x := 0; x < boundsA.Dx(); x++ {
+			r1, g1, b1, _ := a.At(boundsA.Min.X+x, boundsA.Min.Y+y).RGBA()
+			r2, g2, b2, _ := b.At(boundsB.Min.X+x, boundsB.Min.Y+y).RGBA()
+			if r1>>8 != r2>>8 || g1>>8 != g2>>8 || b1>>8 != b2>>8 {
+				diff++
+			}
+		}
+	}
+
+	return diff
+}
+
+// WriteMatrix writes a line per result with the frames run, how the test ended and whether it passed,
+// followed by the totals
+func WriteMatrix(w io.Writer, results []Result) error {
+	out := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(out, "ROM\tframes\tend\tresult")
+
+	passed := 0
+	for _, result := range results {
+		end := "frames"
+		if result.Stopped {
+			end = "stop"
+		}
+		if result.Passed() {
+			passed++
+		}
+
+		fmt.Fprintf(out, "%s\t%d\t%s\t%s\n", filepath.Base(result.ROM), result.Frames, end, result.Status())
+	}
+
+	fmt.Fprintf(out, "\n%d/%d passed\n", passed, len(results))
+
+	return out.Flush()
+}
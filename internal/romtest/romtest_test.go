@@ -0,0 +1,79 @@
+package romtest
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/carvhal/gby/internal/testutils"
+	"github.com/carvhal/gby/internal/testutils/testmachine"
+)
+
+// testROM returns a ROM running program from its entry point
+func testROM(program ...byte) []byte {
+	return testmachine.ROM(0x0100, program...)
+}
+
+func TestStopConditions(t *testing.T) {
+	result := Run(testROM(0x0C, 0x40), Options{}) // INC C, LD B, B
+	Must(t, result.Err, "Expected no error running: %v")
+	Expect(t, result.Stopped, "stopped on LD B, B").ToEqual(true)
+
+	result = Run(testROM(0x0C, 0x18, 0xFE), Options{}) // INC C, JR $0101
+	Must(t, result.Err, "Expected no error running: %v")
+	Expect(t, result.Stopped, "stopped on the infinite loop").ToEqual(true)
+
+	result = Run(testROM(0x0C, 0x20, 0xFE), Options{Frames: 5}) // INC C, JR NZ $0101
+	Must(t, result.Err, "Expected no error running: %v")
+	Expect(t, result.Stopped, "ran every frame").ToEqual(false)
+	Expect(t, result.Frames, "frames").ToEqual(5)
+
+	result = Run(testROM(0xD3), Options{})
+	Expect(t, result.Err != nil, "illegal opcode").ToEqual(true)
+}
+
+func TestInfiniteLoopBoundaries(t *testing.T) {
+	c, bus := testmachine.New(testROM())
+
+	// JR at the end of work RAM, its offset is in the unmapped echo RAM
+	Must(t, bus.Poke(0xDFFF, []byte{0x18}), "Expected no error writing: %v")
+	c.PC = 0xDFFF
+	Expect(t, InfiniteLoop(c, bus), "end of work RAM").ToEqual(false)
+
+	// JR $FFFE at the end of HRAM, its offset in IE
+	Must(t, bus.Poke(0xFFFE, []byte{0x18}), "Expected no error writing: %v")
+	Must(t, bus.Poke(0xFFFF, []byte{0xFE}), "Expected no error writing: %v")
+	c.PC = 0xFFFE
+	Expect(t, InfiniteLoop(c, bus), "end of HRAM").ToEqual(true)
+}
+
+func TestReference(t *testing.T) {
+	dir := t.TempDir()
+	Must(t, os.WriteFile(filepath.Join(dir, "blank.gb"), testROM(0x40), 0o644), "Expected no error writing: %v")
+
+	results, err := RunDirectory(dir, Options{})
+	Must(t, err, "Expected no error running the directory: %v")
+	Expect(t, len(results), "ROMs").ToEqual(1)
+	Expect(t, results[0].Status(), "status").ToEqual("no reference")
+}
+
+func TestMatrix(t *testing.T) {
+	dir := t.TempDir()
+
+	white := Run(testROM(0x0C, 0x20, 0xFE), Options{Frames: 1}).Screen
+	Must(t, os.WriteFile(filepath.Join(dir, "pass.gb"), testROM(0x0C, 0x20, 0xFE), 0o644), "Expected no error writing: %v")
+	Must(t, WritePNG(filepath.Join(dir, "pass.png"), white), "Expected no error writing: %v")
+	Must(t, os.WriteFile(filepath.Join(dir, "fail.gb"), testROM(0x0C, 0x20, 0xFE), 0o644), "Expected no error writing: %v")
+	Must(t, WritePNG(filepath.Join(dir, "fail.png"), image.NewRGBA(white.Bounds())), "Expected no error writing: %v")
+
+	results, err := RunDirectory(dir, Options{Frames: 2})
+	Must(t, err, "Expected no error running the directory: %v")
+	Expect(t, results[0].Status(), "fail.gb").ToEqual("FAIL (23040 pixels)")
+	Expect(t, results[1].Status(), "pass.gb").ToEqual("pass")
+
+	var matrix strings.Builder
+	Must(t, WriteMatrix(&matrix, results), "Expected no error writing the matrix: %v")
+	Expect(t, strings.Contains(matrix.String(), "1/2 passed"), "totals").ToEqual(true)
+}
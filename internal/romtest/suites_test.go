@@ -0,0 +1,42 @@
+package romtest
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"testing"
+
+	. "github.com/carvhal/gby/internal/testutils"
+)
+
+// testSuite runs the ROMs of dir as subtests, comparing their screen with their reference,
+// it skips without the directory as the test ROMs are not distributed with the emulator
+func testSuite(t *testing.T, dir string, options Options) {
+	t.Helper()
+
+	roms, err := ROMs(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		t.Skipf("no test ROMs in %s", dir)
+	}
+	Must(t, err, "Expected to list the test ROMs: %v")
+
+	for _, rom := range roms {
+		t.Run(filepath.Base(rom), func(t *testing.T) {
+			result := RunFile(rom, options)
+			Must(t, result.Err, "Expected the ROM to run and have a reference: %v")
+			Expect(t, result.Diff, "pixels differing from "+result.Reference).ToEqual(0)
+		})
+	}
+}
+
+func TestDMGAcid2(t *testing.T) {
+	testSuite(t, Dir("dmg-acid2"), Options{})
+}
+
+func TestCGBAcid2(t *testing.T) {
+	testSuite(t, Dir("cgb-acid2"), Options{})
+}
+
+func TestMealybug(t *testing.T) {
+	testSuite(t, Dir("mealybug"), Options{})
+}
@@ -0,0 +1,250 @@
+package savestate
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/carvhal/gby/internal/common"
+	"github.com/carvhal/gby/internal/cpu"
+	"github.com/carvhal/gby/internal/memory"
+)
+
+/*
+* Save state file, little endian
+*
+* offset | size | description
+*
+* 0      | 8    | magic "GBYSTATE"
+* 8      | 2    | format version
+* 10     | 4    | CRC32 of the ROM
+* 14     | 1    | length n of the emulator version
+* 15     | n    | emulator version
+*
+* followed by sections until the end of the file
+*
+* offset | size | description
+*
+* 0      | 4    | tag of the component: "CPU ", "BUS ", "PPU ", "JOYP", "CART", "SGB ", "SER "
+* 4      | 4    | length n of the state
+* 8      | n    | state of the component
+*
+* sections unknown to a version are skipped and components without a section keep their state,
+* so that states stay readable when components are added, components append the fields they gain
+* to their section, the fields missing from older states are zeroed and the ones of newer states ignored
+*
+ */
+
+// FORMAT_VERSION is the version of the save state format written, states of newer formats are refused
+const FORMAT_VERSION = 1
+
+const magic = "GBYSTATE"
+
+// section tags
+const (
+	CPU_SECTION       = "CPU "
+	BUS_SECTION       = "BUS "
+	PPU_SECTION       = "PPU "
+	JOYPAD_SECTION    = "JOYP"
+	CARTRIDGE_SECTION = "CART"
+	SGB_SECTION       = "SGB "
+	SERIAL_SECTION    = "SER "
+)
+
+// ErrWrongROM is returned when loading a state saved with another ROM
+var ErrWrongROM = errors.New("save state of another ROM")
+
+// Header describes a save state
+type Header struct {
+	Format          uint16
+	ROMChecksum     uint32
+	EmulatorVersion string
+}
+
+// component is a part of the machine saving its own state
+type component interface {
+	SaveState() []byte
+	LoadState(data []byte) error
+}
+
+// order is the order the sections are written and loaded in, the CPU comes last
+var order = []string{CARTRIDGE_SECTION, BUS_SECTION, PPU_SECTION, JOYPAD_SECTION, SERIAL_SECTION, SGB_SECTION, CPU_SECTION}
+
+// components returns the components of the machine by section tag
+func components(c *cpu.CPU, bus *memory.Controller) map[string]component {
+	m := map[string]component{
+		CARTRIDGE_SECTION: bus.Mapper(),
+		BUS_SECTION:       bus,
+		PPU_SECTION:       bus.PPU(),
+		JOYPAD_SECTION:    bus.Joypad(),
+		SERIAL_SECTION:    bus.Serial(),
+		CPU_SECTION:       c,
+	}
+
+	if bus.SGB() != nil {
+		m[SGB_SECTION] = bus.SGB()
+	}
+
+	return m
+}
+
+// Encode returns the state of the whole machine
+func Encode(c *cpu.CPU, bus *memory.Controller) []byte {
+	data := []byte(magic)
+	data = binary.LittleEndian.AppendUint16(data, FORMAT_VERSION)
+	data = binary.LittleEndian.AppendUint32(data, bus.ROMChecksum())
+	data = append(data, byte(len(common.VERSION)))
+	data = append(data, common.VERSION...)
+
+	machine := components(c, bus)
+	for _, tag := range order {
+		component, ok := machine[tag]
+		if !ok {
+			continue
+		}
+
+		state := component.SaveState()
+		data = append(data, tag...)
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(state)))
+		data = append(data, state...)
+	}
+
+	return data
+}
+
+// ReadHeader returns the header of a state and the sections following it
+func ReadHeader(data []byte) (Header, []byte, error) {
+	if len(data) < len(magic)+7 || string(data[:len(magic)]) != magic {
+		return Header{}, nil, errors.New("not a save state")
+	}
+	data = data[len(magic):]
+
+	header := Header{
+		Format:      binary.LittleEndian.Uint16(data),
+		ROMChecksum: binary.LittleEndian.Uint32(data[2:]),
+	}
+
+	length := int(data[6])
+	data = data[7:]
+	if len(data) < length {
+		return Header{}, nil, errors.New("truncated save state header")
+	}
+	header.EmulatorVersion = string(data[:length])
+
+	return header, data[length:], nil
+}
+
+// readSections splits the sections of a state by tag
+func readSections(data []byte) (map[string][]byte, error) {
+	sections := make(map[string][]byte)
+
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return nil, errors.New("truncated save state section")
+		}
+
+		tag := string(data[:4])
+		length := binary.LittleEndian.Uint32(data[4:])
+		data = data[8:]
+
+		if uint64(len(data)) < uint64(length) {
+			return nil, fmt.Errorf("truncated save state section %q", tag)
+		}
+
+		sections[tag] = data[:length]
+		data = data[length:]
+	}
+
+	return sections, nil
+}
+
+// Decode restores the state of the whole machine, the machine is left as it was when a component
+// fails to load its section
+func Decode(data []byte, c *cpu.CPU, bus *memory.Controller) error {
+	header, data, err := ReadHeader(data)
+	if err != nil {
+		return err
+	}
+
+	if header.Format > FORMAT_VERSION {
+		return fmt.Errorf("save state format %d is newer than the supported format %d (saved by gby %s)", header.Format, FORMAT_VERSION, header.EmulatorVersion)
+	}
+
+	if header.ROMChecksum != bus.ROMChecksum() {
+		return fmt.Errorf("%w: ROM CRC32 %08X, running %08X", ErrWrongROM, header.ROMChecksum, bus.ROMChecksum())
+	}
+
+	saved, err := readSections(data)
+	if err != nil {
+		return err
+	}
+
+	machine := components(c, bus)
+	if _, ok := saved[SGB_SECTION]; ok && machine[SGB_SECTION] == nil {
+		return errors.New("save state of a machine in SGB mode")
+	}
+
+	// the sections of the current state always load back
+	_, current, _ := ReadHeader(Encode(c, bus))
+	backup, _ := readSections(current)
+
+	if err := load(machine, saved); err != nil {
+		load(machine, backup)
+		return err
+	}
+
+	return nil
+}
+
+// load restores the components from their sections, in order
+func load(machine map[string]component, sections map[string][]byte) error {
+	for _, tag := range order {
+		state, ok := sections[tag]
+		if !ok || machine[tag] == nil {
+			continue
+		}
+
+		if err := machine[tag].LoadState(state); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Save writes the state of the whole machine to w
+func Save(w io.Writer, c *cpu.CPU, bus *memory.Controller) error {
+	_, err := w.Write(Encode(c, bus))
+	return err
+}
+
+// Load restores the state of the whole machine from r
+func Load(r io.Reader, c *cpu.CPU, bus *memory.Controller) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	return Decode(data, c, bus)
+}
+
+// SaveFile writes the state of the whole machine to the file at path
+func SaveFile(path string, c *cpu.CPU, bus *memory.Controller) error {
+	return os.WriteFile(path, Encode(c, bus), 0o644)
+}
+
+// LoadFile restores the state of the whole machine from the file at path
+func LoadFile(path string, c *cpu.CPU, bus *memory.Controller) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if err := Decode(data, c, bus); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	return nil
+}
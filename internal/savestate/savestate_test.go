@@ -0,0 +1,145 @@
+package savestate
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/carvhal/gby/internal/cpu"
+	"github.com/carvhal/gby/internal/memory"
+	. "github.com/carvhal/gby/internal/testutils"
+	"github.com/carvhal/gby/internal/testutils/testmachine"
+)
+
+func testROM() []byte {
+	return testmachine.ROM(0x0000,
+		0x31, 0xFE, 0xFF, // LD SP, $FFFE
+		0x21, 0x00, 0xC0, // LD HL, $C000
+		0x0E, 0x00, // LD C, $00
+		0x0C,       // INC C
+		0x77,       // LD [HL], A
+		0x20, 0xFC, // JR NZ, -4
+		0xC7, // RST $00
+	)
+}
+
+func run(t *testing.T, c *cpu.CPU, bus *memory.Controller, instructions int) {
+	for i := 0; i < instructions; i++ {
+		cycles, err := c.Tick()
+		if err != nil {
+			t.Fatalf("Expected no error running: %v", err)
+		}
+		bus.Step(cycles)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	rom := testROM()
+
+	c, bus := testmachine.New(rom)
+	run(t, c, bus, 500)
+	Must(t, bus.WriteToAddress(0xC010, []byte{0x42}), "Expected no error writing: %v")
+	state := Encode(c, bus)
+
+	run(t, c, bus, 1000)
+	expected := Encode(c, bus)
+
+	restored, restoredBus := testmachine.New(rom)
+	Must(t, Decode(state, restored, restoredBus), "Expected no error loading the state: %v")
+	Expect(t, Encode(restored, restoredBus), "state after loading").ToEqual(state)
+
+	value, _ := restoredBus.ReadFromAddress(0xC010, 1)
+	Expect(t, value[0], "work RAM").ToEqual(byte(0x42))
+
+	run(t, restored, restoredBus, 1000)
+	Expect(t, Encode(restored, restoredBus), "state after running from the loaded state").ToEqual(expected)
+}
+
+func TestHeader(t *testing.T) {
+	c, bus := testmachine.New(testROM())
+	state := Encode(c, bus)
+
+	header, _, err := ReadHeader(state)
+	Must(t, err, "Expected no error reading the header: %v")
+	Expect(t, header.Format, "format").ToEqual(uint16(FORMAT_VERSION))
+	Expect(t, header.ROMChecksum, "checksum").ToEqual(bus.ROMChecksum())
+
+	other := testROM()
+	other[0x7FFF] = 0x01
+	otherCPU, otherBus := testmachine.New(other)
+	err = Decode(state, otherCPU, otherBus)
+	Expect(t, errors.Is(err, ErrWrongROM), "state of another ROM refused").ToEqual(true)
+
+	newer := append([]byte(nil), state...)
+	binary.LittleEndian.PutUint16(newer[len(magic):], FORMAT_VERSION+1)
+	Expect(t, Decode(newer, c, bus) != nil, "newer format refused").ToEqual(true)
+}
+
+func TestUnknownSection(t *testing.T) {
+	c, bus := testmachine.New(testROM())
+	run(t, c, bus, 100)
+
+	state := Encode(c, bus)
+	state = append(state, "NEW "...)
+	state = binary.LittleEndian.AppendUint32(state, 2)
+	state = append(state, 0xAB, 0xCD)
+
+	restored, restoredBus := testmachine.New(testROM())
+	Must(t, Decode(state, restored, restoredBus), "Expected sections of newer versions to be skipped: %v")
+	Expect(t, restored.PC, "PC").ToEqual(c.PC)
+}
+
+// rewrite returns state with the section tag replaced by edit of it
+func rewrite(t *testing.T, state []byte, tag string, edit func(section []byte) []byte) []byte {
+	_, rest, err := ReadHeader(state)
+	Must(t, err, "Expected no error reading the header: %v")
+	sections, err := readSections(rest)
+	Must(t, err, "Expected no error reading the sections: %v")
+
+	rewritten := append([]byte(nil), state[:len(state)-len(rest)]...)
+	for _, name := range order {
+		section, ok := sections[name]
+		if !ok {
+			continue
+		}
+		if name == tag {
+			section = edit(section)
+		}
+
+		rewritten = append(rewritten, name...)
+		rewritten = binary.LittleEndian.AppendUint32(rewritten, uint32(len(section)))
+		rewritten = append(rewritten, section...)
+	}
+
+	return rewritten
+}
+
+func TestShortSection(t *testing.T) {
+	c, bus := testmachine.New(testROM())
+	run(t, c, bus, 100)
+
+	// the CPU section of a version saving neither IME, the lock up nor the low power modes
+	older := rewrite(t, Encode(c, bus), CPU_SECTION, func(section []byte) []byte { return section[:len(section)-5] })
+
+	restored, restoredBus := testmachine.New(testROM())
+	restored.SetSP(0x1234)
+	Must(t, Decode(older, restored, restoredBus), "Expected a section shorter than the current layout to load: %v")
+	Expect(t, restored.PC, "PC").ToEqual(c.PC)
+	Expect(t, restored.SP(), "SP").ToEqual(c.SP())
+	Expect(t, restored.IME(), "missing IME").ToEqual(false)
+}
+
+func TestFailedDecode(t *testing.T) {
+	c, bus := testmachine.New(testROM())
+	run(t, c, bus, 500)
+
+	// the CPU, loaded last, ends in the middle of SP
+	broken := rewrite(t, Encode(c, bus), CPU_SECTION, func(section []byte) []byte { return section[:9] })
+
+	restored, restoredBus := testmachine.New(testROM())
+	run(t, restored, restoredBus, 100)
+	expected := Encode(restored, restoredBus)
+
+	Expect(t, Decode(broken, restored, restoredBus) != nil, "Expected an error loading a broken section").ToEqual(true)
+	Expect(t, Encode(restored, restoredBus), "state after the failed load").ToEqual(expected)
+}
@@ -0,0 +1,266 @@
+package sgb
+
+// command codes, stored in bits 3-7 of the first byte of a command
+const (
+	PAL01    byte = 0x00
+	PAL23    byte = 0x01
+	PAL03    byte = 0x02
+	PAL12    byte = 0x03
+	ATTR_BLK byte = 0x04
+	ATTR_LIN byte = 0x05
+	ATTR_DIV byte = 0x06
+	ATTR_CHR byte = 0x07
+	PAL_SET  byte = 0x0A
+	PAL_TRN  byte = 0x0B
+	MLT_REQ  byte = 0x11
+	CHR_TRN  byte = 0x13
+	PCT_TRN  byte = 0x14
+	ATTR_TRN byte = 0x15
+	ATTR_SET byte = 0x16
+	MASK_EN  byte = 0x17
+)
+
+// run executes a complete command, unsupported commands (sound, SNES code upload...) are ignored
+func (s *SGB) run(command []byte) {
+	code := command[0] >> 3
+
+	switch code {
+	case PAL01:
+		s.setPalettes(command, 0, 1)
+	case PAL23:
+		s.setPalettes(command, 2, 3)
+	case PAL03:
+		s.setPalettes(command, 0, 3)
+	case PAL12:
+		s.setPalettes(command, 1, 2)
+	case ATTR_BLK:
+		s.attrBlock(command)
+	case ATTR_LIN:
+		s.attrLine(command)
+	case ATTR_DIV:
+		s.attrDivide(command)
+	case ATTR_CHR:
+		s.attrCharacter(command)
+	case PAL_SET:
+		s.palSet(command)
+	case ATTR_SET:
+		s.applyAttributeFile(command[1])
+		s.cancelMask(command[1])
+	case MLT_REQ:
+		s.multiplayer(command[1])
+	case MASK_EN:
+		s.mask = mask(command[1] & 0x03)
+	case PAL_TRN, CHR_TRN, PCT_TRN, ATTR_TRN:
+		// the data is read from the next frame
+		s.transfer = code
+		s.transferParam = command[1]
+	}
+}
+
+// runTransfer stores the 4KB of screen data of a pending *_TRN command
+func (s *SGB) runTransfer(data []byte) {
+	switch s.transfer {
+	case PAL_TRN:
+		for i := range s.systemPalettes {
+			for c := range s.systemPalettes[i] {
+				s.systemPalettes[i][c] = readWord(data, i*8+c*2)
+			}
+		}
+	case CHR_TRN:
+		offset := int(s.transferParam&0x01) * 128
+		for i := 0; i < 128; i++ {
+			copy(s.borderTiles[offset+i][:], data[i*32:])
+		}
+	case PCT_TRN:
+		for i := range s.borderMap {
+			s.borderMap[i] = readWord(data, i*2)
+		}
+		for p := range s.borderPalettes {
+			for c := range s.borderPalettes[p] {
+				s.borderPalettes[p][c] = readWord(data, 0x800+p*32+c*2)
+			}
+		}
+	case ATTR_TRN:
+		// 45 files of 90 bytes, 4 cells per byte MSB first
+		for file := range s.attributeFiles {
+			for cell := 0; cell < rows*columns; cell++ {
+				value := data[file*90+cell/4] >> (6 - (cell%4)*2) & 0x03
+				s.attributeFiles[file][cell/columns][cell%columns] = value
+			}
+		}
+	}
+}
+
+// readWord reads a little endian 16-bit value
+func readWord(data []byte, offset int) uint16 {
+	return uint16(data[offset]) | uint16(data[offset+1])<<8
+}
+
+// setPalettes implements PAL01, PAL23, PAL03 and PAL12: color 0 is shared by every palette
+func (s *SGB) setPalettes(command []byte, first, second int) {
+	color0 := readWord(command, 1)
+
+	for i := range s.palettes {
+		s.palettes[i][0] = color0
+	}
+
+	for c := 1; c < 4; c++ {
+		s.palettes[first][c] = readWord(command, 1+c*2)
+		s.palettes[second][c] = readWord(command, 7+c*2)
+	}
+}
+
+// attrBlock implements ATTR_BLK: every data set colors the inside, the border and the outside of a rectangle
+func (s *SGB) attrBlock(command []byte) {
+	sets := int(command[1] & 0x1F)
+
+	for set := 0; set < sets && 2+set*6+5 < len(command); set++ {
+		data := command[2+set*6:]
+		control, palettes := data[0]&0x07, data[1]
+		x1, y1, x2, y2 := int(data[2]&0x1F), int(data[3]&0x1F), int(data[4]&0x1F), int(data[5]&0x1F)
+
+		inside, line, outside := palettes&0x03, (palettes>>2)&0x03, (palettes>>4)&0x03
+
+		// when only the inside or the outside is changed, the border takes the same palette
+		switch control {
+		case 0x01:
+			control, line = 0x03, inside
+		case 0x04:
+			control, line = 0x06, outside
+		}
+
+		for y := 0; y < rows; y++ {
+			for x := 0; x < columns; x++ {
+				switch {
+				case x > x1 && x < x2 && y > y1 && y < y2:
+					if control&0x01 != 0 {
+						s.attributes[y][x] = inside
+					}
+				case x >= x1 && x <= x2 && y >= y1 && y <= y2:
+					if control&0x02 != 0 {
+						s.attributes[y][x] = line
+					}
+				default:
+					if control&0x04 != 0 {
+						s.attributes[y][x] = outside
+					}
+				}
+			}
+		}
+	}
+}
+
+// attrLine implements ATTR_LIN: every data byte colors a whole row (bit 7 set) or column
+func (s *SGB) attrLine(command []byte) {
+	sets := int(command[1])
+
+	for set := 0; set < sets && 2+set < len(command); set++ {
+		data := command[2+set]
+		line, palette := int(data&0x1F), (data>>5)&0x03
+
+		if data&0x80 != 0 {
+			for x := 0; x < columns && line < rows; x++ {
+				s.attributes[line][x] = palette
+			}
+			continue
+		}
+
+		for y := 0; y < rows && line < columns; y++ {
+			s.attributes[y][line] = palette
+		}
+	}
+}
+
+// attrDivide implements ATTR_DIV: the screen is split by a row or a column
+func (s *SGB) attrDivide(command []byte) {
+	after, before, onLine := command[1]&0x03, (command[1]>>2)&0x03, (command[1]>>4)&0x03
+	horizontal := command[1]&0x40 != 0
+	coordinate := int(command[2] & 0x1F)
+
+	for y := 0; y < rows; y++ {
+		for x := 0; x < columns; x++ {
+			position := x
+			if horizontal {
+				position = y
+			}
+
+			switch {
+			case position < coordinate:
+				s.attributes[y][x] = before
+			case position == coordinate:
+				s.attributes[y][x] = onLine
+			default:
+				s.attributes[y][x] = after
+			}
+		}
+	}
+}
+
+// attrCharacter implements ATTR_CHR: palettes of consecutive cells starting at X, Y, 4 per byte MSB first
+func (s *SGB) attrCharacter(command []byte) {
+	x, y := int(command[1]%columns), int(command[2]%rows)
+	count := int(readWord(command, 3))
+	vertical := command[5] != 0
+
+	for i := 0; i < count && 6+i/4 < len(command); i++ {
+		s.attributes[y][x] = command[6+i/4] >> (6 - (i%4)*2) & 0x03
+
+		if vertical {
+			y++
+			if y == rows {
+				y, x = 0, (x+1)%columns
+			}
+			continue
+		}
+
+		x++
+		if x == columns {
+			x, y = 0, (y+1)%rows
+		}
+	}
+}
+
+// palSet implements PAL_SET: palettes 0-3 are copied from the system palettes and an attribute file may be applied
+func (s *SGB) palSet(command []byte) {
+	for i := range s.palettes {
+		index := readWord(command, 1+i*2) & 0x01FF
+		s.palettes[i] = s.systemPalettes[index]
+	}
+
+	// color 0 of palette 0 is shared by every palette
+	for i := range s.palettes {
+		s.palettes[i][0] = s.palettes[0][0]
+	}
+
+	if command[9]&0x80 != 0 {
+		s.applyAttributeFile(command[9])
+	}
+
+	s.cancelMask(command[9])
+}
+
+// applyAttributeFile copies one of the attribute files received by ATTR_TRN (bits 0-5)
+func (s *SGB) applyAttributeFile(value byte) {
+	if file := int(value & 0x3F); file < len(s.attributeFiles) {
+		s.attributes = s.attributeFiles[file]
+	}
+}
+
+// cancelMask cancels the screen mask if bit 6 is set, as done by PAL_SET and ATTR_SET
+func (s *SGB) cancelMask(value byte) {
+	if value&0x40 != 0 {
+		s.mask = MASK_CANCEL
+	}
+}
+
+// multiplayer implements MLT_REQ: 0 one player, 1 two players, 3 four players
+func (s *SGB) multiplayer(value byte) {
+	switch value & 0x03 {
+	case 0x01:
+		s.joypad.SetPlayers(2)
+	case 0x03:
+		s.joypad.SetPlayers(4)
+	default:
+		s.joypad.SetPlayers(1)
+	}
+}
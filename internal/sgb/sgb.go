@@ -0,0 +1,253 @@
+package sgb
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/carvhal/gby/internal/joypad"
+	"github.com/carvhal/gby/internal/ppu"
+)
+
+/*
+* Packet protocol
+*
+* commands are sent through bits 4 and 5 of P1, every pulse is followed by a write of 0x30
+*
+* P1 & 0x30 | meaning
+*
+* 0x00      | reset, a packet starts
+* 0x10      | bit 1
+* 0x20      | bit 0
+*
+* a packet is 16 bytes sent LSB first followed by a 0 stop bit, the first byte of the first packet
+* holds the command (bits 3-7) and the number of packets of the command (bits 0-2)
+*
+ */
+
+const (
+	Width  = 256
+	Height = 224
+
+	// position of the game window inside the SGB screen
+	windowX = (Width - ppu.ScreenWidth) / 2
+	windowY = (Height - ppu.ScreenHeight) / 2
+
+	packetSize = 16
+	packetBits = packetSize * 8
+
+	columns = ppu.ScreenWidth / 8
+	rows    = ppu.ScreenHeight / 8
+)
+
+// mask is the screen mask set by MASK_EN
+type mask byte
+
+const (
+	MASK_CANCEL mask = iota
+	MASK_FREEZE
+	MASK_BLACK
+	MASK_COLOR_0
+)
+
+// SGB decodes the Super Game Boy command packets and composes the game window, colorized by the SGB palettes,
+// with the border into a 256x224 framebuffer
+type SGB struct {
+	joypad *joypad.Joypad
+
+	// packet receiver
+	receiving  bool
+	previousP1 byte
+	bit        int
+	packet     [packetSize]byte
+	command    []byte
+
+	palettes       [4][4]uint16 // palettes 0-3 used by the game window
+	systemPalettes [512][4]uint16
+	attributes     [rows][columns]byte // palette number of every 8x8 cell of the game window
+	attributeFiles [45][rows][columns]byte
+	borderTiles    [256][32]byte // 4bpp SNES tiles
+	borderMap      [32 * 32]uint16
+	borderPalettes [4][16]uint16 // SNES palettes 4-7
+	mask           mask
+	transfer       byte // command waiting for the next frame to read VRAM, 0 if none
+	transferParam  byte
+
+	framebuffer *image.RGBA
+}
+
+func New(j *joypad.Joypad) *SGB {
+	s := &SGB{
+		joypad:      j,
+		previousP1:  0x30,
+		framebuffer: image.NewRGBA(image.Rect(0, 0, Width, Height)),
+	}
+
+	// power on palette, shades of grey
+	for i := range s.palettes {
+		s.palettes[i] = [4]uint16{0x7FFF, 0x56B5, 0x294A, 0x0000}
+	}
+
+	return s
+}
+
+// Supported checks the SGB flag (0x0146) and the old licensee code (0x014B) of the cartridge header
+func Supported(game []byte) bool {
+	return len(game) > 0x014B && game[0x0146] == 0x03 && game[0x014B] == 0x33
+}
+
+// Framebuffer returns the last composed SGB screen
+func (s *SGB) Framebuffer() *image.RGBA {
+	return s.framebuffer
+}
+
+// WriteP1 receives the bits of a command packet written to P1
+func (s *SGB) WriteP1(value byte) {
+	value &= 0x30
+	previous := s.previousP1
+	s.previousP1 = value
+
+	if value == 0x00 {
+		s.receiving = true
+		s.bit = 0
+		s.packet = [packetSize]byte{}
+		return
+	}
+
+	// a bit is only sent by a pulse starting from the idle state
+	if !s.receiving || previous != 0x30 || value == 0x30 {
+		return
+	}
+
+	if s.bit == packetBits {
+		// stop bit
+		s.receiving = false
+		s.receivePacket()
+		return
+	}
+
+	if value == 0x10 {
+		s.packet[s.bit/8] |= 1 << (s.bit % 8)
+	}
+
+	s.bit++
+}
+
+// receivePacket adds a packet to the current command and runs it once all of its packets are received
+func (s *SGB) receivePacket() {
+	s.command = append(s.command, s.packet[:]...)
+
+	length := int(s.command[0] & 0x07)
+	if length == 0 {
+		length = 1
+	}
+
+	if len(s.command) < length*packetSize {
+		return
+	}
+
+	s.run(s.command)
+	s.command = nil
+}
+
+// Frame is called when the PPU enters VBlank, it runs pending VRAM transfers from the frame
+// just displayed and composes the SGB screen
+func (s *SGB) Frame(shades []byte) {
+	if s.transfer != 0 {
+		s.runTransfer(screenData(shades))
+		s.transfer = 0
+	}
+
+	s.compose(shades)
+}
+
+// screenData rebuilds the 4KB of tile data displayed on screen as 256 tiles of 2bpp data, read left to right, top to bottom
+func screenData(shades []byte) []byte {
+	data := make([]byte, 0, 0x1000)
+
+	for tile := 0; tile < 256; tile++ {
+		column, row := tile%columns, tile/columns
+
+		for y := 0; y < 8; y++ {
+			var lo, hi byte
+
+			for x := 0; x < 8; x++ {
+				shade := shades[(row*8+y)*ppu.ScreenWidth+column*8+x]
+				lo |= (shade & 1) << (7 - x)
+				hi |= (shade >> 1) << (7 - x)
+			}
+
+			data = append(data, lo, hi)
+		}
+	}
+
+	return data
+}
+
+// compose draws the border and the colorized game window into the framebuffer
+func (s *SGB) compose(shades []byte) {
+	backdrop := ppu.RGB555ToRGBA(s.palettes[0][0])
+
+	for y := 0; y < Height; y++ {
+		for x := 0; x < Width; x++ {
+			insideWindow := x >= windowX && x < windowX+ppu.ScreenWidth && y >= windowY && y < windowY+ppu.ScreenHeight
+
+			switch {
+			case insideWindow:
+				s.composeGamePixel(x-windowX, y-windowY, shades)
+			default:
+				c, ok := s.borderPixel(x, y)
+				if !ok {
+					c = backdrop
+				}
+				s.framebuffer.SetRGBA(x, y, c)
+			}
+		}
+	}
+}
+
+// composeGamePixel draws a pixel of the game window according to its attribute and the screen mask
+func (s *SGB) composeGamePixel(x, y int, shades []byte) {
+	var c color.RGBA
+
+	switch s.mask {
+	case MASK_FREEZE:
+		return
+	case MASK_BLACK:
+		c = color.RGBA{A: 0xFF}
+	case MASK_COLOR_0:
+		c = ppu.RGB555ToRGBA(s.palettes[0][0])
+	default:
+		palette := s.attributes[y/8][x/8]
+		c = ppu.RGB555ToRGBA(s.palettes[palette][shades[y*ppu.ScreenWidth+x]])
+	}
+
+	s.framebuffer.SetRGBA(x+windowX, y+windowY, c)
+}
+
+// borderPixel returns the border color at x, y, ok is false for transparent pixels
+func (s *SGB) borderPixel(x, y int) (c color.RGBA, ok bool) {
+	entry := s.borderMap[(y/8)*32+x/8]
+	tile := &s.borderTiles[entry&0xFF]
+	palette := (entry >> 10) & 0x07
+	row, column := y%8, x%8
+
+	if entry&0x8000 != 0 {
+		row = 7 - row
+	}
+	if entry&0x4000 != 0 {
+		column = 7 - column
+	}
+
+	// SNES 4bpp tiles: planes 0 and 1 interleaved in the first 16 bytes, planes 2 and 3 in the next 16
+	bit := 7 - column
+	colorID := (tile[row*2]>>bit)&1 |
+		((tile[row*2+1]>>bit)&1)<<1 |
+		((tile[16+row*2]>>bit)&1)<<2 |
+		((tile[16+row*2+1]>>bit)&1)<<3
+
+	if colorID == 0 || palette < 4 {
+		return c, false
+	}
+
+	return ppu.RGB555ToRGBA(s.borderPalettes[palette-4][colorID]), true
+}
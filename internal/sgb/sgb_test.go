@@ -0,0 +1,120 @@
+package sgb
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/carvhal/gby/internal/joypad"
+	"github.com/carvhal/gby/internal/ppu"
+	. "github.com/carvhal/gby/internal/testutils"
+)
+
+// send bit-bangs a command through P1, padding it to whole packets
+func send(s *SGB, command ...byte) {
+	for len(command)%packetSize != 0 {
+		command = append(command, 0)
+	}
+
+	for packet := 0; packet < len(command); packet += packetSize {
+		s.WriteP1(0x00)
+		s.WriteP1(0x30)
+
+		for _, value := range command[packet : packet+packetSize] {
+			for bit := 0; bit < 8; bit++ {
+				if value&(1<<bit) != 0 {
+					s.WriteP1(0x10)
+				} else {
+					s.WriteP1(0x20)
+				}
+				s.WriteP1(0x30)
+			}
+		}
+
+		// stop bit
+		s.WriteP1(0x20)
+		s.WriteP1(0x30)
+	}
+}
+
+func TestPalettesAndAttributes(t *testing.T) {
+	s := New(joypad.New())
+
+	// palette 0: color 0 red, color 1 green; palette 1: color 1 blue
+	send(s, PAL01<<3|1, 0x1F, 0x00, 0xE0, 0x03, 0, 0, 0, 0, 0x00, 0x7C)
+
+	// everything left of column 10 uses palette 0, the rest palette 1
+	send(s, ATTR_DIV<<3|1, 0x01|0x00<<2|0x01<<4, 10)
+
+	shades := make([]byte, ppu.ScreenWidth*ppu.ScreenHeight)
+	for i := range shades {
+		shades[i] = 1
+	}
+	shades[0] = 0
+
+	s.Frame(shades)
+
+	Expect(t, s.Framebuffer().RGBAAt(windowX, windowY), "color 0").ToEqual(color.RGBA{R: 0xFF, A: 0xFF})
+	Expect(t, s.Framebuffer().RGBAAt(windowX+8, windowY), "palette 0").ToEqual(color.RGBA{G: 0xFF, A: 0xFF})
+	Expect(t, s.Framebuffer().RGBAAt(windowX+80, windowY), "palette 1").ToEqual(color.RGBA{B: 0xFF, A: 0xFF})
+	Expect(t, s.Framebuffer().RGBAAt(0, 0), "backdrop").ToEqual(color.RGBA{R: 0xFF, A: 0xFF})
+
+	send(s, MASK_EN<<3|1, byte(MASK_BLACK))
+	s.Frame(shades)
+
+	Expect(t, s.Framebuffer().RGBAAt(windowX+8, windowY), "masked").ToEqual(color.RGBA{A: 0xFF})
+}
+
+func TestAttrBlock(t *testing.T) {
+	s := New(joypad.New())
+
+	// inside only, palette 2, from (2, 2) to (5, 5): the border takes the inside palette
+	send(s, ATTR_BLK<<3|1, 1, 0x01, 0x02, 2, 2, 5, 5)
+
+	Expect(t, s.attributes[3][3], "inside").ToEqual(byte(2))
+	Expect(t, s.attributes[2][5], "border").ToEqual(byte(2))
+	Expect(t, s.attributes[6][6], "outside").ToEqual(byte(0))
+}
+
+func TestMultiplayer(t *testing.T) {
+	j := joypad.New()
+	s := New(j)
+
+	send(s, MLT_REQ<<3|1, 0x01)
+
+	j.Write(0x30)
+	Expect(t, j.Read()&0x0F, "player 1").ToEqual(byte(0x0F))
+
+	j.Write(0x10)
+	j.Write(0x30)
+	Expect(t, j.Read()&0x0F, "player 2").ToEqual(byte(0x0E))
+}
+
+func TestBorderTransfer(t *testing.T) {
+	s := New(joypad.New())
+
+	// every pixel has shade 1: bitplanes 0 and 2 of every SNES tile are set, giving color 5 everywhere
+	shades := make([]byte, ppu.ScreenWidth*ppu.ScreenHeight)
+	for i := range shades {
+		shades[i] = 1
+	}
+
+	send(s, CHR_TRN<<3|1, 0)
+	s.Frame(shades)
+
+	Expect(t, s.borderTiles[0x7F][16], "last tile of the transfer").ToEqual(byte(0xFF))
+	Expect(t, s.borderTiles[0x80][16], "upper tiles untouched").ToEqual(byte(0x00))
+
+	// map entries use tile 0 with palette 4, color 5 of palette 4 is blue
+	data := make([]byte, 0x1000)
+	for i := 0; i < 0x800; i += 2 {
+		data[i+1] = 0x10
+	}
+	data[0x800+5*2], data[0x800+5*2+1] = 0x00, 0x7C
+
+	s.transfer = PCT_TRN
+	s.runTransfer(data)
+
+	c, ok := s.borderPixel(0, 0)
+	Expect(t, ok, "opaque border").ToEqual(true)
+	Expect(t, c, "border color").ToEqual(color.RGBA{B: 0xFF, A: 0xFF})
+}
@@ -0,0 +1,104 @@
+package sgb
+
+import (
+	"fmt"
+
+	"github.com/carvhal/gby/internal/common"
+)
+
+// SaveState returns the packet receiver, the palettes, attributes and border, for save states of the whole machine,
+// the SGB screen is composed again on the next frame
+func (s *SGB) SaveState() []byte {
+	var state common.StateEncoder
+	state.Bool(s.receiving)
+	state.Byte(s.previousP1)
+	state.Int(s.bit)
+	state.Bytes(s.packet[:])
+	state.Int(len(s.command))
+	state.Bytes(s.command)
+
+	for i := range s.palettes {
+		saveColors(&state, s.palettes[i][:])
+	}
+	for i := range s.systemPalettes {
+		saveColors(&state, s.systemPalettes[i][:])
+	}
+	for row := range s.attributes {
+		state.Bytes(s.attributes[row][:])
+	}
+	for file := range s.attributeFiles {
+		for row := range s.attributeFiles[file] {
+			state.Bytes(s.attributeFiles[file][row][:])
+		}
+	}
+	for tile := range s.borderTiles {
+		state.Bytes(s.borderTiles[tile][:])
+	}
+	saveColors(&state, s.borderMap[:])
+	for i := range s.borderPalettes {
+		saveColors(&state, s.borderPalettes[i][:])
+	}
+
+	state.Byte(byte(s.mask))
+	state.Byte(s.transfer)
+	state.Byte(s.transferParam)
+
+	return state.Data
+}
+
+// LoadState restores a state returned by SaveState
+func (s *SGB) LoadState(data []byte) error {
+	state := common.StateDecoder{Data: data}
+	s.receiving = state.Bool()
+	s.previousP1 = state.Byte()
+	s.bit = state.Int()
+	state.Bytes(s.packet[:])
+
+	length := state.Int()
+	if s.bit < 0 || s.bit > packetBits || length < 0 || length > 7*packetSize {
+		return fmt.Errorf("sgb: invalid packet receiver in save state")
+	}
+	s.command = make([]byte, length)
+	state.Bytes(s.command)
+
+	for i := range s.palettes {
+		loadColors(&state, s.palettes[i][:])
+	}
+	for i := range s.systemPalettes {
+		loadColors(&state, s.systemPalettes[i][:])
+	}
+	for row := range s.attributes {
+		state.Bytes(s.attributes[row][:])
+	}
+	for file := range s.attributeFiles {
+		for row := range s.attributeFiles[file] {
+			state.Bytes(s.attributeFiles[file][row][:])
+		}
+	}
+	for tile := range s.borderTiles {
+		state.Bytes(s.borderTiles[tile][:])
+	}
+	loadColors(&state, s.borderMap[:])
+	for i := range s.borderPalettes {
+		loadColors(&state, s.borderPalettes[i][:])
+	}
+
+	s.mask = mask(state.Byte())
+	s.transfer = state.Byte()
+	s.transferParam = state.Byte()
+
+	return state.Err("sgb")
+}
+
+// saveColors saves RGB555 colors, or border map entries
+func saveColors(state *common.StateEncoder, colors []uint16) {
+	for _, c := range colors {
+		state.Uint16(c)
+	}
+}
+
+func loadColors(state *common.StateDecoder, colors []uint16) {
+	for i := range colors {
+		colors[i] = state.Uint16()
+	}
+}
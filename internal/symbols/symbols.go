@@ -0,0 +1,201 @@
+package symbols
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+* RGBDS symbol files
+*
+* ; comment
+* 00:0150 Start
+* 01:4000 BankedFunction
+* 01:4010 BankedFunction.loop
+* 00:c000 wPlayerX
+*
+* one symbol per line, bank:address in hexadecimal then the name, ROM symbols are told apart by their bank,
+* symbols of the other regions are matched on their address only, the emulator does not bank them
+*
+ */
+
+// Symbol is a named address in a bank
+type Symbol struct {
+	Name    string
+	Bank    int
+	Address uint16
+}
+
+// anyBank indexes the symbols outside of the ROM
+const anyBank = -1
+
+// Table holds the symbols of a ROM, a nil Table has no symbols
+type Table struct {
+	banks  map[int][]Symbol // by bank for the ROM, anyBank for the rest, sorted by address
+	byName map[string]Symbol
+}
+
+// regions are the start addresses of the memory regions, symbols do not extend past their region
+var regions = []uint16{0x0000, 0x4000, 0x8000, 0xA000, 0xC000, 0xE000, 0xFE00, 0xFF00, 0xFF80}
+
+func key(bank int, address uint16) int {
+	if address > 0x7FFF {
+		return anyBank
+	}
+
+	return bank
+}
+
+func region(address uint16) uint16 {
+	start := regions[0]
+	for _, boundary := range regions {
+		if address >= boundary {
+			start = boundary
+		}
+	}
+
+	return start
+}
+
+// Parse reads a symbol file
+func Parse(r io.Reader) (*Table, error) {
+	t := &Table{banks: make(map[int][]Symbol), byName: make(map[string]Symbol)}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), ";")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+
+		bankText, addressText, ok := strings.Cut(fields[0], ":")
+		if !ok || len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected bank:address name, got %q", line, strings.TrimSpace(text))
+		}
+
+		bank, err := strconv.ParseUint(bankText, 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid bank %q", line, bankText)
+		}
+
+		address, err := strconv.ParseUint(addressText, 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid address %q", line, addressText)
+		}
+
+		symbol := Symbol{Name: fields[1], Bank: int(bank), Address: uint16(address)}
+		k := key(symbol.Bank, symbol.Address)
+		t.banks[k] = append(t.banks[k], symbol)
+		t.byName[symbol.Name] = symbol
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, symbols := range t.banks {
+		sort.SliceStable(symbols, func(i, j int) bool { return symbols[i].Address < symbols[j].Address })
+	}
+
+	return t, nil
+}
+
+// Load reads the symbol file at path
+func Load(path string) (*Table, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	t, err := Parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return t, nil
+}
+
+// LoadForROM reads the symbol file next to a ROM (game.gb, game.sym), it returns a nil Table without error
+// when there is none
+func LoadForROM(romPath string) (*Table, error) {
+	t, err := Load(strings.TrimSuffix(romPath, filepath.Ext(romPath)) + ".sym")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	return t, err
+}
+
+// Lookup returns the name of the symbol at address in bank
+func (t *Table) Lookup(bank int, address uint16) (string, bool) {
+	symbol, ok := t.Nearest(bank, address)
+	if !ok || symbol.Address != address {
+		return "", false
+	}
+
+	return symbol.Name, true
+}
+
+// Nearest returns the last symbol at or before address in bank, in the same memory region
+func (t *Table) Nearest(bank int, address uint16) (Symbol, bool) {
+	if t == nil {
+		return Symbol{}, false
+	}
+
+	symbols := t.banks[key(bank, address)]
+	i := sort.Search(len(symbols), func(i int) bool { return symbols[i].Address > address }) - 1
+
+	if i < 0 || region(symbols[i].Address) != region(address) {
+		return Symbol{}, false
+	}
+
+	// the first of the symbols sharing the address
+	for i > 0 && symbols[i-1].Address == symbols[i].Address {
+		i--
+	}
+
+	return symbols[i], true
+}
+
+// Format returns address as symbol or symbol+offset, or nothing without a symbol before it
+func (t *Table) Format(bank int, address uint16) string {
+	symbol, ok := t.Nearest(bank, address)
+	if !ok {
+		return ""
+	}
+
+	if symbol.Address == address {
+		return symbol.Name
+	}
+
+	return fmt.Sprintf("%s+$%X", symbol.Name, address-symbol.Address)
+}
+
+// Find returns the symbol named name
+func (t *Table) Find(name string) (Symbol, bool) {
+	if t == nil {
+		return Symbol{}, false
+	}
+
+	symbol, ok := t.byName[name]
+	return symbol, ok
+}
+
+// Bank returns the symbols of a ROM bank sorted by address
+func (t *Table) Bank(bank int) []Symbol {
+	if t == nil {
+		return nil
+	}
+
+	return t.banks[bank]
+}
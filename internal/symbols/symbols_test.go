@@ -0,0 +1,65 @@
+package symbols
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/carvhal/gby/internal/testutils"
+)
+
+const symbolFile = `; File generated by rgblink
+00:0150 Start
+00:0160 Start.loop
+01:4000 BankOne
+02:4000 BankTwo
+02:4010 BankTwo.table ; local label
+00:c000 wPlayerX
+01:d000 wBuffer
+`
+
+func TestParse(t *testing.T) {
+	table, err := Parse(strings.NewReader(symbolFile))
+	Must(t, err, "Expected no error parsing: %v")
+
+	name, ok := table.Lookup(0, 0x0150)
+	Expect(t, ok, "Start found").ToEqual(true)
+	Expect(t, name, "Start").ToEqual("Start")
+
+	Expect(t, table.Format(0, 0x0163), "offset").ToEqual("Start.loop+$3")
+	Expect(t, table.Format(1, 0x4002), "bank 1").ToEqual("BankOne+$2")
+	Expect(t, table.Format(2, 0x4002), "bank 2").ToEqual("BankTwo+$2")
+	Expect(t, table.Format(3, 0x4002), "bank without symbols").ToEqual("")
+	Expect(t, table.Format(0, 0x3FFF), "symbols stay in their region").ToEqual("Start.loop+$3E9F")
+	Expect(t, table.Format(0, 0x0100), "before the first symbol").ToEqual("")
+	Expect(t, table.Format(5, 0xD004), "work RAM ignores the bank").ToEqual("wBuffer+$4")
+
+	symbol, ok := table.Find("BankTwo.table")
+	Expect(t, ok, "found by name").ToEqual(true)
+	Expect(t, symbol, "symbol").ToEqual(Symbol{Name: "BankTwo.table", Bank: 2, Address: 0x4010})
+
+	Expect(t, len(table.Bank(2)), "symbols of bank 2").ToEqual(2)
+}
+
+func TestParseErrors(t *testing.T) {
+	_, err := Parse(strings.NewReader("00:0150 Start\n0150 Broken\n"))
+	Expect(t, err != nil && strings.HasPrefix(err.Error(), "line 2:"), "error on line 2").ToEqual(true)
+
+	_, err = Parse(strings.NewReader("zz:0150 Start\n"))
+	Expect(t, err != nil, "invalid bank").ToEqual(true)
+}
+
+func TestLoadForROM(t *testing.T) {
+	dir := t.TempDir()
+
+	table, err := LoadForROM(filepath.Join(dir, "game.gb"))
+	Must(t, err, "Expected no error without a symbol file: %v")
+	Expect(t, table == nil, "no table").ToEqual(true)
+	Expect(t, table.Format(0, 0x0150), "nil table formats nothing").ToEqual("")
+
+	Must(t, os.WriteFile(filepath.Join(dir, "game.sym"), []byte(symbolFile), 0o644), "Expected no error writing: %v")
+	table, err = LoadForROM(filepath.Join(dir, "game.gb"))
+	Must(t, err, "Expected no error loading: %v")
+	Expect(t, table.Format(0, 0x0150), "loaded").ToEqual("Start")
+}
@@ -0,0 +1,21 @@
+package testmachine
+
+import (
+	"github.com/carvhal/gby/internal/cpu"
+	"github.com/carvhal/gby/internal/memory"
+)
+
+// ROM returns a 32KB ROM without memory bank controller, with program copied at origin
+func ROM(origin uint16, program ...byte) []byte {
+	rom := make([]byte, 0x8000)
+	copy(rom[origin:], program)
+
+	return rom
+}
+
+// New returns a CPU and the bus it runs rom on, the CPU starts at 0x0000 with its registers cleared
+func New(rom []byte) (*cpu.CPU, *memory.Controller) {
+	bus := memory.NewController(rom)
+
+	return cpu.NewCPU(bus), bus
+}